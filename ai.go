@@ -1,25 +1,32 @@
 package encoreapp
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"encore.dev/beta/errs"
 	fuzzy "github.com/paul-mannino/go-fuzzywuzzy"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type GroqChatRequest struct {
-	Messages []GroqMessage `json:"messages"`
-	Model    string        `json:"model"`
+	Messages      []GroqMessage      `json:"messages"`
+	Model         string             `json:"model"`
+	Stream        bool               `json:"stream,omitempty"`
+	StreamOptions *GroqStreamOptions `json:"stream_options,omitempty"`
+}
+
+type GroqStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type GroqMessage struct {
@@ -31,10 +38,17 @@ type GroqChatResponse struct {
 	Choices []struct {
 		Message GroqMessage `json:"message"`
 	} `json:"choices"`
+	Usage GroqUsage `json:"usage"`
+}
+
+type GroqUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
 }
 
 // Helper function to log AI interactions
-func logAIInteraction(userID *primitive.ObjectID, prompt string, response string, intent string, success bool, errorMsg string) {
+func logAIInteraction(userID *primitive.ObjectID, prompt string, response string, intent string, success bool, errorMsg string, promptVersion string) {
 	var userIDStr string
 	if userID != nil {
 		userIDStr = userID.Hex()
@@ -46,6 +60,7 @@ func logAIInteraction(userID *primitive.ObjectID, prompt string, response string
 		"intent":          intent,
 		"success":         success,
 		"error":           errorMsg,
+		"prompt_version":  promptVersion,
 		"timestamp":       time.Now().Unix(),
 	})
 }
@@ -71,56 +86,36 @@ func validateAIResponse(response string) bool {
 	return true
 }
 
-func callGroqChat(userID *primitive.ObjectID, userPrompt string, systemPrompt string) (string, error) {
-	date := time.Now()
-	dayAndDate := fmt.Sprintf("%s, %s", date.Weekday(), date)
-	systemPrompt = fmt.Sprintf("Today is %s ", dayAndDate, systemPrompt)
-	reqBody := GroqChatRequest{
-		Model: "llama-3.1-8b-instant",
+// newChatRequest builds the completion request for a prompt, prefixed with the user's date.
+func newChatRequest(ctx context.Context, userPrompt string, prompt activePrompt) GroqChatRequest {
+	// Dates in prompts are resolved in the user's time zone, not the server's
+	date := clockFromContext(ctx).Now
+	dayAndDate := fmt.Sprintf("%s, %s", date.Weekday(), date.Format(time.RFC3339))
+	systemPrompt := fmt.Sprintf("Today is %s %s", dayAndDate, prompt.Text)
+	return GroqChatRequest{
+		Model: llmModel(),
 		Messages: []GroqMessage{
 			{Role: "system", Content: systemPrompt},
 			{Role: "user", Content: userPrompt},
 		},
 	}
-	b, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %v", err)
-	}
+}
 
-	req, err := http.NewRequest("POST", "https://api.groq.com/openai/v1/chat/completions", bytes.NewReader(b))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+func callGroqChat(ctx context.Context, userID *primitive.ObjectID, userPrompt string, prompt activePrompt) (string, error) {
+	reqBody := newChatRequest(ctx, userPrompt, prompt)
+	if userID != nil {
+		if err := checkAIQuota(ctx, *userID); err != nil {
+			return "", err
+		}
 	}
-
-	req.Header.Set("Authorization", "Bearer "+secrets.GROQ_API_KEY)
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	ctx, cancel := context.WithTimeout(ctx, llmMaxAttempts*llmRequestTimeout)
+	defer cancel()
+	groqResp, err := newLLMClient().Complete(ctx, reqBody)
 	if err != nil {
-		return "", fmt.Errorf("failed to make request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		body, _ := io.ReadAll(resp.Body)
-
-		// Handle specific error cases
-		switch resp.StatusCode {
-		case 429:
-			return "", errors.New("rate limit exceeded - too many requests")
-		case 401:
-			return "", errors.New("authentication failed - invalid API key")
-		case 403:
-			return "", errors.New("access forbidden - API key may be invalid or expired")
-		case 500:
-			return "", errors.New("internal server error from Groq API")
-		default:
-			return "", fmt.Errorf("Groq API error (status %d): %s", resp.StatusCode, string(body))
-		}
+		return "", aiError(err)
 	}
-
-	var groqResp GroqChatResponse
-	if err := json.NewDecoder(resp.Body).Decode(&groqResp); err != nil {
-		return "", fmt.Errorf("failed to decode response: %v", err)
+	if userID != nil {
+		recordAIUsage(ctx, *userID, reqBody.Model, groqResp.Usage)
 	}
 
 	if len(groqResp.Choices) == 0 {
@@ -141,7 +136,8 @@ func callGroqChat(userID *primitive.ObjectID, userPrompt string, systemPrompt st
 		"prompt": userPrompt,
 	})
 	LogEvent("ai_reply", userIDStr, map[string]interface{}{
-		"reply": responseContent,
+		"reply":          responseContent,
+		"prompt_version": prompt.Label(),
 	})
 
 	return responseContent, nil
@@ -151,6 +147,7 @@ func callGroqChat(userID *primitive.ObjectID, userPrompt string, systemPrompt st
 type AIAssistantRequest struct {
 	Prompt        string `json:"prompt"`
 	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
 }
 
 type AIAssistantResponse struct {
@@ -161,6 +158,9 @@ type AIAssistantResponse struct {
 	NextAction *NextAction `json:"nextAction,omitempty"`
 	Tasks      []Task      `json:"tasks,omitempty"`
 	Summary    string      `json:"summary,omitempty"`
+
+	Clarification *AIClarification       `json:"clarification,omitempty"`
+	BulkPreview   *AIBulkPreviewResponse `json:"bulkPreview,omitempty"`
 }
 
 // encore:api public method=POST path=/api/ai/assistant
@@ -175,15 +175,33 @@ func AIAssistant(ctx context.Context, req *AIAssistantRequest) (*AIAssistantResp
 		}
 	}()
 
+	userID, _ := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if !userID.IsZero() {
+		ctx = withUserClock(ctx, userID, req.TimeZone)
+	}
+	ctx, finish := beginAIAction(ctx, userID, "", req.Prompt)
+	defer finish()
+
+	// Don't wait on an unhealthy provider
+	if llmBreaker.Open() {
+		return providerDownResponse(), nil
+	}
+
 	// 1. Parse intent
+	parseVersion := getPrompt(ctx, promptParseIntent, userID).Label()
 	parseResp, err := AIParseIntent(ctx, &AIParseIntentRequest{
 		Prompt:        req.Prompt,
 		Authorization: req.Authorization,
 	})
 	if err != nil {
 		// Log the error and provide a helpful fallback
-		userID, _ := getUserObjectIDFromAuth(ctx, req.Authorization)
-		logAIInteraction(&userID, req.Prompt, "", "error", false, err.Error())
+		logAIInteraction(&userID, req.Prompt, "", "error", false, err.Error(), parseVersion)
+		if aiErrorCode(err) == errs.ResourceExhausted {
+			return nil, err
+		}
+		if aiErrorCode(err) == errs.Unavailable {
+			return providerDownResponse(), nil
+		}
 
 		LogEvent("ai_assistant_error", "", map[string]interface{}{
 			"error":  err.Error(),
@@ -209,10 +227,14 @@ func AIAssistant(ctx context.Context, req *AIAssistantRequest) (*AIAssistantResp
 	}
 
 	// Log successful intent parsing
-	userID, _ := getUserObjectIDFromAuth(ctx, req.Authorization)
-	logAIInteraction(&userID, req.Prompt, "", parseResp.Intent, true, "")
+	logAIInteraction(&userID, req.Prompt, "", parseResp.Intent, true, "", parseVersion)
 
-	switch parseResp.Intent {
+	return runAssistantIntent(ctx, req, parseResp.Intent)
+}
+
+// runAssistantIntent dispatches a classified prompt to the matching AI endpoint.
+func runAssistantIntent(ctx context.Context, req *AIAssistantRequest, intent string) (*AIAssistantResponse, error) {
+	switch intent {
 	case "chat":
 		chatResp, err := AIChat(ctx, &AIChatRequest{
 			Prompt:        req.Prompt,
@@ -303,6 +325,8 @@ func AIAssistant(ctx context.Context, req *AIAssistantRequest) (*AIAssistantResp
 			Tasks:   completeResp.Tasks,
 			Project: completeResp.Project,
 			Message: completeResp.Message,
+
+			Clarification: completeResp.Clarification,
 		}, nil
 
 	case "updateEntity":
@@ -319,6 +343,23 @@ func AIAssistant(ctx context.Context, req *AIAssistantRequest) (*AIAssistantResp
 			Task:       updateResp.Task,
 			Project:    updateResp.Project,
 			NextAction: updateResp.NextAction,
+
+			Clarification: updateResp.Clarification,
+		}, nil
+
+	case "bulkUpdate":
+		preview, err := AIBulkPreview(ctx, &AIBulkRequest{
+			Prompt:        req.Prompt,
+			Authorization: req.Authorization,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &AIAssistantResponse{
+			Intent:      "bulkUpdate",
+			Message:     preview.Message,
+			Tasks:       preview.Tasks,
+			BulkPreview: preview,
 		}, nil
 
 	default:
@@ -342,12 +383,21 @@ func AIAssistant(ctx context.Context, req *AIAssistantRequest) (*AIAssistantResp
 	}
 }
 
+// providerDownResponse is the chat fallback used while the model provider is unavailable.
+func providerDownResponse() *AIAssistantResponse {
+	return &AIAssistantResponse{
+		Intent:  "chat",
+		Message: "I can't reach my AI service right now. Your tasks are safe - please try again in a minute.",
+	}
+}
+
 // AI Endpoints
 
 // Parse intent endpoint
 type AIParseIntentRequest struct {
 	Prompt        string `json:"prompt"`
 	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
 }
 
 type AIParseIntentResponse struct {
@@ -367,8 +417,14 @@ func AIParseIntent(ctx context.Context, req *AIParseIntentRequest) (*AIParseInte
 	if err != nil {
 		return nil, errors.New("unauthorized")
 	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	return parseIntent(ctx, userID, req.Prompt)
+}
 
-	resp, err := callGroqChat(&userID, req.Prompt, SystemPromptParseIntent)
+// parseIntent classifies a prompt. Responses that aren't valid JSON fall back to "chat".
+func parseIntent(ctx context.Context, userID primitive.ObjectID, prompt string) (*AIParseIntentResponse, error) {
+	systemPrompt := getPrompt(ctx, promptParseIntent, userID)
+	resp, err := callGroqChat(ctx, &userID, prompt, systemPrompt)
 	if err != nil {
 		return nil, err
 	}
@@ -379,13 +435,13 @@ func AIParseIntent(ctx context.Context, req *AIParseIntentRequest) (*AIParseInte
 		// This handles cases where the AI gives a non-JSON response
 		LogEvent("ai_parse_fallback", userID.Hex(), map[string]interface{}{
 			"reason":   "invalid_json_format",
-			"prompt":   req.Prompt,
+			"prompt":   prompt,
 			"response": resp,
 		})
-		logAIInteraction(&userID, req.Prompt, resp, "chat_fallback", true, "invalid_json_format")
+		logAIInteraction(&userID, prompt, resp, "chat_fallback", true, "invalid_json_format", systemPrompt.Label())
 		return &AIParseIntentResponse{
 			Intent:     "chat",
-			UserPrompt: req.Prompt,
+			UserPrompt: prompt,
 			Context:    "General question or non-productivity topic",
 		}, nil
 	}
@@ -396,14 +452,14 @@ func AIParseIntent(ctx context.Context, req *AIParseIntentRequest) (*AIParseInte
 		// This prevents errors when users ask non-productivity questions
 		LogEvent("ai_parse_fallback", userID.Hex(), map[string]interface{}{
 			"reason":   "json_unmarshal_failed",
-			"prompt":   req.Prompt,
+			"prompt":   prompt,
 			"response": resp,
 			"error":    err.Error(),
 		})
-		logAIInteraction(&userID, req.Prompt, resp, "chat_fallback", true, "json_unmarshal_failed")
+		logAIInteraction(&userID, prompt, resp, "chat_fallback", true, "json_unmarshal_failed", systemPrompt.Label())
 		return &AIParseIntentResponse{
 			Intent:     "chat",
-			UserPrompt: req.Prompt,
+			UserPrompt: prompt,
 			Context:    "General question or non-productivity topic",
 		}, nil
 	}
@@ -416,6 +472,7 @@ func AIParseIntent(ctx context.Context, req *AIParseIntentRequest) (*AIParseInte
 type AIChatRequest struct {
 	Prompt        string `json:"prompt"`
 	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
 }
 
 type AIChatResponse struct {
@@ -429,8 +486,10 @@ func AIChat(ctx context.Context, req *AIChatRequest) (*AIChatResponse, error) {
 	if err != nil {
 		return nil, errors.New("unauthorized")
 	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
 
-	resp, err := callGroqChat(&userID, req.Prompt, SystemPromptChat)
+	systemPrompt := groundedChatPrompt(ctx, userID)
+	resp, err := callGroqChat(ctx, &userID, req.Prompt, systemPrompt)
 	if err != nil {
 		// Log the error for debugging
 		LogEvent("ai_chat_error", userID.Hex(), map[string]interface{}{
@@ -442,14 +501,14 @@ func AIChat(ctx context.Context, req *AIChatRequest) (*AIChatResponse, error) {
 
 	// Ensure we have a valid response
 	if resp == "" {
-		logAIInteraction(&userID, req.Prompt, "", "chat", false, "empty_response")
+		logAIInteraction(&userID, req.Prompt, "", "chat", false, "empty_response", systemPrompt.Label())
 		return &AIChatResponse{
 			Response: "I'm sorry, I couldn't generate a response. Please try again.",
 		}, nil
 	}
 
 	// Log successful chat interaction
-	logAIInteraction(&userID, req.Prompt, resp, "chat", true, "")
+	logAIInteraction(&userID, req.Prompt, resp, "chat", true, "", systemPrompt.Label())
 
 	return &AIChatResponse{Response: resp}, nil
 }
@@ -458,6 +517,7 @@ func AIChat(ctx context.Context, req *AIChatRequest) (*AIChatResponse, error) {
 type AISummarizeRequest struct {
 	Prompt        string `json:"prompt"`
 	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
 }
 type AISummarizeResponse struct {
 	Summary  string  `json:"summary"`
@@ -470,7 +530,10 @@ func AISummarize(ctx context.Context, req *AISummarizeRequest) (*AISummarizeResp
 	if err != nil {
 		return nil, errors.New("unauthorized")
 	}
-	resp, err := callGroqChat(&userID, req.Prompt, SystemPromptSummarizer)
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	ctx, finish := beginAIAction(ctx, userID, "summarize", req.Prompt)
+	defer finish()
+	resp, err := callGroqChat(ctx, &userID, req.Prompt, getPrompt(ctx, promptSummarizer, userID))
 	if err != nil {
 		return nil, err
 	}
@@ -488,7 +551,7 @@ func AISummarize(ctx context.Context, req *AISummarizeRequest) (*AISummarizeResp
 	case "summarize":
 		// General context summarization
 		prompt := "Summarize the following context and suggest improvements:\n" + aiResp.Context
-		summary, err := callGroqChat(&userID, prompt, SystemPromptSummarizer)
+		summary, err := callGroqChat(ctx, &userID, prompt, getPrompt(ctx, promptSummarizer, userID))
 		if err != nil {
 			return nil, err
 		}
@@ -504,7 +567,7 @@ func AISummarize(ctx context.Context, req *AISummarizeRequest) (*AISummarizeResp
 		var summary string
 		switch aiResp.EntityType {
 		case "project":
-			projectIDPtr, _ := resolveProjectID(aiResp.Name, userID.Hex())
+			projectIDPtr, _ := resolveProjectID(ctx, aiResp.Name, userID.Hex())
 			if projectIDPtr == nil {
 				return &AISummarizeResponse{Summary: "Project not found."}, nil
 			}
@@ -514,7 +577,7 @@ func AISummarize(ctx context.Context, req *AISummarizeRequest) (*AISummarizeResp
 			completed, _ = tasksCol.CountDocuments(ctx, bson.M{"userId": userID, "projectId": projectID, "completed": true, "trashed": false})
 			summary = fmt.Sprintf("Project \"%s\": %d of %d tasks completed.", aiResp.Name, completed, total)
 		case "nextAction":
-			nextActionIDPtr, _ := resolveNextActionID(aiResp.Name, userID.Hex())
+			nextActionIDPtr, _ := resolveNextActionID(ctx, aiResp.Name, userID.Hex())
 			if nextActionIDPtr == nil {
 				return &AISummarizeResponse{Summary: "Next action/context not found."}, nil
 			}
@@ -544,6 +607,7 @@ func AISummarize(ctx context.Context, req *AISummarizeRequest) (*AISummarizeResp
 type AICreateTaskRequest struct {
 	Context       string `json:"context"`
 	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
 }
 
 type AICreateTaskResponse struct {
@@ -556,59 +620,102 @@ func AICreateTask(ctx context.Context, req *AICreateTaskRequest) (*AICreateTaskR
 	if err != nil {
 		return nil, errors.New("unauthorized")
 	}
-
-	prompt := "Create a task for the following objective/context:\n" + req.Context
-	resp, err := callGroqChat(&userID, prompt, SystemPromptCreateTask)
+	task, err := aiCreateTaskForUser(withUserClock(ctx, userID, req.TimeZone), userID, req.Context)
 	if err != nil {
 		return nil, err
 	}
+	return &AICreateTaskResponse{Task: *task}, nil
+}
 
-	var aiTask struct {
-		Title          string `json:"title"`
-		Description    string `json:"description"`
-		DueDate        string `json:"dueDate"`
-		Priority       int    `json:"priority"`
-		Category       string `json:"category"`
-		ProjectName    string `json:"projectName"`
-		NextActionName string `json:"nextActionName"`
-	}
-	if err := json.Unmarshal([]byte(resp), &aiTask); err != nil {
-		return nil, errors.New("AI response could not be parsed as JSON: " + err.Error())
+// aiCreateTaskForUser extracts a task from text and creates it, resolving project and
+// context names. ctx should carry the user's clock.
+func aiCreateTaskForUser(ctx context.Context, userID primitive.ObjectID, text string) (*Task, error) {
+	ctx, finish := beginAIAction(ctx, userID, "createTask", text)
+	defer finish()
+
+	aiTask, err := extractTask(ctx, userID, text)
+	if err != nil {
+		return nil, err
 	}
 
 	var projectIDPtr, nextActionIDPtr *string
 	if aiTask.ProjectName != "" {
-		projectIDPtr, _ = resolveProjectID(aiTask.ProjectName, userID.Hex())
+		projectIDPtr, _ = resolveProjectID(ctx, aiTask.ProjectName, userID.Hex())
 	}
 
 	if aiTask.NextActionName != "" {
-		nextActionIDPtr, _ = resolveNextActionID(aiTask.NextActionName, userID.Hex())
+		nextActionIDPtr, _ = resolveNextActionID(ctx, aiTask.NextActionName, userID.Hex())
 	}
 
-	dueDateStr := aiTask.DueDate
-	if dueDateStr == "" {
-		dueDateStr = time.Now().Format(time.RFC3339)
+	createReq := &CreateTaskRequest{
+		Title:        aiTask.Title,
+		Description:  aiTask.Description,
+		DueDate:      &aiTask.DueDate,
+		DeferUntil:   &aiTask.DeferUntil,
+		Priority:     aiTask.Priority,
+		Category:     aiTask.Category,
+		ProjectID:    projectIDPtr,
+		NextActionID: nextActionIDPtr,
 	}
 
-	createReq := &CreateTaskRequest{
-		Authorization: req.Authorization,
-		Title:         aiTask.Title,
-		Description:   aiTask.Description,
-		DueDate:       &dueDateStr,
-		Priority:      aiTask.Priority,
-		Category:      aiTask.Category,
-		ProjectID:     projectIDPtr,
-		NextActionID:  nextActionIDPtr,
+	taskResp, err := createTaskForUser(ctx, userID, createReq)
+	if err != nil {
+		return nil, err
 	}
+	return &taskResp.Task, nil
+}
 
-	taskResp, err := CreateTask(ctx, createReq)
+// aiTaskFields is the task extracted by SystemPromptCreateTask.
+type aiTaskFields struct {
+	Title          string `json:"title"`
+	Description    string `json:"description"`
+	DueDate        string `json:"dueDate"`
+	DeferUntil     string `json:"deferUntil"`
+	Priority       int    `json:"priority"`
+	Category       string `json:"category"`
+	ProjectName    string `json:"projectName"`
+	NextActionName string `json:"nextActionName"`
+}
+
+// extractTask asks the model for the task described by text. DueDate is reconciled
+// with the locally parsed date expression and empty when the text gives none;
+// DeferUntil is set for a start date such as "starting next Monday".
+func extractTask(ctx context.Context, userID primitive.ObjectID, text string) (*aiTaskFields, error) {
+	clock := clockFromContext(ctx)
+	prompt := "Create a task for the following objective/context:\n" + withTaskDateHints(text, clock)
+	resp, err := callGroqChat(ctx, &userID, prompt, getPrompt(ctx, promptCreateTask, userID))
 	if err != nil {
 		return nil, err
 	}
-	return &AICreateTaskResponse{Task: taskResp.Task}, nil
+
+	var aiTask aiTaskFields
+	if err := json.Unmarshal([]byte(resp), &aiTask); err != nil {
+		return nil, errors.New("AI response could not be parsed as JSON: " + err.Error())
+	}
+	dueText := text
+	if start, rest, ok := splitDeferDate(text, clock); ok {
+		aiTask.DeferUntil, dueText = start.Time.Format(time.RFC3339), rest
+	} else if d, err := parseTaskDate(aiTask.DeferUntil, clock); err == nil && d.After(clock.Now) {
+		aiTask.DeferUntil = d.Format(time.RFC3339)
+	} else {
+		aiTask.DeferUntil = ""
+	}
+	dueDate, corrected := reconcileDueDate(aiTask.DueDate, dueText, clock)
+	if corrected {
+		logDueDateCorrection(userID, aiTask.DueDate, dueDate)
+	}
+	// A task can't be due before it becomes available
+	if aiTask.DeferUntil != "" {
+		start, _ := parseTaskDate(aiTask.DeferUntil, clock)
+		if due, err := parseTaskDate(dueDate, clock); err == nil && due.Before(start) {
+			dueDate = aiTask.DeferUntil
+		}
+	}
+	aiTask.DueDate = dueDate
+	return &aiTask, nil
 }
 
-func resolveProjectID(name string, userID string) (*string, error) {
+func resolveProjectID(ctx context.Context, name string, userID string) (*string, error) {
 	if name == "" {
 		return nil, nil
 	}
@@ -616,32 +723,16 @@ func resolveProjectID(name string, userID string) (*string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid userID format: %v", err)
 	}
+	if id := lookupProjectID(ctx, name, userObjID); id != nil {
+		idStr := id.Hex()
+		return &idStr, nil
+	}
+
 	client, err := GetMongoClient()
 	if err != nil {
 		return nil, errors.New("database connection failed")
 	}
 	col := client.Database("gtd").Collection("projects")
-	var project struct {
-		ID primitive.ObjectID `bson:"_id"`
-	}
-
-	// Try exact match (case-insensitive)
-	filter := bson.M{
-		"name":   bson.M{"$regex": "^" + name + "$", "$options": "i"},
-		"userId": userObjID,
-	}
-	err = col.FindOne(context.Background(), filter).Decode(&project)
-	if err == nil {
-		idStr := project.ID.Hex()
-		return &idStr, nil
-	}
-
-	// Fuzzy fallback
-	fuzzyID, _ := fuzzyFindOneByTitle(context.Background(), "projects", userObjID, name, 70)
-	if fuzzyID != nil {
-		idStr := fuzzyID.Hex()
-		return &idStr, nil
-	}
 
 	// Not found: create new project
 	newProject := Project{
@@ -652,50 +743,64 @@ func resolveProjectID(name string, userID string) (*string, error) {
 		UpdatedAt: time.Now(),
 		TaskCount: 0,
 	}
-	_, err = col.InsertOne(context.Background(), newProject)
+	_, err = col.InsertOne(ctx, newProject)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create project: %v", err)
 	}
+	recordActionCreate(ctx, col, newProject.ID)
+	invalidateFuzzyIndex("projects", userObjID)
 
 	idStr := newProject.ID.Hex()
 	return &idStr, nil
 }
 
-func resolveNextActionID(name string, userID string) (*string, error) {
+// lookupProjectID finds an existing project by exact (case-insensitive) or fuzzy name without creating one.
+func lookupProjectID(ctx context.Context, name string, userID primitive.ObjectID) *primitive.ObjectID {
 	if name == "" {
-		return nil, nil
-	}
-	userObjID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid userID format: %v", err)
+		return nil
 	}
 	client, err := GetMongoClient()
 	if err != nil {
-		return nil, errors.New("database connection failed")
+		return nil
 	}
-	col := client.Database("gtd").Collection("nextactions")
-	var nextAction struct {
+	col := client.Database("gtd").Collection("projects")
+	var project struct {
 		ID primitive.ObjectID `bson:"_id"`
 	}
 
 	// Try exact match (case-insensitive)
 	filter := bson.M{
-		"context_name": bson.M{"$regex": "^" + name + "$", "$options": "i"},
-		"userId":       userObjID,
+		"name":   bson.M{"$regex": "^" + regexp.QuoteMeta(name) + "$", "$options": "i"},
+		"userId": userID,
 	}
-	err = col.FindOne(context.Background(), filter).Decode(&nextAction)
-	if err == nil {
-		idStr := nextAction.ID.Hex()
-		return &idStr, nil
+	if err := col.FindOne(ctx, filter).Decode(&project); err == nil {
+		return &project.ID
 	}
 
 	// Fuzzy fallback
-	fuzzyID, _ := fuzzyFindOneByTitle(context.Background(), "nextactions", userObjID, name, 70)
-	if fuzzyID != nil {
-		idStr := fuzzyID.Hex()
+	fuzzyID, _ := fuzzyFindOneByTitle(ctx, "projects", userID, name, 70)
+	return fuzzyID
+}
+
+func resolveNextActionID(ctx context.Context, name string, userID string) (*string, error) {
+	if name == "" {
+		return nil, nil
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid userID format: %v", err)
+	}
+	if id := lookupNextActionID(ctx, name, userObjID); id != nil {
+		idStr := id.Hex()
 		return &idStr, nil
 	}
 
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("nextactions")
+
 	// Not found: create new next action/context
 	newNextAction := NextAction{
 		ID:          primitive.NewObjectID(),
@@ -705,19 +810,50 @@ func resolveNextActionID(name string, userID string) (*string, error) {
 		UpdatedAt:   time.Now(),
 		TaskCount:   0,
 	}
-	_, err = col.InsertOne(context.Background(), newNextAction)
+	_, err = col.InsertOne(ctx, newNextAction)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create next action: %v", err)
 	}
+	recordActionCreate(ctx, col, newNextAction.ID)
+	invalidateFuzzyIndex("nextactions", userObjID)
 
 	idStr := newNextAction.ID.Hex()
 	return &idStr, nil
 }
 
+// lookupNextActionID finds an existing next action by exact (case-insensitive) or fuzzy name without creating one.
+func lookupNextActionID(ctx context.Context, name string, userID primitive.ObjectID) *primitive.ObjectID {
+	if name == "" {
+		return nil
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil
+	}
+	col := client.Database("gtd").Collection("nextactions")
+	var nextAction struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+
+	// Try exact match (case-insensitive)
+	filter := bson.M{
+		"context_name": bson.M{"$regex": "^" + regexp.QuoteMeta(name) + "$", "$options": "i"},
+		"userId":       userID,
+	}
+	if err := col.FindOne(ctx, filter).Decode(&nextAction); err == nil {
+		return &nextAction.ID
+	}
+
+	// Fuzzy fallback
+	fuzzyID, _ := fuzzyFindOneByTitle(ctx, "nextactions", userID, name, 70)
+	return fuzzyID
+}
+
 // project creation endpoint
 type AICreateProjectRequest struct {
 	Prompt        string `json:"prompt"`
 	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
 }
 
 type AICreateProjectResponse struct {
@@ -731,8 +867,11 @@ func AICreateProject(ctx context.Context, req *AICreateProjectRequest) (*AICreat
 	if err != nil {
 		return nil, errors.New("unauthorized")
 	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	ctx, finish := beginAIAction(ctx, userID, "createProject", req.Prompt)
+	defer finish()
 
-	resp, err := callGroqChat(&userID, req.Prompt, SystemPromptCreateProject)
+	resp, err := callGroqChat(ctx, &userID, req.Prompt, getPrompt(ctx, promptCreateProject, userID))
 	if err != nil {
 		return nil, err
 	}
@@ -768,8 +907,8 @@ func AICreateProject(ctx context.Context, req *AICreateProjectRequest) (*AICreat
 	createdTasks := []Task{}
 	for _, t := range aiResp.Tasks {
 		dueDateStr := t.DueDate
-		if dueDateStr == "" {
-			dueDateStr = time.Now().Format(time.RFC3339)
+		if _, err := parseTaskDate(dueDateStr, clockFromContext(ctx)); err != nil {
+			dueDateStr = clockFromContext(ctx).Now.Format(time.RFC3339)
 		}
 		createTaskReq := &CreateTaskRequest{
 			Authorization: req.Authorization,
@@ -923,6 +1062,7 @@ func findAllRelevantTasks(ctx context.Context, userID primitive.ObjectID, title
 type AICompleteRequest struct {
 	Prompt        string `json:"prompt"`
 	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
 }
 type AICompleteResponse struct {
 	Message    string      `json:"message"`
@@ -931,6 +1071,8 @@ type AICompleteResponse struct {
 	Project    *Project    `json:"project,omitempty"`
 	NextAction *NextAction `json:"nextAction,omitempty"`
 	Count      int         `json:"count,omitempty"`
+
+	Clarification *AIClarification `json:"clarification,omitempty"`
 }
 
 // encore:api public method=POST path=/api/ai/complete
@@ -939,9 +1081,12 @@ func AICompleteTask(ctx context.Context, req *AICompleteRequest) (*AICompleteRes
 	if err != nil {
 		return nil, errors.New("unauthorized")
 	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	ctx, finish := beginAIAction(ctx, userID, "completeTask", req.Prompt)
+	defer finish()
 
 	// Use Groq to extract intentType and relevant fields
-	resp, err := callGroqChat(&userID, req.Prompt, SystemPromptCompleteTask)
+	resp, err := callGroqChat(ctx, &userID, req.Prompt, getPrompt(ctx, promptCompleteTask, userID))
 	if err != nil {
 		return nil, err
 	}
@@ -964,20 +1109,20 @@ func AICompleteTask(ctx context.Context, req *AICompleteRequest) (*AICompleteRes
 			"completed": false,
 		}
 		if aiResp.ProjectName != "" {
-			projectIDPtr, _ := resolveProjectID(aiResp.ProjectName, userID.Hex())
+			projectIDPtr, _ := resolveProjectID(ctx, aiResp.ProjectName, userID.Hex())
 			if projectIDPtr != nil {
 				projectID, _ := primitive.ObjectIDFromHex(*projectIDPtr)
 				filter["projectId"] = projectID
 			}
 		}
 		if aiResp.NextActionName != "" {
-			nextActionIDPtr, _ := resolveNextActionID(aiResp.NextActionName, userID.Hex())
+			nextActionIDPtr, _ := resolveNextActionID(ctx, aiResp.NextActionName, userID.Hex())
 			if nextActionIDPtr != nil {
 				nextActionID, _ := primitive.ObjectIDFromHex(*nextActionIDPtr)
 				filter["nextActionId"] = nextActionID
 			}
 		}
-		matches, err := findRelevantTasks(ctx, filter, aiResp.Title, 50)
+		matches, err := findRelevantTaskMatches(ctx, filter, aiResp.Title, 50)
 
 		if err != nil {
 			return &AICompleteResponse{Message: "Error searching for your task."}, nil
@@ -986,28 +1131,21 @@ func AICompleteTask(ctx context.Context, req *AICompleteRequest) (*AICompleteRes
 			return &AICompleteResponse{Message: fmt.Sprintf("No task found matching \"%s\".", aiResp.Title)}, nil
 		}
 		if len(matches) > 1 {
-			titles := []string{}
-			for _, t := range matches {
-				titles = append(titles, t.Title)
+			clarification, err := createPendingIntent(ctx, userID, "completeTask", req.Prompt, nil, matches)
+			if err != nil {
+				return &AICompleteResponse{Message: "Error searching for your task."}, nil
 			}
 			return &AICompleteResponse{
-				Message: fmt.Sprintf("Multiple tasks found: %s. Please specify.", strings.Join(titles, "; ")),
-				Tasks:   matches,
+				Message:       fmt.Sprintf("Multiple tasks found: %s. Please specify.", strings.Join(matchTitles(matches), "; ")),
+				Tasks:         matchTasks(matches),
+				Clarification: clarification,
 			}, nil
 		}
-		foundTask := matches[0]
-		_, err = CompleteTask(ctx, foundTask.ID.Hex(), &GetTasksRequest{Authorization: req.Authorization})
-		if err != nil {
-			return &AICompleteResponse{Message: "Could not mark task as complete."}, nil
-		}
-		return &AICompleteResponse{
-			Message: fmt.Sprintf("Task \"%s\" marked as complete!", foundTask.Title),
-			Task:    &foundTask,
-		}, nil
+		return completeFoundTask(ctx, req.Authorization, matches[0].Task), nil
 
 	case "project":
 		// Use your resolveProjectID and fuzzy matching for project name
-		projectIDPtr, _ := resolveProjectID(aiResp.ProjectName, userID.Hex())
+		projectIDPtr, _ := resolveProjectID(ctx, aiResp.ProjectName, userID.Hex())
 		if projectIDPtr == nil {
 			return &AICompleteResponse{Message: fmt.Sprintf("No project found matching \"%s\".", aiResp.ProjectName)}, nil
 		}
@@ -1018,23 +1156,23 @@ func AICompleteTask(ctx context.Context, req *AICompleteRequest) (*AICompleteRes
 			return nil, errors.New("database connection failed")
 		}
 		tasksCol := client.Database("gtd").Collection("tasks")
-		res, err := tasksCol.UpdateMany(ctx, bson.M{
+		count, err := completeAllTasks(ctx, tasksCol, bson.M{
 			"userId":    userID,
 			"projectId": projectID,
 			"completed": false,
 			"trashed":   false,
-		}, bson.M{"$set": bson.M{"completed": true}})
+		})
 		if err != nil {
 			return &AICompleteResponse{Message: "Error completing project tasks."}, nil
 		}
 		return &AICompleteResponse{
-			Message: fmt.Sprintf("Marked %d tasks as complete in project \"%s\".", res.ModifiedCount, aiResp.ProjectName),
-			Count:   int(res.ModifiedCount),
+			Message: fmt.Sprintf("Marked %d tasks as complete in project \"%s\".", count, aiResp.ProjectName),
+			Count:   int(count),
 		}, nil
 
 	case "nextAction":
 		// Use your resolvenextActionID and fuzzy matching for context name
-		nextActionIDPtr, _ := resolveNextActionID(aiResp.NextActionName, userID.Hex())
+		nextActionIDPtr, _ := resolveNextActionID(ctx, aiResp.NextActionName, userID.Hex())
 		if nextActionIDPtr == nil {
 			return &AICompleteResponse{Message: fmt.Sprintf("No next action/context found matching \"%s\".", aiResp.NextActionName)}, nil
 		}
@@ -1044,18 +1182,18 @@ func AICompleteTask(ctx context.Context, req *AICompleteRequest) (*AICompleteRes
 			return nil, errors.New("database connection failed")
 		}
 		tasksCol := client.Database("gtd").Collection("tasks")
-		res, err := tasksCol.UpdateMany(ctx, bson.M{
+		count, err := completeAllTasks(ctx, tasksCol, bson.M{
 			"userId":       userID,
 			"nextActionId": nextActionID,
 			"completed":    false,
 			"trashed":      false,
-		}, bson.M{"$set": bson.M{"completed": true}})
+		})
 		if err != nil {
 			return &AICompleteResponse{Message: "Error completing next action tasks."}, nil
 		}
 		return &AICompleteResponse{
-			Message: fmt.Sprintf("Marked %d tasks as complete in next action \"%s\".", res.ModifiedCount, aiResp.NextActionName),
-			Count:   int(res.ModifiedCount),
+			Message: fmt.Sprintf("Marked %d tasks as complete in next action \"%s\".", count, aiResp.NextActionName),
+			Count:   int(count),
 		}, nil
 
 	default:
@@ -1063,41 +1201,136 @@ func AICompleteTask(ctx context.Context, req *AICompleteRequest) (*AICompleteRes
 	}
 }
 
+// completeFoundTask completes a task the user has already been matched to.
+func completeFoundTask(ctx context.Context, authorization string, task Task) *AICompleteResponse {
+	_, err := CompleteTask(ctx, task.ID.Hex(), &GetTasksRequest{Authorization: authorization})
+	if err != nil {
+		return &AICompleteResponse{Message: "Could not mark task as complete."}
+	}
+	return &AICompleteResponse{
+		Message: fmt.Sprintf("Task \"%s\" marked as complete!", task.Title),
+		Task:    &task,
+	}
+}
+
+// completeAllTasks marks every task matching filter as complete, recording each one
+// when called from an AI action so the batch can be undone.
+func completeAllTasks(ctx context.Context, tasksCol *mongo.Collection, filter bson.M) (int64, error) {
+	var befores []bson.M
+	if actionRecorderFrom(ctx) != nil {
+		cursor, err := tasksCol.Find(ctx, filter)
+		if err != nil {
+			return 0, err
+		}
+		if err := cursor.All(ctx, &befores); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tasksCol.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"completed": true, "completedAt": time.Now(), "updatedAt": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	for _, before := range befores {
+		if id, ok := before["_id"].(primitive.ObjectID); ok {
+			recordActionUpdate(ctx, tasksCol, id, before)
+		}
+	}
+	return res.ModifiedCount, nil
+}
+
 func findRelevantTasks(ctx context.Context, filter bson.M, title string, threshold int) ([]Task, error) {
+	matches, err := findRelevantTaskMatches(ctx, filter, title, threshold)
+	if err != nil {
+		return nil, err
+	}
+	return matchTasks(matches), nil
+}
+
+// taskMatch is a task together with its hybrid (fuzzy + semantic) match score against the searched title.
+type taskMatch struct {
+	Task  Task
+	Score int
+}
+
+// findRelevantTaskMatches returns the tasks matching filter whose title scores at least
+// threshold against title, best match first.
+func findRelevantTaskMatches(ctx context.Context, filter bson.M, title string, threshold int) ([]taskMatch, error) {
 	client, err := GetMongoClient()
 	if err != nil {
 		return nil, errors.New("database connection failed")
 	}
+	userID, _ := filter["userId"].(primitive.ObjectID)
 	tasksCol := client.Database("gtd").Collection("tasks")
-	cursor, err := tasksCol.Find(ctx, filter)
+	cursor, err := tasksCol.Find(ctx, narrowFuzzyFilter(ctx, "tasks", userID, title, filter))
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
-	var matches []Task
+	var tasks []Task
+	var items []embeddable
 	for cursor.Next(ctx) {
 		var task Task
 		if err := cursor.Decode(&task); err != nil {
 			continue
 		}
-		score := fuzzy.Ratio(strings.ToLower(title), strings.ToLower(task.Title))
+		tasks = append(tasks, task)
+		items = append(items, embeddable{Type: "task", ID: task.ID, Text: embeddingText(task.Title, task.Description)})
+	}
+	// Semantic scores are a bonus; fuzzy matching alone still works without them
+	similarity, _ := semanticScores(ctx, userID, title, items)
+	var matches []taskMatch
+	for _, task := range tasks {
+		score := hybridScore(fuzzy.Ratio(strings.ToLower(title), strings.ToLower(task.Title)), similarity[task.ID])
 		if score >= threshold {
-			matches = append(matches, task)
+			matches = append(matches, taskMatch{Task: task, Score: score})
 		}
 	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
 	return matches, nil
 }
 
+func matchTasks(matches []taskMatch) []Task {
+	var tasks []Task
+	for _, m := range matches {
+		tasks = append(tasks, m.Task)
+	}
+	return tasks
+}
+
+func matchTitles(matches []taskMatch) []string {
+	titles := []string{}
+	for _, m := range matches {
+		titles = append(titles, m.Task.Title)
+	}
+	return titles
+}
+
+// aiEntityUpdate is the update extracted by SystemPromptUpdateEntity.
+type aiEntityUpdate struct {
+	EntityType     string   `json:"entityType" bson:"entityType"`
+	Title          string   `json:"title" bson:"title"`
+	NewTitle       string   `json:"newTitle" bson:"newTitle"`
+	DueDate        string   `json:"dueDate" bson:"dueDate"`
+	ProjectName    string   `json:"projectName" bson:"projectName"`
+	NextActionName string   `json:"nextActionName" bson:"nextActionName"`
+	Description    string   `json:"description" bson:"description"`
+	Priority       int      `json:"priority" bson:"priority"`
+	FieldsToUpdate []string `json:"fieldsToUpdate" bson:"fieldsToUpdate"`
+}
+
 // AI update endpoint (for tasks, projects, next actions)
 type AIUpdateRequest struct {
 	Prompt        string `json:"prompt"`
 	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
 }
 type AIUpdateResponse struct {
 	Message    string      `json:"message"`
 	Task       *Task       `json:"task,omitempty"`
 	Project    *Project    `json:"project,omitempty"`
 	NextAction *NextAction `json:"nextAction,omitempty"`
+
+	Clarification *AIClarification `json:"clarification,omitempty"`
 }
 
 // encore:api public method=POST path=/api/ai/update
@@ -1106,25 +1339,26 @@ func AIUpdateEntity(ctx context.Context, req *AIUpdateRequest) (*AIUpdateRespons
 	if err != nil {
 		return nil, errors.New("unauthorized")
 	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	ctx, finish := beginAIAction(ctx, userID, "updateEntity", req.Prompt)
+	defer finish()
 
-	resp, err := callGroqChat(&userID, req.Prompt, SystemPromptUpdateEntity)
+	clock := clockFromContext(ctx)
+	resp, err := callGroqChat(ctx, &userID, withDateHint(req.Prompt, clock), getPrompt(ctx, promptUpdateEntity, userID))
 	if err != nil {
 		return nil, err
 	}
-	var aiResp struct {
-		EntityType     string   `json:"entityType"`
-		Title          string   `json:"title"`
-		NewTitle       string   `json:"newTitle"`
-		DueDate        string   `json:"dueDate"`
-		ProjectName    string   `json:"projectName"`
-		NextActionName string   `json:"nextActionName"`
-		Description    string   `json:"description"`
-		Priority       int      `json:"priority"`
-		FieldsToUpdate []string `json:"fieldsToUpdate"`
-	}
+	var aiResp aiEntityUpdate
 	if err := json.Unmarshal([]byte(resp), &aiResp); err != nil {
 		return nil, errors.New("AI response could not be parsed as JSON: " + err.Error())
 	}
+	if aiResp.DueDate != "" {
+		dueDate, corrected := reconcileDueDate(aiResp.DueDate, req.Prompt, clock)
+		if corrected {
+			logDueDateCorrection(userID, aiResp.DueDate, dueDate)
+		}
+		aiResp.DueDate = dueDate
+	}
 
 	switch aiResp.EntityType {
 	case "task":
@@ -1134,73 +1368,38 @@ func AIUpdateEntity(ctx context.Context, req *AIUpdateRequest) (*AIUpdateRespons
 			"trashed": false,
 		}
 		if aiResp.ProjectName != "" {
-			projectIDPtr, _ := resolveProjectID(aiResp.ProjectName, userID.Hex())
+			projectIDPtr, _ := resolveProjectID(ctx, aiResp.ProjectName, userID.Hex())
 			if projectIDPtr != nil {
 				projectID, _ := primitive.ObjectIDFromHex(*projectIDPtr)
 				filter["projectId"] = projectID
 			}
 		}
 		if aiResp.NextActionName != "" {
-			nextActionIDPtr, _ := resolveNextActionID(aiResp.NextActionName, userID.Hex())
+			nextActionIDPtr, _ := resolveNextActionID(ctx, aiResp.NextActionName, userID.Hex())
 			if nextActionIDPtr != nil {
 				nextActionID, _ := primitive.ObjectIDFromHex(*nextActionIDPtr)
 				filter["nextActionId"] = nextActionID
 			}
 		}
-		matches, err := findRelevantTasks(ctx, filter, aiResp.Title, 50)
+		matches, err := findRelevantTaskMatches(ctx, filter, aiResp.Title, 50)
 		if err != nil || len(matches) == 0 {
 			return &AIUpdateResponse{Message: "Task not found."}, nil
 		}
 		if len(matches) > 1 {
-			titles := []string{}
-			for _, t := range matches {
-				titles = append(titles, t.Title)
+			clarification, err := createPendingIntent(ctx, userID, "updateTask", req.Prompt, &aiResp, matches)
+			if err != nil {
+				return &AIUpdateResponse{Message: "Task not found."}, nil
 			}
 			return &AIUpdateResponse{
-				Message: fmt.Sprintf("Multiple tasks found: %s. Please specify.", strings.Join(titles, "; ")),
+				Message:       fmt.Sprintf("Multiple tasks found: %s. Please specify.", strings.Join(matchTitles(matches), "; ")),
+				Clarification: clarification,
 			}, nil
 		}
-		task := matches[0]
-		updateReq := &CreateTaskRequest{
-			Authorization: req.Authorization,
-		}
-		// Only set fields that are in fieldsToUpdate
-		for _, field := range aiResp.FieldsToUpdate {
-			switch field {
-			case "title":
-				updateReq.Title = aiResp.NewTitle
-			case "dueDate":
-				if aiResp.DueDate != "" {
-					updateReq.DueDate = &aiResp.DueDate
-				}
-			case "description":
-				updateReq.Description = aiResp.Description
-			case "priority":
-				updateReq.Priority = aiResp.Priority
-			case "projectName":
-				if aiResp.ProjectName != "" {
-					projectIDPtr, _ := resolveProjectID(aiResp.ProjectName, userID.Hex())
-					updateReq.ProjectID = projectIDPtr
-				}
-			case "nextActionName":
-				if aiResp.NextActionName != "" {
-					nextActionIDPtr, _ := resolveNextActionID(aiResp.NextActionName, userID.Hex())
-					updateReq.NextActionID = nextActionIDPtr
-				}
-			}
-		}
-		updated, err := UpdateTask(ctx, task.ID.Hex(), updateReq)
-		if err != nil {
-			return &AIUpdateResponse{Message: "Failed to update task."}, nil
-		}
-		return &AIUpdateResponse{
-			Message: fmt.Sprintf("Task \"%s\" updated.", updated.Task.Title),
-			Task:    &updated.Task,
-		}, nil
+		return applyTaskUpdate(ctx, req.Authorization, userID, matches[0].Task, aiResp), nil
 
 	case "project":
 		// Find project by title
-		projectIDPtr, _ := resolveProjectID(aiResp.Title, userID.Hex())
+		projectIDPtr, _ := resolveProjectID(ctx, aiResp.Title, userID.Hex())
 		if projectIDPtr == nil {
 			return &AIUpdateResponse{Message: "Project not found."}, nil
 		}
@@ -1226,7 +1425,7 @@ func AIUpdateEntity(ctx context.Context, req *AIUpdateRequest) (*AIUpdateRespons
 
 	case "nextAction":
 		// Find next action by title
-		nextActionIDPtr, _ := resolveNextActionID(aiResp.Title, userID.Hex())
+		nextActionIDPtr, _ := resolveNextActionID(ctx, aiResp.Title, userID.Hex())
 		if nextActionIDPtr == nil {
 			return &AIUpdateResponse{Message: "Next action/context not found."}, nil
 		}
@@ -1253,16 +1452,58 @@ func AIUpdateEntity(ctx context.Context, req *AIUpdateRequest) (*AIUpdateRespons
 	}
 }
 
+// applyTaskUpdate applies the fields listed in upd.FieldsToUpdate to an already matched task.
+func applyTaskUpdate(ctx context.Context, authorization string, userID primitive.ObjectID, task Task, upd aiEntityUpdate) *AIUpdateResponse {
+	updateReq := &CreateTaskRequest{
+		Authorization: authorization,
+	}
+	// Only set fields that are in fieldsToUpdate
+	for _, field := range upd.FieldsToUpdate {
+		switch field {
+		case "title":
+			updateReq.Title = upd.NewTitle
+		case "dueDate":
+			if upd.DueDate != "" {
+				updateReq.DueDate = &upd.DueDate
+			}
+		case "description":
+			updateReq.Description = upd.Description
+		case "priority":
+			updateReq.Priority = upd.Priority
+		case "projectName":
+			if upd.ProjectName != "" {
+				projectIDPtr, _ := resolveProjectID(ctx, upd.ProjectName, userID.Hex())
+				updateReq.ProjectID = projectIDPtr
+			}
+		case "nextActionName":
+			if upd.NextActionName != "" {
+				nextActionIDPtr, _ := resolveNextActionID(ctx, upd.NextActionName, userID.Hex())
+				updateReq.NextActionID = nextActionIDPtr
+			}
+		}
+	}
+	updated, err := UpdateTask(ctx, task.ID.Hex(), updateReq)
+	if err != nil {
+		return &AIUpdateResponse{Message: "Failed to update task."}
+	}
+	return &AIUpdateResponse{
+		Message: fmt.Sprintf("Task \"%s\" updated.", updated.Task.Title),
+		Task:    &updated.Task,
+	}
+}
+
 // AI list endpoint (for tasks, projects, next actions)
 type AIListRequest struct {
 	Prompt        string `json:"prompt"`
 	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
 }
 type AIListResponse struct {
 	Message     string       `json:"message"`
 	Tasks       []Task       `json:"tasks,omitempty"`
 	Projects    []Project    `json:"projects,omitempty"`
 	NextActions []NextAction `json:"nextActions,omitempty"`
+	Perspective *Perspective `json:"perspective,omitempty"`
 }
 
 // encore:api public method=POST path=/api/ai/list
@@ -1271,8 +1512,20 @@ func AIListEntities(ctx context.Context, req *AIListRequest) (*AIListResponse, e
 	if err != nil {
 		return nil, errors.New("unauthorized")
 	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	ctx, finish := beginAIAction(ctx, userID, "list", req.Prompt)
+	defer finish()
 
-	resp, err := callGroqChat(&userID, req.Prompt, SystemPromptListEntities)
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	db := client.Database("gtd")
+	input := req.Prompt
+	if names := listUserNames(ctx, db.Collection("perspectives"), userID, "name"); len(names) > 0 {
+		input += "\n\nSaved perspectives: " + strings.Join(names, ", ")
+	}
+	resp, err := callGroqChat(ctx, &userID, input, getPrompt(ctx, promptListEntities, userID))
 	if err != nil {
 		return nil, err
 	}
@@ -1285,18 +1538,32 @@ func AIListEntities(ctx context.Context, req *AIListRequest) (*AIListResponse, e
 	}
 
 	switch aiResp.EntityType {
+	case "perspective":
+		perspective := findPerspectiveByName(ctx, db, userID, aiResp.Query)
+		if perspective == nil {
+			return &AIListResponse{Message: fmt.Sprintf("No saved perspective named \"%s\".", aiResp.Query)}, nil
+		}
+		tasks, message, err := perspectiveTasks(ctx, db, *perspective, 100)
+		if err != nil {
+			return &AIListResponse{Message: "Error listing tasks."}, nil
+		}
+		if message == "" {
+			message = fmt.Sprintf("Found %d tasks in \"%s\".", len(tasks), perspective.Name)
+		}
+		return &AIListResponse{Message: message, Tasks: tasks, Perspective: perspective}, nil
+
 	case "task":
-		filter := bson.M{"userId": userID, "trashed": false}
+		filter := bson.M{"userId": userID, "trashed": false, "deferUntil": notDeferred(time.Now())}
 		// Try to resolve project or nextAction if query matches
 		if aiResp.Query != "" {
 			// Try project
-			projectIDPtr, _ := resolveProjectID(aiResp.Query, userID.Hex())
+			projectIDPtr, _ := resolveProjectID(ctx, aiResp.Query, userID.Hex())
 			if projectIDPtr != nil {
 				projectID, _ := primitive.ObjectIDFromHex(*projectIDPtr)
 				filter["projectId"] = projectID
 			} else {
 				// Try nextAction
-				nextActionIDPtr, _ := resolveNextActionID(aiResp.Query, userID.Hex())
+				nextActionIDPtr, _ := resolveNextActionID(ctx, aiResp.Query, userID.Hex())
 				if nextActionIDPtr != nil {
 					nextActionID, _ := primitive.ObjectIDFromHex(*nextActionIDPtr)
 					filter["nextActionId"] = nextActionID
@@ -1518,41 +1785,58 @@ func AIRestoreEntity(ctx context.Context, req *AIRestoreRequest) (*AIRestoreResp
 
 */
 
+// Collections whose documents have embeddings, by entity type.
+var embeddedCollections = map[string]string{"tasks": "task", "projects": "project"}
+
 func fuzzyFindOneByTitle(ctx context.Context, colName string, userID primitive.ObjectID, title string, threshold int) (*primitive.ObjectID, error) {
 	client, err := GetMongoClient()
 	if err != nil {
 		return nil, errors.New("database connection failed")
 	}
 	col := client.Database("gtd").Collection(colName)
-	filter := bson.M{"userId": userID}
+	filter := narrowFuzzyFilter(ctx, colName, userID, title, bson.M{"userId": userID})
 	cursor, err := col.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
-	var bestID *primitive.ObjectID
-	bestScore := threshold
+	type candidate struct {
+		ID   primitive.ObjectID
+		Name string
+	}
+	var candidates []candidate
+	var items []embeddable
 	for cursor.Next(ctx) {
 		var doc struct {
 			ID          primitive.ObjectID `bson:"_id"`
 			Title       string             `bson:"title,omitempty"`
 			Name        string             `bson:"name,omitempty"`
 			ContextName string             `bson:"context_name,omitempty"`
+			Description string             `bson:"description,omitempty"`
 		}
 		if err := cursor.Decode(&doc); err != nil {
 			continue
 		}
-		var candidate string
+		c := candidate{ID: doc.ID}
 		if doc.Title != "" {
-			candidate = doc.Title
+			c.Name = doc.Title
 		} else if doc.Name != "" {
-			candidate = doc.Name
+			c.Name = doc.Name
 		} else if doc.ContextName != "" {
-			candidate = doc.ContextName
+			c.Name = doc.ContextName
+		}
+		candidates = append(candidates, c)
+		if entityType, ok := embeddedCollections[colName]; ok {
+			items = append(items, embeddable{Type: entityType, ID: doc.ID, Text: embeddingText(c.Name, doc.Description)})
 		}
-		score := fuzzy.Ratio(strings.ToLower(title), strings.ToLower(candidate))
+	}
+	similarity, _ := semanticScores(ctx, userID, title, items)
+	var bestID *primitive.ObjectID
+	bestScore := threshold
+	for _, c := range candidates {
+		score := hybridScore(fuzzy.Ratio(strings.ToLower(title), strings.ToLower(c.Name)), similarity[c.ID])
 		if score > bestScore {
-			id := doc.ID
+			id := c.ID
 			bestID = &id
 			bestScore = score
 		}
@@ -0,0 +1,461 @@
+package encoreapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Every mutation made through the /api/ai/* endpoints is recorded as an AIAction
+// with before/after snapshots, so the user can undo what the assistant did.
+
+type aiActionRecorderKey struct{}
+
+type aiActionRecorder struct {
+	mu     sync.Mutex
+	action AIAction
+}
+
+// beginAIAction attaches an action recorder to ctx. Nested AI endpoints (e.g. AIAssistant
+// calling AICreateTask) share the outermost recorder, and only its owner persists it.
+func beginAIAction(ctx context.Context, userID primitive.ObjectID, intent string, prompt string) (context.Context, func()) {
+	if rec := actionRecorderFrom(ctx); rec != nil {
+		rec.mu.Lock()
+		if rec.action.Intent == "" {
+			rec.action.Intent = intent
+		}
+		rec.mu.Unlock()
+		return ctx, func() {}
+	}
+	rec := &aiActionRecorder{action: AIAction{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Intent:    intent,
+		Prompt:    prompt,
+		Changes:   []AIActionChange{},
+		CreatedAt: time.Now(),
+	}}
+	return context.WithValue(ctx, aiActionRecorderKey{}, rec), rec.save
+}
+
+func actionRecorderFrom(ctx context.Context) *aiActionRecorder {
+	rec, _ := ctx.Value(aiActionRecorderKey{}).(*aiActionRecorder)
+	return rec
+}
+
+// save persists the action if anything was changed.
+func (rec *aiActionRecorder) save() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.action.Changes) == 0 {
+		return
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = client.Database("gtd").Collection("ai_actions").InsertOne(ctx, rec.action)
+	if err != nil {
+		LogEvent("ai_action_save_error", rec.action.UserID.Hex(), map[string]interface{}{
+			"intent": rec.action.Intent,
+			"error":  err.Error(),
+		})
+	}
+}
+
+// snapshotForAction returns the current document when ctx is recording an AI action, nil otherwise.
+func snapshotForAction(ctx context.Context, col *mongo.Collection, id primitive.ObjectID) bson.M {
+	if actionRecorderFrom(ctx) == nil {
+		return nil
+	}
+	var doc bson.M
+	if err := col.FindOne(ctx, bson.M{"_id": id}).Decode(&doc); err != nil {
+		return nil
+	}
+	return doc
+}
+
+// recordActionCreate records a document inserted by the current AI action.
+func recordActionCreate(ctx context.Context, col *mongo.Collection, id primitive.ObjectID) {
+	recordActionChange(ctx, col, id, "create", nil)
+}
+
+// recordActionUpdate records a document changed by the current AI action.
+// before must come from snapshotForAction; a nil snapshot means nothing is recorded.
+func recordActionUpdate(ctx context.Context, col *mongo.Collection, id primitive.ObjectID, before bson.M) {
+	if before == nil {
+		return
+	}
+	recordActionChange(ctx, col, id, "update", before)
+}
+
+func recordActionChange(ctx context.Context, col *mongo.Collection, id primitive.ObjectID, op string, before bson.M) {
+	rec := actionRecorderFrom(ctx)
+	if rec == nil {
+		return
+	}
+	var after bson.M
+	if err := col.FindOne(ctx, bson.M{"_id": id}).Decode(&after); err != nil {
+		LogEvent("ai_action_record_error", rec.action.UserID.Hex(), map[string]interface{}{
+			"collection": col.Name(),
+			"entityId":   id.Hex(),
+			"error":      err.Error(),
+		})
+		return
+	}
+	// Never record documents the acting user doesn't own
+	if owner, ok := after["userId"].(primitive.ObjectID); !ok || owner != rec.action.UserID {
+		return
+	}
+	rec.mu.Lock()
+	rec.action.Changes = append(rec.action.Changes, AIActionChange{
+		Collection: col.Name(),
+		EntityID:   id,
+		Op:         op,
+		Before:     before,
+		After:      after,
+	})
+	rec.mu.Unlock()
+}
+
+// Request/response types for the action log
+
+type AIActionsRequest struct {
+	Authorization string `header:"Authorization"`
+}
+
+type AIActionsResponse struct {
+	Actions []AIAction `json:"actions"`
+}
+
+type AIRevertResponse struct {
+	Message string    `json:"message"`
+	Action  *AIAction `json:"action,omitempty"`
+}
+
+// encore:api public method=GET path=/api/ai/actions
+func AIListActions(ctx context.Context, req *AIActionsRequest) (*AIActionsResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("ai_actions")
+	opts := options.Find().SetSort(bson.M{"createdAt": -1}).SetLimit(50)
+	cur, err := col.Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	actions := []AIAction{}
+	for cur.Next(ctx) {
+		var a AIAction
+		if err := cur.Decode(&a); err == nil {
+			actions = append(actions, a)
+		}
+	}
+	return &AIActionsResponse{Actions: actions}, nil
+}
+
+// AIUndo reverts the most recent assistant action that has not been reverted yet.
+// encore:api public method=POST path=/api/ai/undo
+func AIUndo(ctx context.Context, req *AIActionsRequest) (*AIRevertResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("ai_actions")
+	var action AIAction
+	opts := options.FindOne().SetSort(bson.M{"createdAt": -1})
+	err = col.FindOne(ctx, bson.M{"userId": userID, "reverted": false}, opts).Decode(&action)
+	if err != nil {
+		return &AIRevertResponse{Message: "Nothing to undo."}, nil
+	}
+	return revertAIAction(ctx, &action)
+}
+
+// encore:api public method=POST path=/api/ai/actions/:id/revert
+func AIRevertAction(ctx context.Context, id string, req *AIActionsRequest) (*AIRevertResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid action id")
+	}
+	col := client.Database("gtd").Collection("ai_actions")
+	var action AIAction
+	err = col.FindOne(ctx, bson.M{"_id": objID, "userId": userID}).Decode(&action)
+	if err != nil {
+		return nil, errors.New("action not found")
+	}
+	if action.Reverted {
+		return &AIRevertResponse{Message: "This action has already been reverted.", Action: &action}, nil
+	}
+	return revertAIAction(ctx, &action)
+}
+
+// actionStore is the storage an action is reverted in; mongoActionStore in production,
+// an in-memory store in tests.
+type actionStore interface {
+	// FindOne returns mongo.ErrNoDocuments when nothing matches.
+	FindOne(ctx context.Context, collection string, filter bson.M) (bson.M, error)
+	UpdateOne(ctx context.Context, collection string, filter, update bson.M) (matched int64, err error)
+	DeleteOne(ctx context.Context, collection string, filter bson.M) error
+	CountDocuments(ctx context.Context, collection string, filter bson.M) (int64, error)
+}
+
+type mongoActionStore struct {
+	db *mongo.Database
+}
+
+func (s mongoActionStore) FindOne(ctx context.Context, collection string, filter bson.M) (bson.M, error) {
+	var doc bson.M
+	err := s.db.Collection(collection).FindOne(ctx, filter).Decode(&doc)
+	return doc, err
+}
+
+func (s mongoActionStore) UpdateOne(ctx context.Context, collection string, filter, update bson.M) (int64, error) {
+	res, err := s.db.Collection(collection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.MatchedCount, nil
+}
+
+func (s mongoActionStore) DeleteOne(ctx context.Context, collection string, filter bson.M) error {
+	_, err := s.db.Collection(collection).DeleteOne(ctx, filter)
+	return err
+}
+
+func (s mongoActionStore) CountDocuments(ctx context.Context, collection string, filter bson.M) (int64, error) {
+	return s.db.Collection(collection).CountDocuments(ctx, filter)
+}
+
+// revertAIAction undoes the changes of an action in reverse order. It refuses to revert
+// if any entity was modified after the action, so later user edits are never lost.
+func revertAIAction(ctx context.Context, action *AIAction) (*AIRevertResponse, error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	return revertActionIn(ctx, mongoActionStore{db: client.Database("gtd")}, action)
+}
+
+func revertActionIn(ctx context.Context, store actionStore, action *AIAction) (*AIRevertResponse, error) {
+	// Check for conflicts against the latest recorded state of each entity
+	seen := map[primitive.ObjectID]bool{}
+	for i := len(action.Changes) - 1; i >= 0; i-- {
+		change := action.Changes[i]
+		if seen[change.EntityID] {
+			continue
+		}
+		seen[change.EntityID] = true
+		current, err := store.FindOne(ctx, change.Collection, bson.M{"_id": change.EntityID})
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return nil, errors.New("failed to load entity for revert")
+		}
+		if current["updatedAt"] != change.After["updatedAt"] {
+			return &AIRevertResponse{
+				Message: fmt.Sprintf("Cannot revert: %s was changed after this action.", describeActionEntity(change.Collection, current)),
+				Action:  action,
+			}, nil
+		}
+	}
+
+	// Claim the action so concurrent reverts don't apply it twice
+	now := time.Now()
+	matched, err := store.UpdateOne(ctx, "ai_actions",
+		bson.M{"_id": action.ID, "reverted": false},
+		bson.M{"$set": bson.M{"reverted": true, "revertedAt": now}},
+	)
+	if err != nil {
+		return nil, errors.New("failed to revert action")
+	}
+	if matched == 0 {
+		return &AIRevertResponse{Message: "This action has already been reverted.", Action: action}, nil
+	}
+	defer func() {
+		for colName := range fuzzyTextFields {
+			invalidateFuzzyIndex(colName, action.UserID) // restored titles and names
+		}
+	}()
+
+	kept := 0
+	for i := len(action.Changes) - 1; i >= 0; i-- {
+		change := action.Changes[i]
+		current, err := store.FindOne(ctx, change.Collection, bson.M{"_id": change.EntityID})
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		var inUse bool
+		if err == nil {
+			inUse, err = revertChange(ctx, store, change, current, now)
+		}
+		if err != nil {
+			// Release the claim: a partly restored action isn't reverted
+			store.UpdateOne(ctx, "ai_actions", bson.M{"_id": action.ID}, bson.M{"$set": bson.M{"reverted": false}, "$unset": bson.M{"revertedAt": ""}})
+			LogEvent("ai_action_revert_failed", action.UserID.Hex(), map[string]interface{}{
+				"actionId": action.ID.Hex(),
+				"restored": len(action.Changes) - 1 - i,
+				"error":    err.Error(),
+			})
+			return nil, fmt.Errorf("failed to revert action after %d of %d change(s)", len(action.Changes)-1-i, len(action.Changes))
+		}
+		if inUse {
+			kept++
+		}
+	}
+	action.Reverted = true
+	action.RevertedAt = &now
+
+	LogEvent("ai_action_reverted", action.UserID.Hex(), map[string]interface{}{
+		"actionId": action.ID.Hex(),
+		"intent":   action.Intent,
+		"changes":  len(action.Changes),
+	})
+
+	msg := fmt.Sprintf("Reverted %d change(s) from \"%s\".", len(action.Changes), action.Prompt)
+	if kept > 0 {
+		msg += fmt.Sprintf(" %d project(s)/context(s) were kept because they are still in use.", kept)
+	}
+	return &AIRevertResponse{Message: msg, Action: action}, nil
+}
+
+// revertChange undoes one change, given the entity's current state. inUse reports a
+// side-created project/context that was kept because tasks still use it.
+func revertChange(ctx context.Context, store actionStore, change AIActionChange, current bson.M, now time.Time) (inUse bool, err error) {
+	switch {
+	case change.Collection == "tasks" && change.Op == "create":
+		if trashed, _ := current["trashed"].(bool); trashed {
+			return false, nil
+		}
+		if _, err := store.UpdateOne(ctx, "tasks", bson.M{"_id": change.EntityID}, bson.M{"$set": bson.M{"trashed": true, "updatedAt": now}}); err != nil {
+			return false, err
+		}
+		projectID, nextActionID := countedTaskLinks(current)
+		adjustTaskCountsIn(ctx, store, projectID, nil, nextActionID, nil)
+		return false, nil
+
+	case change.Collection == "tasks":
+		if err := restoreDocument(ctx, store, change.Collection, change.EntityID, change.Before, current, now); err != nil {
+			return false, err
+		}
+		// Covers moves as well as trashing: an untrashed task counts again
+		currentProjectID, currentNextActionID := countedTaskLinks(current)
+		beforeProjectID, beforeNextActionID := countedTaskLinks(change.Before)
+		adjustTaskCountsIn(ctx, store, currentProjectID, beforeProjectID, currentNextActionID, beforeNextActionID)
+		return false, nil
+
+	case change.Op == "create":
+		// Side-created projects/contexts are only removed if no live tasks still use them
+		field := "projectId"
+		if change.Collection == "nextactions" {
+			field = "nextActionId"
+		}
+		n, err := store.CountDocuments(ctx, "tasks", bson.M{field: change.EntityID, "trashed": false})
+		if err != nil || n > 0 {
+			return n > 0, err
+		}
+		return false, store.DeleteOne(ctx, change.Collection, bson.M{"_id": change.EntityID})
+
+	default:
+		return false, restoreDocument(ctx, store, change.Collection, change.EntityID, change.Before, current, now)
+	}
+}
+
+// restoreDocument writes the before snapshot back, leaving task_count to the task-level reverts.
+func restoreDocument(ctx context.Context, store actionStore, collection string, id primitive.ObjectID, before bson.M, current bson.M, now time.Time) error {
+	set := bson.M{}
+	for k, v := range before {
+		if k == "_id" || k == "task_count" {
+			continue
+		}
+		set[k] = v
+	}
+	set["updatedAt"] = now
+	update := bson.M{"$set": set}
+	unset := bson.M{}
+	for k := range current {
+		if _, ok := before[k]; !ok && k != "_id" && k != "task_count" && k != "updatedAt" {
+			unset[k] = ""
+		}
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	_, err := store.UpdateOne(ctx, collection, bson.M{"_id": id}, update)
+	return err
+}
+
+// countedTaskLinks returns the project and context whose task_count includes the task
+// document. task_count covers every task that isn't trashed, completed or not, so
+// completing a task or undoing that leaves the counts alone.
+func countedTaskLinks(doc bson.M) (projectID, nextActionID *primitive.ObjectID) {
+	if trashed, _ := doc["trashed"].(bool); trashed {
+		return nil, nil
+	}
+	return objectIDField(doc, "projectId"), objectIDField(doc, "nextActionId")
+}
+
+// adjustTaskCounts moves a task's contribution to task_count from the old project/context to the new one.
+func adjustTaskCounts(ctx context.Context, db *mongo.Database, oldProjectID, newProjectID, oldNextActionID, newNextActionID *primitive.ObjectID) {
+	adjustTaskCountsIn(ctx, mongoActionStore{db: db}, oldProjectID, newProjectID, oldNextActionID, newNextActionID)
+}
+
+func adjustTaskCountsIn(ctx context.Context, store actionStore, oldProjectID, newProjectID, oldNextActionID, newNextActionID *primitive.ObjectID) {
+	if oldProjectID != nil && (newProjectID == nil || *oldProjectID != *newProjectID) {
+		store.UpdateOne(ctx, "projects", bson.M{"_id": *oldProjectID}, bson.M{"$inc": bson.M{"task_count": -1}})
+	}
+	if newProjectID != nil && (oldProjectID == nil || *oldProjectID != *newProjectID) {
+		store.UpdateOne(ctx, "projects", bson.M{"_id": *newProjectID}, bson.M{"$inc": bson.M{"task_count": 1}})
+	}
+	if oldNextActionID != nil && (newNextActionID == nil || *oldNextActionID != *newNextActionID) {
+		store.UpdateOne(ctx, "nextactions", bson.M{"_id": *oldNextActionID}, bson.M{"$inc": bson.M{"task_count": -1}})
+	}
+	if newNextActionID != nil && (oldNextActionID == nil || *oldNextActionID != *newNextActionID) {
+		store.UpdateOne(ctx, "nextactions", bson.M{"_id": *newNextActionID}, bson.M{"$inc": bson.M{"task_count": 1}})
+	}
+}
+
+func objectIDField(doc bson.M, key string) *primitive.ObjectID {
+	if id, ok := doc[key].(primitive.ObjectID); ok {
+		return &id
+	}
+	return nil
+}
+
+func describeActionEntity(collection string, doc bson.M) string {
+	switch collection {
+	case "tasks":
+		return fmt.Sprintf("task \"%v\"", doc["title"])
+	case "projects":
+		return fmt.Sprintf("project \"%v\"", doc["name"])
+	default:
+		return fmt.Sprintf("next action/context \"%v\"", doc["context_name"])
+	}
+}
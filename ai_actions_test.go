@@ -0,0 +1,345 @@
+package encoreapp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memActionStore is an in-memory actionStore. Filters are evaluated with matchesFilter;
+// updates support $set, $unset and $inc.
+type memActionStore struct {
+	t         *testing.T
+	docs      map[string][]bson.M
+	failWrite string // collection whose writes fail
+}
+
+func (s *memActionStore) find(collection string, filter bson.M) bson.M {
+	for _, doc := range s.docs[collection] {
+		if matchesFilter(s.t, filter, doc) {
+			return doc
+		}
+	}
+	return nil
+}
+
+func (s *memActionStore) FindOne(ctx context.Context, collection string, filter bson.M) (bson.M, error) {
+	doc := s.find(collection, filter)
+	if doc == nil {
+		return nil, mongo.ErrNoDocuments
+	}
+	out := bson.M{}
+	for k, v := range doc {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (s *memActionStore) UpdateOne(ctx context.Context, collection string, filter, update bson.M) (int64, error) {
+	if collection == s.failWrite {
+		return 0, errors.New("write failed")
+	}
+	doc := s.find(collection, filter)
+	if doc == nil {
+		return 0, nil
+	}
+	for op, fields := range update {
+		for k, v := range fields.(bson.M) {
+			switch op {
+			case "$set":
+				doc[k] = v
+			case "$unset":
+				delete(doc, k)
+			case "$inc":
+				n, _ := doc[k].(int)
+				doc[k] = n + v.(int)
+			default:
+				s.t.Fatalf("memActionStore: unsupported update %s", op)
+			}
+		}
+	}
+	return 1, nil
+}
+
+func (s *memActionStore) DeleteOne(ctx context.Context, collection string, filter bson.M) error {
+	if collection == s.failWrite {
+		return errors.New("write failed")
+	}
+	for i, doc := range s.docs[collection] {
+		if matchesFilter(s.t, filter, doc) {
+			s.docs[collection] = append(s.docs[collection][:i], s.docs[collection][i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memActionStore) CountDocuments(ctx context.Context, collection string, filter bson.M) (int64, error) {
+	var n int64
+	for _, doc := range s.docs[collection] {
+		if matchesFilter(s.t, filter, doc) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestRevertRestoresTaskCounts(t *testing.T) {
+	actionAt := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name   string
+		set    bson.M // what the bulk operation changed
+		counts int    // task_count of the project and context after the operation
+	}{
+		{"trash", bson.M{"trashed": true}, 0},
+		{"complete", bson.M{"completed": true}, 2},
+	}
+	for _, c := range cases {
+		projectID, nextActionID := primitive.NewObjectID(), primitive.NewObjectID()
+		store := &memActionStore{t: t, docs: map[string][]bson.M{
+			"projects":    {{"_id": projectID, "task_count": c.counts}},
+			"nextactions": {{"_id": nextActionID, "task_count": c.counts}},
+		}}
+		action := &AIAction{ID: primitive.NewObjectID(), Intent: "bulkUpdate"}
+		for i := 0; i < 2; i++ {
+			before := bson.M{"_id": primitive.NewObjectID(), "projectId": projectID, "nextActionId": nextActionID,
+				"trashed": false, "completed": false, "updatedAt": actionAt.Add(-time.Hour)}
+			after := bson.M{}
+			for k, v := range before {
+				after[k] = v
+			}
+			for k, v := range c.set {
+				after[k] = v
+			}
+			after["updatedAt"] = actionAt
+			store.docs["tasks"] = append(store.docs["tasks"], after)
+			action.Changes = append(action.Changes, AIActionChange{Collection: "tasks", EntityID: before["_id"].(primitive.ObjectID), Op: "update", Before: before, After: after})
+		}
+		store.docs["ai_actions"] = []bson.M{{"_id": action.ID, "reverted": false}}
+
+		if _, err := revertActionIn(context.Background(), store, action); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		for _, col := range []string{"projects", "nextactions"} {
+			if n := store.docs[col][0]["task_count"]; n != 2 {
+				t.Errorf("%s: %s task_count = %v after revert, want 2", c.name, col, n)
+			}
+		}
+		for _, task := range store.docs["tasks"] {
+			if task["trashed"] != false || task["completed"] != false {
+				t.Errorf("%s: task not restored: %v", c.name, task)
+			}
+		}
+	}
+}
+
+func TestRevertChange(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	taskID, p1, p2, ctxID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	cases := []struct {
+		name      string
+		change    AIActionChange
+		docs      map[string][]bson.M
+		wantInUse bool
+		check     func(t *testing.T, s *memActionStore)
+	}{
+		{
+			name:   "created task is trashed",
+			change: AIActionChange{Collection: "tasks", EntityID: taskID, Op: "create"},
+			docs: map[string][]bson.M{
+				"tasks":       {{"_id": taskID, "projectId": p1, "nextActionId": ctxID, "trashed": false}},
+				"projects":    {{"_id": p1, "task_count": 1}},
+				"nextactions": {{"_id": ctxID, "task_count": 1}},
+			},
+			check: func(t *testing.T, s *memActionStore) {
+				wantField(t, s, "tasks", taskID, "trashed", true)
+				wantField(t, s, "tasks", taskID, "updatedAt", now)
+				wantField(t, s, "projects", p1, "task_count", 0)
+				wantField(t, s, "nextactions", ctxID, "task_count", 0)
+			},
+		},
+		{
+			name:   "created task already trashed",
+			change: AIActionChange{Collection: "tasks", EntityID: taskID, Op: "create"},
+			docs: map[string][]bson.M{
+				"tasks":    {{"_id": taskID, "projectId": p1, "trashed": true}},
+				"projects": {{"_id": p1, "task_count": 0}},
+			},
+			check: func(t *testing.T, s *memActionStore) {
+				wantField(t, s, "tasks", taskID, "updatedAt", nil)
+				wantField(t, s, "projects", p1, "task_count", 0)
+			},
+		},
+		{
+			name: "moved task is restored",
+			change: AIActionChange{Collection: "tasks", EntityID: taskID, Op: "update",
+				Before: bson.M{"_id": taskID, "title": "Call Ann", "projectId": p1, "trashed": false}},
+			docs: map[string][]bson.M{
+				"tasks":    {{"_id": taskID, "title": "Call Anna", "projectId": p2, "notes": "added", "trashed": false}},
+				"projects": {{"_id": p1, "task_count": 0}, {"_id": p2, "task_count": 1}},
+			},
+			check: func(t *testing.T, s *memActionStore) {
+				wantField(t, s, "tasks", taskID, "title", "Call Ann")
+				wantField(t, s, "tasks", taskID, "projectId", p1)
+				wantField(t, s, "tasks", taskID, "notes", nil)
+				wantField(t, s, "tasks", taskID, "updatedAt", now)
+				wantField(t, s, "projects", p1, "task_count", 1)
+				wantField(t, s, "projects", p2, "task_count", 0)
+			},
+		},
+		{
+			name: "trashed task is untrashed",
+			change: AIActionChange{Collection: "tasks", EntityID: taskID, Op: "update",
+				Before: bson.M{"_id": taskID, "projectId": p1, "trashed": false}},
+			docs: map[string][]bson.M{
+				"tasks":    {{"_id": taskID, "projectId": p1, "trashed": true}},
+				"projects": {{"_id": p1, "task_count": 0}},
+			},
+			check: func(t *testing.T, s *memActionStore) {
+				wantField(t, s, "tasks", taskID, "trashed", false)
+				wantField(t, s, "projects", p1, "task_count", 1)
+			},
+		},
+		{
+			name: "updated project keeps its task count",
+			change: AIActionChange{Collection: "projects", EntityID: p1, Op: "update",
+				Before: bson.M{"_id": p1, "name": "Garden", "task_count": 3}},
+			docs: map[string][]bson.M{
+				"projects": {{"_id": p1, "name": "Gardening", "task_count": 5}},
+			},
+			check: func(t *testing.T, s *memActionStore) {
+				wantField(t, s, "projects", p1, "name", "Garden")
+				wantField(t, s, "projects", p1, "task_count", 5)
+			},
+		},
+		{
+			name:   "unused created project is deleted",
+			change: AIActionChange{Collection: "projects", EntityID: p1, Op: "create"},
+			docs: map[string][]bson.M{
+				"projects": {{"_id": p1, "name": "Garden"}},
+				"tasks":    {{"_id": taskID, "projectId": p1, "trashed": true}},
+			},
+			check: func(t *testing.T, s *memActionStore) {
+				if s.find("projects", bson.M{"_id": p1}) != nil {
+					t.Error("project was not deleted")
+				}
+			},
+		},
+		{
+			name:   "created context still in use is kept",
+			change: AIActionChange{Collection: "nextactions", EntityID: ctxID, Op: "create"},
+			docs: map[string][]bson.M{
+				"nextactions": {{"_id": ctxID, "context_name": "calls"}},
+				"tasks":       {{"_id": taskID, "nextActionId": ctxID, "trashed": false}},
+			},
+			wantInUse: true,
+			check: func(t *testing.T, s *memActionStore) {
+				if s.find("nextactions", bson.M{"_id": ctxID}) == nil {
+					t.Error("context in use was deleted")
+				}
+			},
+		},
+		{
+			name:   "unused created context is deleted",
+			change: AIActionChange{Collection: "nextactions", EntityID: ctxID, Op: "create"},
+			docs: map[string][]bson.M{
+				"nextactions": {{"_id": ctxID, "context_name": "calls"}},
+			},
+			check: func(t *testing.T, s *memActionStore) {
+				if s.find("nextactions", bson.M{"_id": ctxID}) != nil {
+					t.Error("context was not deleted")
+				}
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			store := &memActionStore{t: t, docs: c.docs}
+			current, err := store.FindOne(context.Background(), c.change.Collection, bson.M{"_id": c.change.EntityID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			inUse, err := revertChange(context.Background(), store, c.change, current, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if inUse != c.wantInUse {
+				t.Errorf("inUse = %v, want %v", inUse, c.wantInUse)
+			}
+			c.check(t, store)
+		})
+	}
+}
+
+func TestRevertActionIn(t *testing.T) {
+	actionAt := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	taskID := primitive.NewObjectID()
+	cases := []struct {
+		name         string
+		taskUpdated  time.Time // updatedAt of the task when reverting
+		reverted     bool      // the action was reverted concurrently
+		failWrite    string
+		wantMessage  string
+		wantErr      bool
+		wantReverted bool
+		wantTitle    string
+	}{
+		{name: "reverted", taskUpdated: actionAt, wantMessage: `Reverted 1 change(s) from "rename".`, wantReverted: true, wantTitle: "Old"},
+		{name: "changed after the action", taskUpdated: actionAt.Add(time.Minute), wantMessage: `Cannot revert: task "New" was changed after this action.`, wantTitle: "New"},
+		{name: "already reverted", taskUpdated: actionAt, reverted: true, wantMessage: "This action has already been reverted.", wantReverted: true, wantTitle: "New"},
+		{name: "write fails", taskUpdated: actionAt, failWrite: "tasks", wantErr: true, wantTitle: "New"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			action := &AIAction{ID: primitive.NewObjectID(), Prompt: "rename", Changes: []AIActionChange{{
+				Collection: "tasks", EntityID: taskID, Op: "update",
+				Before: bson.M{"_id": taskID, "title": "Old", "updatedAt": actionAt.Add(-time.Hour)},
+				After:  bson.M{"_id": taskID, "title": "New", "updatedAt": actionAt},
+			}}}
+			store := &memActionStore{t: t, failWrite: c.failWrite, docs: map[string][]bson.M{
+				"tasks":      {{"_id": taskID, "title": "New", "updatedAt": c.taskUpdated}},
+				"ai_actions": {{"_id": action.ID, "reverted": c.reverted}},
+			}}
+			resp, err := revertActionIn(context.Background(), store, action)
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if resp.Message != c.wantMessage {
+				t.Errorf("message = %q, want %q", resp.Message, c.wantMessage)
+			}
+			wantField(t, store, "ai_actions", action.ID, "reverted", c.wantReverted)
+			if !c.reverted && !c.wantReverted {
+				wantField(t, store, "ai_actions", action.ID, "revertedAt", nil)
+			}
+			wantField(t, store, "tasks", taskID, "title", c.wantTitle)
+		})
+	}
+}
+
+// wantField checks a field of the document with id; a nil want means the field is unset.
+func wantField(t *testing.T, s *memActionStore, collection string, id primitive.ObjectID, field string, want interface{}) {
+	t.Helper()
+	doc := s.find(collection, bson.M{"_id": id})
+	if doc == nil {
+		t.Errorf("%s %s not found", collection, id.Hex())
+		return
+	}
+	got, ok := doc[field]
+	if want == nil {
+		if ok {
+			t.Errorf("%s.%s = %v, want it unset", collection, field, got)
+		}
+		return
+	}
+	if got != want {
+		t.Errorf("%s.%s = %v, want %v", collection, field, got, want)
+	}
+}
@@ -0,0 +1,201 @@
+package encoreapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	fuzzy "github.com/paul-mannino/go-fuzzywuzzy"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Proposed steps whose title scores at least this against an existing task (or an
+// earlier proposal) are treated as duplicates.
+const breakdownDuplicateScore = 80
+
+// AIBreakdownStep is a proposed task for an existing project.
+type AIBreakdownStep struct {
+	Title            string `json:"title"`
+	Description      string `json:"description,omitempty"`
+	Priority         int    `json:"priority,omitempty"`
+	EstimatedMinutes int    `json:"estimatedMinutes,omitempty"`
+}
+
+// AIBreakdownDuplicate is a proposed step dropped because a similar task exists.
+type AIBreakdownDuplicate struct {
+	Title       string `json:"title"`
+	DuplicateOf string `json:"duplicateOf"`
+	Score       int    `json:"score"`
+}
+
+type AIProjectBreakdownRequest struct {
+	Authorization string            `header:"Authorization"`
+	TimeZone      string            `header:"X-Timezone"`
+	Prompt        string            `json:"prompt,omitempty"` // optional guidance, e.g. "focus on the launch"
+	Insert        bool              `json:"insert"`           // create the proposed steps as tasks
+	Steps         []AIBreakdownStep `json:"steps,omitempty"`  // insert these (e.g. edited proposals) instead of asking the model
+}
+
+type AIProjectBreakdownResponse struct {
+	Project    Project                `json:"project"`
+	Steps      []AIBreakdownStep      `json:"steps"`
+	Duplicates []AIBreakdownDuplicate `json:"duplicates,omitempty"`
+	Tasks      []Task                 `json:"tasks,omitempty"` // created tasks when insert is set
+}
+
+// AIProjectBreakdown proposes the missing next steps of an existing project, leaving out
+// steps that duplicate its current tasks. With insert set the steps are created as
+// tasks of the project.
+// encore:api public method=POST path=/api/ai/projects/:id/breakdown
+func AIProjectBreakdown(ctx context.Context, id string, req *AIProjectBreakdownRequest) (*AIProjectBreakdownResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	projectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid project id")
+	}
+
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	db := client.Database("gtd")
+	var project Project
+	if err := db.Collection("projects").FindOne(ctx, bson.M{"_id": projectID, "userId": userID}).Decode(&project); err != nil {
+		return nil, errors.New("project not found")
+	}
+	cur, err := db.Collection("tasks").Find(ctx, bson.M{"userId": userID, "projectId": projectID, "trashed": false})
+	if err != nil {
+		return nil, err
+	}
+	var existing []Task
+	for cur.Next(ctx) {
+		var t Task
+		if err := cur.Decode(&t); err == nil {
+			existing = append(existing, t)
+		}
+	}
+	cur.Close(ctx)
+
+	steps := req.Steps
+	if len(steps) == 0 {
+		steps, err = aiBreakdownSteps(ctx, userID, project, existing, req.Prompt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	steps, duplicates := dedupeBreakdownSteps(steps, existing)
+	resp := &AIProjectBreakdownResponse{Project: project, Steps: steps, Duplicates: duplicates}
+	if !req.Insert || len(steps) == 0 {
+		return resp, nil
+	}
+
+	prompt := req.Prompt
+	if prompt == "" {
+		prompt = "Break down project " + project.Name
+	}
+	ctx, finish := beginAIAction(ctx, userID, "projectBreakdown", prompt)
+	defer finish()
+	for _, s := range steps {
+		// CreateTask keeps the project's task_count in sync
+		taskResp, err := CreateTask(ctx, &CreateTaskRequest{
+			Authorization:    req.Authorization,
+			TimeZone:         req.TimeZone,
+			Title:            s.Title,
+			Description:      s.Description,
+			Priority:         s.Priority,
+			Category:         "projects",
+			ProjectID:        stringPtr(project.ID.Hex()),
+			EstimatedMinutes: &s.EstimatedMinutes,
+		})
+		if err == nil {
+			resp.Tasks = append(resp.Tasks, taskResp.Task)
+		}
+	}
+	if err := db.Collection("projects").FindOne(ctx, bson.M{"_id": projectID}).Decode(&project); err == nil {
+		resp.Project = project
+	}
+	return resp, nil
+}
+
+func aiBreakdownSteps(ctx context.Context, userID primitive.ObjectID, project Project, existing []Task, guidance string) ([]AIBreakdownStep, error) {
+	type taskInput struct {
+		Title     string `json:"title"`
+		Completed bool   `json:"completed"`
+	}
+	input := struct {
+		Name        string      `json:"name"`
+		Description string      `json:"description"`
+		Tasks       []taskInput `json:"tasks"`
+		Guidance    string      `json:"guidance,omitempty"`
+	}{Name: project.Name, Tasks: []taskInput{}, Guidance: guidance}
+	if project.Description != nil {
+		input.Description = *project.Description
+	}
+	for _, t := range existing {
+		input.Tasks = append(input.Tasks, taskInput{Title: t.Title, Completed: t.Completed})
+	}
+	b, _ := json.Marshal(input)
+
+	prompt := getPrompt(ctx, promptBreakdown, userID)
+	resp, err := callGroqChat(ctx, &userID, string(b), prompt)
+	if err != nil {
+		logAIInteraction(&userID, string(b), "", "projectBreakdown", false, err.Error(), prompt.Label())
+		return nil, err
+	}
+	var aiResp struct {
+		Tasks []AIBreakdownStep `json:"tasks"`
+	}
+	if err := json.Unmarshal([]byte(resp), &aiResp); err != nil {
+		logAIInteraction(&userID, string(b), resp, "projectBreakdown", false, err.Error(), prompt.Label())
+		return nil, errors.New("AI response could not be parsed as JSON: " + err.Error())
+	}
+	logAIInteraction(&userID, string(b), resp, "projectBreakdown", true, "", prompt.Label())
+	return aiResp.Tasks, nil
+}
+
+// dedupeBreakdownSteps drops empty steps and steps similar to an existing task or to an
+// earlier step, and normalizes priorities and estimates.
+func dedupeBreakdownSteps(steps []AIBreakdownStep, existing []Task) ([]AIBreakdownStep, []AIBreakdownDuplicate) {
+	titles := make([]string, 0, len(existing)+len(steps))
+	for _, t := range existing {
+		titles = append(titles, t.Title)
+	}
+	kept := []AIBreakdownStep{}
+	var duplicates []AIBreakdownDuplicate
+	for _, s := range steps {
+		s.Title = strings.TrimSpace(s.Title)
+		if s.Title == "" {
+			continue
+		}
+		if match, score := bestTitleMatch(s.Title, titles); score >= breakdownDuplicateScore {
+			duplicates = append(duplicates, AIBreakdownDuplicate{Title: s.Title, DuplicateOf: match, Score: score})
+			continue
+		}
+		if s.Priority < 1 || s.Priority > 5 {
+			s.Priority = 0
+		}
+		if s.EstimatedMinutes < 0 || s.EstimatedMinutes > 24*60 {
+			s.EstimatedMinutes = 0
+		}
+		titles = append(titles, s.Title)
+		kept = append(kept, s)
+	}
+	return kept, duplicates
+}
+
+func bestTitleMatch(title string, candidates []string) (string, int) {
+	best, bestScore := "", 0
+	for _, c := range candidates {
+		score := fuzzy.TokenSortRatio(strings.ToLower(title), strings.ToLower(c))
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	return best, bestScore
+}
@@ -0,0 +1,52 @@
+package encoreapp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDedupeBreakdownSteps(t *testing.T) {
+	existing := []Task{{Title: "Book the venue"}, {Title: "Send invitations"}}
+	cases := []struct {
+		name       string
+		steps      []AIBreakdownStep
+		kept       []AIBreakdownStep
+		duplicates []string // "title=duplicateOf"
+	}{
+		{"keeps new steps",
+			[]AIBreakdownStep{{Title: "Order the cake", Priority: 2, EstimatedMinutes: 15}},
+			[]AIBreakdownStep{{Title: "Order the cake", Priority: 2, EstimatedMinutes: 15}}, nil},
+		{"trims titles and drops empty ones",
+			[]AIBreakdownStep{{Title: "  Order the cake "}, {Title: "   "}, {Title: ""}},
+			[]AIBreakdownStep{{Title: "Order the cake"}}, nil},
+		{"drops steps similar to an existing task",
+			[]AIBreakdownStep{{Title: "book the venue"}, {Title: "Send the invitations"}, {Title: "Order the cake"}},
+			[]AIBreakdownStep{{Title: "Order the cake"}},
+			[]string{"book the venue=Book the venue", "Send the invitations=Send invitations"}},
+		{"drops steps similar to an earlier step",
+			[]AIBreakdownStep{{Title: "Order the cake"}, {Title: "Order cake"}, {Title: "order the cake"}},
+			[]AIBreakdownStep{{Title: "Order the cake"}},
+			[]string{"Order cake=Order the cake", "order the cake=Order the cake"}},
+		{"clears out-of-range priorities and estimates",
+			[]AIBreakdownStep{
+				{Title: "Order the cake", Priority: 6, EstimatedMinutes: -5},
+				{Title: "Hire a photographer", Priority: -1, EstimatedMinutes: 24*60 + 1},
+				{Title: "Buy decorations", Priority: 5, EstimatedMinutes: 24 * 60},
+			},
+			[]AIBreakdownStep{{Title: "Order the cake"}, {Title: "Hire a photographer"}, {Title: "Buy decorations", Priority: 5, EstimatedMinutes: 24 * 60}}, nil},
+		{"no steps", nil, []AIBreakdownStep{}, nil},
+	}
+	for _, c := range cases {
+		kept, duplicates := dedupeBreakdownSteps(c.steps, existing)
+		var dups []string
+		for _, d := range duplicates {
+			if d.Score < breakdownDuplicateScore {
+				t.Errorf("%s: %q reported with score %d", c.name, d.Title, d.Score)
+			}
+			dups = append(dups, d.Title+"="+d.DuplicateOf)
+		}
+		if !reflect.DeepEqual(kept, c.kept) || !reflect.DeepEqual(dups, c.duplicates) {
+			t.Errorf("%s: kept %+v, duplicates %v; want %+v, %v", c.name, kept, dups, c.kept, c.duplicates)
+		}
+	}
+}
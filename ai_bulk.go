@@ -0,0 +1,329 @@
+package encoreapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Upper bound on how many tasks a single natural-language bulk operation may touch.
+const bulkMaxTasks = 500
+
+// aiBulkFilter selects the tasks a bulk prompt refers to.
+type aiBulkFilter struct {
+	ProjectName    string `json:"projectName" bson:"projectName"`
+	NextActionName string `json:"nextActionName" bson:"nextActionName"`
+	Query          string `json:"query" bson:"query"`
+	Due            string `json:"due" bson:"due"`
+	Category       string `json:"category" bson:"category"`
+	Completed      bool   `json:"completed" bson:"completed"`
+}
+
+// aiBulkOperation is the change extracted by SystemPromptBulkOperation.
+type aiBulkOperation struct {
+	Type           string `json:"type" bson:"type"`
+	ProjectName    string `json:"projectName" bson:"projectName"`
+	NextActionName string `json:"nextActionName" bson:"nextActionName"`
+	Priority       int    `json:"priority" bson:"priority"`
+	DueDate        string `json:"dueDate" bson:"dueDate"`
+}
+
+// AI bulk operation endpoints (preview, then confirm)
+type AIBulkRequest struct {
+	Prompt        string `json:"prompt"`
+	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
+}
+
+type AIBulkPreviewResponse struct {
+	Message   string     `json:"message"`
+	Operation string     `json:"operation,omitempty"`
+	Count     int        `json:"count"`
+	Tasks     []Task     `json:"tasks,omitempty"` // first few matching tasks
+	Token     string     `json:"token,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// AIBulkPreview turns a prompt into a filter plus an operation and reports how many tasks
+// it would change. Nothing is modified until the returned token is sent to /api/ai/bulk/confirm.
+// encore:api public method=POST path=/api/ai/bulk
+func AIBulkPreview(ctx context.Context, req *AIBulkRequest) (*AIBulkPreviewResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+
+	clock := clockFromContext(ctx)
+	resp, err := callGroqChat(ctx, &userID, withDateHint(req.Prompt, clock), getPrompt(ctx, promptBulkOperation, userID))
+	if err != nil {
+		return nil, err
+	}
+	var aiResp struct {
+		Filter    aiBulkFilter    `json:"filter"`
+		Operation aiBulkOperation `json:"operation"`
+	}
+	if err := json.Unmarshal([]byte(resp), &aiResp); err != nil {
+		return nil, errors.New("AI response could not be parsed as JSON: " + err.Error())
+	}
+
+	op := aiResp.Operation
+	switch op.Type {
+	case "move":
+		op.ProjectName = strings.TrimSpace(op.ProjectName)
+		op.NextActionName = strings.TrimSpace(op.NextActionName)
+	case "setDueDate":
+		dueDate, corrected := reconcileDueDate(op.DueDate, req.Prompt, clock)
+		if corrected {
+			logDueDateCorrection(userID, op.DueDate, dueDate)
+		}
+		op.DueDate = dueDate
+	}
+	if problem := bulkOperationProblem(op); problem != "" {
+		return &AIBulkPreviewResponse{Message: problem}, nil
+	}
+
+	filter, narrowed, notFound := buildBulkTaskFilter(ctx, userID, aiResp.Filter, clock)
+	if notFound != "" {
+		return &AIBulkPreviewResponse{Message: notFound}, nil
+	}
+	if !narrowed {
+		return &AIBulkPreviewResponse{Message: "Please say which tasks you mean, e.g. by project, context, due date or keyword."}, nil
+	}
+
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	tasksCol := client.Database("gtd").Collection("tasks")
+	opts := options.Find().SetSort(bson.M{"dueDate": 1}).SetLimit(bulkMaxTasks + 1)
+	cursor, err := tasksCol.Find(ctx, filter, opts)
+	if err != nil {
+		return &AIBulkPreviewResponse{Message: "Error searching for tasks."}, nil
+	}
+	defer cursor.Close(ctx)
+	var tasks []Task
+	for cursor.Next(ctx) {
+		var t Task
+		if err := cursor.Decode(&t); err == nil {
+			tasks = append(tasks, t)
+		}
+	}
+	if len(tasks) == 0 {
+		return &AIBulkPreviewResponse{Message: "No tasks match that description."}, nil
+	}
+	if len(tasks) > bulkMaxTasks {
+		return &AIBulkPreviewResponse{
+			Message: fmt.Sprintf("That matches more than %d tasks. Please narrow it down.", bulkMaxTasks),
+			Count:   len(tasks),
+		}, nil
+	}
+
+	pending := AIPendingIntent{
+		UserID:    userID,
+		Operation: "bulk",
+		Prompt:    req.Prompt,
+		Bulk:      &op,
+	}
+	for _, t := range tasks {
+		pending.CandidateIDs = append(pending.CandidateIDs, t.ID)
+	}
+	if err := savePendingIntent(ctx, &pending); err != nil {
+		return nil, err
+	}
+
+	sample := tasks
+	if len(sample) > 10 {
+		sample = sample[:10]
+	}
+	return &AIBulkPreviewResponse{
+		Message:   describeBulkPreview(op, len(tasks)) + " Confirm to apply.",
+		Operation: op.Type,
+		Count:     len(tasks),
+		Tasks:     sample,
+		Token:     pending.Token,
+		ExpiresAt: &pending.ExpiresAt,
+	}, nil
+}
+
+type AIBulkConfirmRequest struct {
+	Authorization string `header:"Authorization"`
+	Token         string `json:"token"`
+}
+
+type AIBulkConfirmResponse struct {
+	Message string `json:"message"`
+	Updated int    `json:"updated"`
+	Tasks   []Task `json:"tasks,omitempty"`
+}
+
+// encore:api public method=POST path=/api/ai/bulk/confirm
+func AIBulkConfirm(ctx context.Context, req *AIBulkConfirmRequest) (*AIBulkConfirmResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	// As in AIClarify, the token is only used up once the operation is known to be valid
+	// and given back when applying it fails, so the confirmation can be retried.
+	pending, err := findPendingIntent(ctx, userID, req.Token, "bulk")
+	if err != nil {
+		return nil, err
+	}
+	if pending.Bulk == nil {
+		return nil, errors.New("pending bulk operation is missing")
+	}
+	if problem := bulkOperationProblem(*pending.Bulk); problem != "" {
+		return nil, errors.New(problem)
+	}
+	if err := consumePendingIntent(ctx, pending); err != nil {
+		return nil, err
+	}
+	ctx, finish := beginAIAction(ctx, userID, "bulkUpdate", pending.Prompt)
+	defer finish()
+
+	op := pending.Bulk
+	bulkOp := BulkTaskOperation{Type: op.Type, Priority: op.Priority}
+	if op.Type == "move" {
+		// Moving may create the target project/context, like the other AI endpoints do
+		bulkOp.ProjectID, _ = resolveProjectID(ctx, op.ProjectName, userID.Hex())
+		bulkOp.NextActionID, _ = resolveNextActionID(ctx, strings.TrimPrefix(op.NextActionName, "@"), userID.Hex())
+	}
+	if op.DueDate != "" {
+		bulkOp.DueDate = &op.DueDate
+	}
+
+	taskIDs := []string{}
+	for _, id := range pending.CandidateIDs {
+		taskIDs = append(taskIDs, id.Hex())
+	}
+	bulkResp, err := BulkUpdateTasks(ctx, &BulkUpdateTasksRequest{
+		Authorization: req.Authorization,
+		TaskIDs:       taskIDs,
+		Operation:     bulkOp,
+	})
+	if err != nil {
+		releasePendingIntent(ctx, pending)
+		return &AIBulkConfirmResponse{Message: "Could not apply the bulk change: " + err.Error()}, nil
+	}
+	return &AIBulkConfirmResponse{
+		Message: fmt.Sprintf("Updated %d task(s).", bulkResp.Updated),
+		Updated: bulkResp.Updated,
+		Tasks:   bulkResp.Tasks,
+	}, nil
+}
+
+// bulkOperationProblem tells the user why op can't be applied, or returns "". The preview
+// checks it too, so a previewed operation doesn't fail on confirmation.
+func bulkOperationProblem(op aiBulkOperation) string {
+	switch op.Type {
+	case "complete", "trash":
+	case "move":
+		if strings.TrimSpace(op.ProjectName) == "" && strings.TrimSpace(strings.TrimPrefix(op.NextActionName, "@")) == "" {
+			return "Please say which project or context to move these tasks to."
+		}
+	case "setPriority":
+		if op.Priority < 1 || op.Priority > 5 {
+			return "Please give a priority between 1 (highest) and 5 (lowest)."
+		}
+	case "setDueDate":
+		if op.DueDate == "" {
+			return "Please say which due date to set."
+		}
+	default:
+		return "Sorry, I couldn't understand what you want to do with these tasks."
+	}
+	return ""
+}
+
+// buildBulkTaskFilter translates an extracted filter into a Mongo query. narrowed reports
+// whether any criterion beyond ownership was applied; notFound is set when a named
+// project/context doesn't exist.
+func buildBulkTaskFilter(ctx context.Context, userID primitive.ObjectID, f aiBulkFilter, clock userClock) (filter bson.M, narrowed bool, notFound string) {
+	filter = bson.M{
+		"userId":    userID,
+		"trashed":   false,
+		"completed": f.Completed,
+	}
+	if f.ProjectName != "" {
+		projectID := lookupProjectID(ctx, f.ProjectName, userID)
+		if projectID == nil {
+			return nil, false, fmt.Sprintf("No project found matching \"%s\".", f.ProjectName)
+		}
+		filter["projectId"] = *projectID
+		narrowed = true
+	}
+	if name := strings.TrimPrefix(f.NextActionName, "@"); name != "" {
+		nextActionID := lookupNextActionID(ctx, name, userID)
+		if nextActionID == nil {
+			return nil, false, fmt.Sprintf("No next action/context found matching \"%s\".", f.NextActionName)
+		}
+		filter["nextActionId"] = *nextActionID
+		narrowed = true
+	}
+	if q := strings.TrimSpace(f.Query); q != "" {
+		pattern := regexp.QuoteMeta(q)
+		filter["$or"] = bson.A{
+			bson.M{"title": bson.M{"$regex": pattern, "$options": "i"}},
+			bson.M{"description": bson.M{"$regex": pattern, "$options": "i"}},
+		}
+		narrowed = true
+	}
+	if due := bulkDueFilter(f.Due, clock); due != nil {
+		filter["dueDate"] = due
+		narrowed = true
+	}
+	if f.Category == "inbox" {
+		filter["category"] = "inbox"
+		narrowed = true
+	}
+	return filter, narrowed, ""
+}
+
+// bulkDueFilter returns the dueDate condition for a relative due keyword, using the
+// user's calendar day. Undated tasks have no dueDate, so no range matches them.
+func bulkDueFilter(due string, clock userClock) bson.M {
+	today := clock.Today()
+	switch due {
+	case "today":
+		return bson.M{"$gte": today, "$lt": today.AddDate(0, 0, 1)}
+	case "tomorrow":
+		return bson.M{"$gte": today.AddDate(0, 0, 1), "$lt": today.AddDate(0, 0, 2)}
+	case "overdue":
+		return bson.M{"$lt": today}
+	case "thisWeek":
+		return bson.M{"$gte": today, "$lt": today.AddDate(0, 0, 7)}
+	default:
+		return nil
+	}
+}
+
+// describeBulkPreview phrases the confirmation question for a bulk operation.
+func describeBulkPreview(op aiBulkOperation, count int) string {
+	switch op.Type {
+	case "complete":
+		return fmt.Sprintf("This will complete %d task(s).", count)
+	case "trash":
+		return fmt.Sprintf("This will move %d task(s) to the trash.", count)
+	case "setPriority":
+		return fmt.Sprintf("This will set priority %d on %d task(s).", op.Priority, count)
+	case "setDueDate":
+		return fmt.Sprintf("This will set the due date of %d task(s) to %s.", count, op.DueDate)
+	default:
+		var targets []string
+		if op.ProjectName != "" {
+			targets = append(targets, "project \""+op.ProjectName+"\"")
+		}
+		if op.NextActionName != "" {
+			targets = append(targets, "context \""+op.NextActionName+"\"")
+		}
+		return fmt.Sprintf("This will move %d task(s) to %s.", count, strings.Join(targets, " and "))
+	}
+}
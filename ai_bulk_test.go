@@ -0,0 +1,59 @@
+package encoreapp
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBulkOperationProblem(t *testing.T) {
+	cases := []struct {
+		op aiBulkOperation
+		ok bool
+	}{
+		{aiBulkOperation{Type: "complete"}, true},
+		{aiBulkOperation{Type: "trash"}, true},
+		{aiBulkOperation{Type: "move", ProjectName: "Garden"}, true},
+		{aiBulkOperation{Type: "move", NextActionName: "@errands"}, true},
+		{aiBulkOperation{Type: "move", ProjectName: " ", NextActionName: "@"}, false},
+		{aiBulkOperation{Type: "setPriority", Priority: 1}, true},
+		{aiBulkOperation{Type: "setPriority", Priority: 5}, true},
+		{aiBulkOperation{Type: "setPriority", Priority: 0}, false},
+		{aiBulkOperation{Type: "setPriority", Priority: 6}, false},
+		{aiBulkOperation{Type: "setDueDate", DueDate: "2026-03-06T00:00:00Z"}, true},
+		{aiBulkOperation{Type: "setDueDate"}, false},
+		{aiBulkOperation{Type: "archive"}, false},
+	}
+	for _, c := range cases {
+		if problem := bulkOperationProblem(c.op); (problem == "") != c.ok {
+			t.Errorf("%+v: got %q, want ok=%v", c.op, problem, c.ok)
+		}
+	}
+}
+
+func TestBulkDueFilterSkipsUndatedTasks(t *testing.T) {
+	clock := userClock{Now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	day := func(days int) *time.Time {
+		d := clock.Today().AddDate(0, 0, days).Add(12 * time.Hour)
+		return &d
+	}
+	cases := []struct {
+		due   string
+		dated *time.Time // a due date in range
+	}{
+		{"overdue", day(-3)},
+		{"today", day(0)},
+		{"tomorrow", day(1)},
+		{"thisWeek", day(6)},
+	}
+	for _, c := range cases {
+		filter := bson.M{"dueDate": bulkDueFilter(c.due, clock)}
+		if !matchesFilter(t, filter, Task{DueDate: c.dated}) {
+			t.Errorf("%s: doesn't match a task due %v", c.due, c.dated)
+		}
+		if matchesFilter(t, filter, Task{CreatedAt: clock.Now.AddDate(0, -1, 0)}) {
+			t.Errorf("%s: matches an undated task", c.due)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package encoreapp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// How long a clarification token stays valid.
+const pendingIntentTTL = 15 * time.Minute
+
+// AIClarification is returned instead of acting when a prompt matches several tasks.
+// The client shows the candidates and sends the chosen one to /api/ai/clarify.
+type AIClarification struct {
+	Token      string                     `json:"token"`
+	Operation  string                     `json:"operation"`
+	Candidates []AIClarificationCandidate `json:"candidates"`
+	ExpiresAt  time.Time                  `json:"expiresAt"`
+}
+
+type AIClarificationCandidate struct {
+	ID           string              `json:"id"`
+	Title        string              `json:"title"`
+	Score        int                 `json:"score"`
+	ProjectID    *primitive.ObjectID `json:"projectId,omitempty"`
+	NextActionID *primitive.ObjectID `json:"nextActionId,omitempty"`
+	DueDate      *time.Time          `json:"dueDate,omitempty"`
+}
+
+// createPendingIntent stores the operation so it can be completed once the user picks
+// a candidate, without calling the LLM again.
+func createPendingIntent(ctx context.Context, userID primitive.ObjectID, operation string, prompt string, update *aiEntityUpdate, matches []taskMatch) (*AIClarification, error) {
+	pending := AIPendingIntent{
+		UserID:    userID,
+		Operation: operation,
+		Prompt:    prompt,
+		Update:    update,
+	}
+	candidates := []AIClarificationCandidate{}
+	for _, m := range matches {
+		pending.CandidateIDs = append(pending.CandidateIDs, m.Task.ID)
+		candidates = append(candidates, AIClarificationCandidate{
+			ID:           m.Task.ID.Hex(),
+			Title:        m.Task.Title,
+			Score:        m.Score,
+			ProjectID:    m.Task.ProjectID,
+			NextActionID: m.Task.NextActionID,
+			DueDate:      m.Task.DueDate,
+		})
+	}
+	if err := savePendingIntent(ctx, &pending); err != nil {
+		return nil, err
+	}
+	return &AIClarification{
+		Token:      pending.Token,
+		Operation:  operation,
+		Candidates: candidates,
+		ExpiresAt:  pending.ExpiresAt,
+	}, nil
+}
+
+// savePendingIntent assigns a fresh token and expiry to pending and stores it.
+func savePendingIntent(ctx context.Context, pending *AIPendingIntent) error {
+	client, err := GetMongoClient()
+	if err != nil {
+		return errors.New("database connection failed")
+	}
+	token, err := newPendingIntentToken()
+	if err != nil {
+		return err
+	}
+	pending.ID = primitive.NewObjectID()
+	pending.Token = token
+	pending.CreatedAt = time.Now()
+	pending.ExpiresAt = pending.CreatedAt.Add(pendingIntentTTL)
+	_, err = client.Database("gtd").Collection("ai_pending_intents").InsertOne(ctx, pending)
+	if err != nil {
+		return errors.New("failed to store pending intent")
+	}
+	return nil
+}
+
+// findPendingIntent loads a pending intent without using it up.
+func findPendingIntent(ctx context.Context, userID primitive.ObjectID, token string, operations ...string) (*AIPendingIntent, error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("ai_pending_intents")
+	var pending AIPendingIntent
+	filter := bson.M{"token": token, "userId": userID, "operation": bson.M{"$in": operations}}
+	if err := col.FindOne(ctx, filter).Decode(&pending); err != nil {
+		return nil, errors.New("clarification not found or already used")
+	}
+	if time.Now().After(pending.ExpiresAt) {
+		return nil, errors.New("clarification has expired, please ask again")
+	}
+	return &pending, nil
+}
+
+// consumePendingIntent deletes pending, so each token can be used once. It fails when
+// another request used the token first.
+func consumePendingIntent(ctx context.Context, pending *AIPendingIntent) error {
+	client, err := GetMongoClient()
+	if err != nil {
+		return errors.New("database connection failed")
+	}
+	res, err := client.Database("gtd").Collection("ai_pending_intents").DeleteOne(ctx, bson.M{"_id": pending.ID})
+	if err != nil {
+		return errors.New("database connection failed")
+	}
+	if res.DeletedCount == 0 {
+		return errors.New("clarification not found or already used")
+	}
+	return nil
+}
+
+// releasePendingIntent stores a consumed pending intent again, with its token, after the
+// operation failed.
+func releasePendingIntent(ctx context.Context, pending *AIPendingIntent) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return
+	}
+	client.Database("gtd").Collection("ai_pending_intents").InsertOne(ctx, pending)
+}
+
+func newPendingIntentToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Clarification follow-up endpoint
+type AIClarifyRequest struct {
+	Authorization string `header:"Authorization"`
+	Token         string `json:"token"`
+	CandidateID   string `json:"candidateId"`
+}
+
+type AIClarifyResponse struct {
+	Intent  string `json:"intent"`
+	Message string `json:"message"`
+	Task    *Task  `json:"task,omitempty"`
+}
+
+// encore:api public method=POST path=/api/ai/clarify
+func AIClarify(ctx context.Context, req *AIClarifyRequest) (*AIClarifyResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	candidateID, err := primitive.ObjectIDFromHex(req.CandidateID)
+	if err != nil {
+		return nil, errors.New("invalid candidate id")
+	}
+
+	// The token is only used up once the choice is known to be valid, so a wrong pick
+	// can be retried.
+	pending, err := findPendingIntent(ctx, userID, req.Token, "completeTask", "updateTask")
+	if err != nil {
+		return nil, err
+	}
+	allowed := false
+	for _, id := range pending.CandidateIDs {
+		if id == candidateID {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, errors.New("candidate is not part of this clarification")
+	}
+
+	tasksCol := client.Database("gtd").Collection("tasks")
+	var task Task
+	err = tasksCol.FindOne(ctx, bson.M{"_id": candidateID, "userId": userID, "trashed": false}).Decode(&task)
+	if err != nil {
+		return nil, errors.New("task not found")
+	}
+	switch {
+	case pending.Operation == "updateTask" && pending.Update == nil:
+		return nil, errors.New("pending update is missing")
+	case pending.Operation != "completeTask" && pending.Operation != "updateTask":
+		return nil, errors.New("unsupported pending operation")
+	}
+	if err := consumePendingIntent(ctx, pending); err != nil {
+		return nil, err
+	}
+
+	ctx, finish := beginAIAction(ctx, userID, pending.Operation, pending.Prompt)
+	defer finish()
+
+	var resp *AIClarifyResponse
+	if pending.Operation == "completeTask" {
+		done := completeFoundTask(ctx, req.Authorization, task)
+		resp = &AIClarifyResponse{Intent: "completeTask", Message: done.Message, Task: done.Task}
+	} else {
+		updated := applyTaskUpdate(ctx, req.Authorization, userID, task, *pending.Update)
+		resp = &AIClarifyResponse{Intent: "updateEntity", Message: updated.Message, Task: updated.Task}
+	}
+	if resp.Task == nil {
+		releasePendingIntent(ctx, pending) // failed, so the choice can be sent again
+	}
+	return resp, nil
+}
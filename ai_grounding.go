@@ -0,0 +1,152 @@
+package encoreapp
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Chat answers are grounded in a short snapshot of the user's own tasks and projects
+// unless the user has turned it off (User.AIGroundingDisabled). Only titles, due dates
+// and priorities are shared with the model.
+
+// Rough size limit of the snapshot; tokens are estimated at 4 characters each.
+const groundingTokenBudget = 500
+
+// Tasks loaded per snapshot section.
+const groundingSectionLimit = 15
+
+// groundedChatPrompt returns the chat system prompt with the user's snapshot appended.
+func groundedChatPrompt(ctx context.Context, userID primitive.ObjectID) activePrompt {
+	prompt := getPrompt(ctx, promptChat, userID)
+	snapshot := buildGroundingSnapshot(ctx, userID)
+	if snapshot == "" {
+		return prompt
+	}
+	prompt.Text += "\n\nThe user's current tasks and projects are below. Use them when the question is about " +
+		"their work or day, refer to tasks by title, and never invent tasks that aren't listed.\n" + snapshot
+	return prompt
+}
+
+// buildGroundingSnapshot lists overdue, due-today and high-priority open tasks and active
+// projects, most urgent first, cut off at groundingTokenBudget. It returns "" when the user
+// opted out or has nothing to show.
+func buildGroundingSnapshot(ctx context.Context, userID primitive.ObjectID) string {
+	client, err := GetMongoClient()
+	if err != nil {
+		return ""
+	}
+	db := client.Database("gtd")
+	var user User
+	if err := db.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil || user.AIGroundingDisabled {
+		return ""
+	}
+
+	clock := clockFromContext(ctx)
+	seen := map[primitive.ObjectID]bool{}
+	sections := groundingSections(userID, clock)
+
+	budget := groundingTokenBudget * 4
+	var b strings.Builder
+	write := func(line string) bool {
+		if b.Len()+len(line)+1 > budget {
+			return false
+		}
+		b.WriteString(line)
+		b.WriteString("\n")
+		return true
+	}
+
+	tasksCol := db.Collection("tasks")
+	for _, section := range sections {
+		opts := options.Find().SetSort(section.sort).SetLimit(groundingSectionLimit)
+		cur, err := tasksCol.Find(ctx, section.filter, opts)
+		if err != nil {
+			continue
+		}
+		var lines []string
+		for cur.Next(ctx) {
+			var t Task
+			if err := cur.Decode(&t); err != nil || seen[t.ID] {
+				continue
+			}
+			seen[t.ID] = true
+			lines = append(lines, "- "+describeGroundingTask(t, clock))
+		}
+		cur.Close(ctx)
+		if len(lines) == 0 {
+			continue
+		}
+		if !write(section.title + ":") {
+			return b.String()
+		}
+		for i, line := range lines {
+			if !write(line) {
+				write(fmt.Sprintf("- ... and %d more", len(lines)-i))
+				return b.String()
+			}
+		}
+	}
+
+	opts := options.Find().SetSort(bson.M{"updatedAt": -1}).SetLimit(groundingSectionLimit)
+	cur, err := db.Collection("projects").Find(ctx, bson.M{"userId": userID, "task_count": bson.M{"$gt": 0}}, opts)
+	if err == nil {
+		defer cur.Close(ctx)
+		header := false
+		for cur.Next(ctx) {
+			var p Project
+			if err := cur.Decode(&p); err != nil {
+				continue
+			}
+			if !header {
+				if !write("Active projects:") {
+					break
+				}
+				header = true
+			}
+			// task_count includes completed tasks
+			if !write(fmt.Sprintf("- %s (%d tasks)", p.Name, p.TaskCount)) {
+				break
+			}
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+type groundingSection struct {
+	title  string
+	filter bson.M
+	sort   bson.D
+}
+
+// groundingSections are the task lists given to the model, in order. The due sections
+// use bulkDueFilter, so undated tasks are never presented as overdue.
+func groundingSections(userID primitive.ObjectID, clock userClock) []groundingSection {
+	withFilter := func(extra bson.M) bson.M {
+		f := bson.M{"userId": userID, "completed": false, "trashed": false, "deferUntil": notDeferred(clock.Now)}
+		for k, v := range extra {
+			f[k] = v
+		}
+		return f
+	}
+	return []groundingSection{
+		{"Overdue", withFilter(bson.M{"dueDate": bulkDueFilter("overdue", clock)}), bson.D{{Key: "dueDate", Value: 1}}},
+		{"Due today", withFilter(bson.M{"dueDate": bulkDueFilter("today", clock)}), bson.D{{Key: "priority", Value: 1}}},
+		{"High priority", withFilter(bson.M{"priority": bson.M{"$gte": 1, "$lte": 2}}), bson.D{{Key: "priority", Value: 1}, {Key: "dueDate", Value: 1}}},
+	}
+}
+
+func describeGroundingTask(t Task, clock userClock) string {
+	desc := t.Title
+	if taskHasDeadline(t) {
+		desc += ", due " + t.DueDate.In(clock.Location()).Format("Mon Jan 2")
+	}
+	if t.Priority >= 1 && t.Priority <= 5 {
+		desc += fmt.Sprintf(", priority %d", t.Priority)
+	}
+	return desc
+}
@@ -0,0 +1,43 @@
+package encoreapp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGroundingSections(t *testing.T) {
+	userID := primitive.NewObjectID()
+	clock := userClock{Now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	at := func(days int) *time.Time {
+		d := clock.Today().AddDate(0, 0, days).Add(14 * time.Hour)
+		return &d
+	}
+	tasks := []struct {
+		name string
+		task Task
+	}{
+		{"overdue", Task{UserID: userID, DueDate: at(-2), Priority: PriorityUnset}},
+		{"due today", Task{UserID: userID, DueDate: at(0), Priority: 3}},
+		{"undated p1", Task{UserID: userID, Priority: 1, CreatedAt: clock.Now.AddDate(0, 0, -7)}},
+		{"undated", Task{UserID: userID, Priority: PriorityUnset, CreatedAt: clock.Now.AddDate(0, 0, -7)}},
+	}
+	want := map[string][]string{
+		"Overdue":       {"overdue"},
+		"Due today":     {"due today"},
+		"High priority": {"undated p1"},
+	}
+	for _, section := range groundingSections(userID, clock) {
+		var got []string
+		for _, c := range tasks {
+			if matchesFilter(t, section.filter, c.task) {
+				got = append(got, c.name)
+			}
+		}
+		if !reflect.DeepEqual(got, want[section.title]) {
+			t.Errorf("%s: got %v, want %v", section.title, got, want[section.title])
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package encoreapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Inbox tasks clarified per request, oldest first.
+const inboxBatchSize = 25
+
+// Actions proposed for an inbox task.
+var inboxActions = map[string]bool{
+	"trash":    true,
+	"someday":  true,
+	"delegate": true,
+	"doNow":    true,
+	"assign":   true,
+	"keep":     true,
+}
+
+type AIProcessInboxRequest struct {
+	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
+}
+
+// AIInboxProposal is the suggested clarification of one inbox task. The client may edit
+// it before sending it back to /api/ai/inbox/apply.
+type AIInboxProposal struct {
+	TaskID         string `json:"taskId"`
+	Title          string `json:"title"`
+	Action         string `json:"action"` // trash, someday, delegate, doNow, assign or keep
+	ProjectID      string `json:"projectId,omitempty"`
+	ProjectName    string `json:"projectName,omitempty"`
+	NextActionID   string `json:"nextActionId,omitempty"`
+	NextActionName string `json:"nextActionName,omitempty"`
+	DelegateTo     string `json:"delegateTo,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+type AIProcessInboxResponse struct {
+	Message   string            `json:"message"`
+	Proposals []AIInboxProposal `json:"proposals"`
+	Remaining int               `json:"remaining"` // inbox tasks not in this batch
+}
+
+// AIProcessInbox proposes a GTD clarification for each inbox task. Tasks are only moved
+// to projects and contexts that already exist; nothing is changed until the proposals
+// are sent to /api/ai/inbox/apply.
+// encore:api public method=POST path=/api/ai/inbox/process
+func AIProcessInbox(ctx context.Context, req *AIProcessInboxRequest) (*AIProcessInboxResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	db := client.Database("gtd")
+	tasksCol := db.Collection("tasks")
+	filter := bson.M{
+		"userId":       userID,
+		"category":     "inbox",
+		"projectId":    nil,
+		"nextActionId": nil,
+		"completed":    false,
+		"trashed":      false,
+	}
+	total, err := tasksCol.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := tasksCol.Find(ctx, filter, options.Find().SetSort(bson.M{"createdAt": 1}).SetLimit(inboxBatchSize))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var tasks []Task
+	for cur.Next(ctx) {
+		var t Task
+		if err := cur.Decode(&t); err == nil {
+			tasks = append(tasks, t)
+		}
+	}
+	if len(tasks) == 0 {
+		return &AIProcessInboxResponse{Message: "Your inbox is empty.", Proposals: []AIInboxProposal{}}, nil
+	}
+
+	projectNames := listUserNames(ctx, db.Collection("projects"), userID, "name")
+	contextNames := listUserNames(ctx, db.Collection("nextactions"), userID, "context_name")
+	input := processInboxInput(tasks, projectNames, contextNames)
+
+	prompt := getPrompt(ctx, promptProcessInbox, userID)
+	resp, err := callGroqChat(ctx, &userID, input, prompt)
+	if err != nil {
+		logAIInteraction(&userID, input, "", "processInbox", false, err.Error(), prompt.Label())
+		return nil, err
+	}
+	var aiResp struct {
+		Items []struct {
+			N              int    `json:"n"`
+			Action         string `json:"action"`
+			ProjectName    string `json:"projectName"`
+			NextActionName string `json:"nextActionName"`
+			DelegateTo     string `json:"delegateTo"`
+			Reason         string `json:"reason"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(resp), &aiResp); err != nil {
+		logAIInteraction(&userID, input, resp, "processInbox", false, err.Error(), prompt.Label())
+		return nil, errors.New("AI response could not be parsed as JSON: " + err.Error())
+	}
+	logAIInteraction(&userID, input, resp, "processInbox", true, "", prompt.Label())
+
+	proposals := make([]AIInboxProposal, len(tasks))
+	for i, t := range tasks {
+		proposals[i] = AIInboxProposal{TaskID: t.ID.Hex(), Title: t.Title, Action: "keep"}
+	}
+	for _, item := range aiResp.Items {
+		if item.N < 1 || item.N > len(tasks) || !inboxActions[item.Action] {
+			continue
+		}
+		p := &proposals[item.N-1]
+		p.Action, p.Reason = item.Action, item.Reason
+		switch item.Action {
+		case "delegate":
+			p.DelegateTo = strings.TrimSpace(item.DelegateTo)
+		case "assign":
+			resolveInboxTargets(ctx, userID, p, item.ProjectName, strings.TrimPrefix(item.NextActionName, "@"))
+		}
+	}
+
+	return &AIProcessInboxResponse{
+		Message:   fmt.Sprintf("Here is a suggestion for %d inbox tasks.", len(proposals)),
+		Proposals: proposals,
+		Remaining: int(total) - len(proposals),
+	}, nil
+}
+
+// resolveInboxTargets fills in existing project/context IDs for an "assign" proposal and
+// falls back to "keep" when neither exists.
+func resolveInboxTargets(ctx context.Context, userID primitive.ObjectID, p *AIInboxProposal, projectName, nextActionName string) {
+	if id := lookupProjectID(ctx, projectName, userID); id != nil {
+		p.ProjectID, p.ProjectName = id.Hex(), projectName
+	}
+	if id := lookupNextActionID(ctx, nextActionName, userID); id != nil {
+		p.NextActionID, p.NextActionName = id.Hex(), nextActionName
+	}
+	if p.ProjectID == "" && p.NextActionID == "" {
+		p.Action = "keep"
+		p.Reason = "No matching project or context exists"
+	}
+}
+
+// listUserNames returns the field values of the user's documents in col, e.g. project names.
+func listUserNames(ctx context.Context, col *mongo.Collection, userID primitive.ObjectID, field string) []string {
+	values, err := col.Distinct(ctx, field, bson.M{"userId": userID})
+	if err != nil {
+		return nil
+	}
+	names := []string{}
+	for _, v := range values {
+		if s, ok := v.(string); ok && s != "" {
+			names = append(names, s)
+		}
+	}
+	return names
+}
+
+// processInboxInput is the user message for SystemPromptProcessInbox.
+func processInboxInput(tasks []Task, projects, contexts []string) string {
+	type taskInput struct {
+		N           int    `json:"n"`
+		Title       string `json:"title"`
+		Description string `json:"description,omitempty"`
+		Minutes     int    `json:"minutes,omitempty"`
+	}
+	input := struct {
+		Projects []string    `json:"projects"`
+		Contexts []string    `json:"contexts"`
+		Tasks    []taskInput `json:"tasks"`
+	}{Projects: projects, Contexts: contexts}
+	if input.Projects == nil {
+		input.Projects = []string{}
+	}
+	if input.Contexts == nil {
+		input.Contexts = []string{}
+	}
+	for i, t := range tasks {
+		input.Tasks = append(input.Tasks, taskInput{N: i + 1, Title: t.Title, Description: t.Description, Minutes: t.EstimatedMinutes})
+	}
+	b, _ := json.Marshal(input)
+	return string(b)
+}
+
+type AIApplyInboxRequest struct {
+	Authorization string            `header:"Authorization"`
+	Proposals     []AIInboxProposal `json:"proposals"`
+}
+
+type AIApplyInboxResponse struct {
+	Message string   `json:"message"`
+	Applied int      `json:"applied"`
+	Tasks   []Task   `json:"tasks"`
+	Skipped []string `json:"skipped,omitempty"` // task IDs that were not changed, e.g. no longer in the inbox
+}
+
+// AIApplyInbox applies accepted (and possibly edited) inbox proposals as one undoable
+// AI action. "doNow" marks the task completed, "delegate" moves it to the "waiting"
+// category and "keep" leaves it in the inbox.
+// encore:api public method=POST path=/api/ai/inbox/apply
+func AIApplyInbox(ctx context.Context, req *AIApplyInboxRequest) (*AIApplyInboxResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	ctx, finish := beginAIAction(ctx, userID, "processInbox", "")
+	defer finish()
+
+	resp := &AIApplyInboxResponse{Tasks: []Task{}}
+	for _, p := range req.Proposals {
+		if p.Action == "keep" {
+			continue
+		}
+		task, err := applyInboxProposal(ctx, userID, p)
+		if err != nil {
+			resp.Skipped = append(resp.Skipped, p.TaskID)
+			continue
+		}
+		resp.Tasks = append(resp.Tasks, *task)
+	}
+	resp.Applied = len(resp.Tasks)
+	resp.Message = fmt.Sprintf("Processed %d inbox tasks.", resp.Applied)
+	return resp, nil
+}
+
+func applyInboxProposal(ctx context.Context, userID primitive.ObjectID, p AIInboxProposal) (*Task, error) {
+	if !inboxActions[p.Action] {
+		return nil, errors.New("unknown action")
+	}
+	objID, err := primitive.ObjectIDFromHex(p.TaskID)
+	if err != nil {
+		return nil, errors.New("invalid task id")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	db := client.Database("gtd")
+	tasksCol := db.Collection("tasks")
+	// A stale or edited proposal must not touch tasks that have left the inbox since
+	inboxFilter := bson.M{"_id": objID, "userId": userID, "trashed": false, "category": "inbox"}
+	var task Task
+	if err := tasksCol.FindOne(ctx, inboxFilter).Decode(&task); err != nil {
+		return nil, errors.New("task not found in the inbox")
+	}
+
+	// Counts move with the task, so they're only adjusted once the update went through
+	set := bson.M{"updatedAt": time.Now()}
+	newProjectID, newNextActionID := task.ProjectID, task.NextActionID
+	switch p.Action {
+	case "trash":
+		newProjectID, newNextActionID = nil, nil
+		set["trashed"] = true
+	case "someday":
+		set["category"] = "someday"
+	case "delegate":
+		set["category"] = "waiting"
+		set["delegatedTo"] = p.DelegateTo
+	case "doNow":
+		set["completed"] = true
+		set["completedAt"] = time.Now()
+	case "assign":
+		projectID, err := ownedObjectID(ctx, db.Collection("projects"), p.ProjectID, userID)
+		if err != nil {
+			return nil, err
+		}
+		nextActionID, err := ownedObjectID(ctx, db.Collection("nextactions"), p.NextActionID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if projectID == nil && nextActionID == nil {
+			return nil, errors.New("assign requires a project or next action")
+		}
+		newProjectID, newNextActionID = projectID, nextActionID
+		set["projectId"] = projectID
+		set["nextActionId"] = nextActionID
+		set["category"] = taskCategoryFor(projectID, nextActionID)
+	}
+
+	before := snapshotForAction(ctx, tasksCol, objID)
+	res, err := tasksCol.UpdateOne(ctx, inboxFilter, bson.M{"$set": set})
+	if err != nil {
+		return nil, errors.New("failed to update task")
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("task not found in the inbox")
+	}
+	adjustTaskCounts(ctx, db, task.ProjectID, newProjectID, task.NextActionID, newNextActionID)
+	recordActionUpdate(ctx, tasksCol, objID, before)
+	if err := tasksCol.FindOne(ctx, bson.M{"_id": objID}).Decode(&task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// ownedObjectID parses id and checks that it names one of the user's documents in col.
+// An empty id yields nil.
+func ownedObjectID(ctx context.Context, col *mongo.Collection, id string, userID primitive.ObjectID) (*primitive.ObjectID, error) {
+	if id == "" {
+		return nil, nil
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid id")
+	}
+	n, err := col.CountDocuments(ctx, bson.M{"_id": objID, "userId": userID})
+	if err != nil || n == 0 {
+		return nil, errors.New("not found")
+	}
+	return &objID, nil
+}
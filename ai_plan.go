@@ -0,0 +1,574 @@
+package encoreapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"encore.dev/beta/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Minutes assumed for a task without an estimate when the model doesn't give one.
+const planDefaultMinutes = 30
+
+// Open tasks offered to the model, highest planTaskScore first.
+const planMaxCandidates = 40
+
+// PlanAppointment is a fixed block in the user's day. Start and End are "HH:MM" today
+// or RFC 3339.
+type PlanAppointment struct {
+	Title string `json:"title"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type AIPlanDayRequest struct {
+	Authorization  string            `header:"Authorization"`
+	TimeZone       string            `header:"X-Timezone"`
+	AvailableHours float64           `json:"availableHours"`
+	StartAt        string            `json:"startAt,omitempty"` // "HH:MM", default now
+	Appointments   []PlanAppointment `json:"appointments,omitempty"`
+}
+
+// AIPlanItem is one block of the plan, either a task or one of the given appointments.
+type AIPlanItem struct {
+	Type      string     `json:"type"` // "task" or "appointment"
+	TaskID    string     `json:"taskId,omitempty"`
+	Title     string     `json:"title"`
+	Start     time.Time  `json:"start"`
+	End       time.Time  `json:"end"`
+	Minutes   int        `json:"minutes"`
+	Estimated bool       `json:"estimated,omitempty"` // Minutes is a guess, the task has no estimate
+	Reason    string     `json:"reason,omitempty"`
+	Context   string     `json:"context,omitempty"`
+	Priority  int        `json:"priority,omitempty"`
+	DueDate   *time.Time `json:"dueDate,omitempty"`
+}
+
+type AIPlanDayResponse struct {
+	Message          string       `json:"message"`
+	Items            []AIPlanItem `json:"items"`
+	PlannedMinutes   int          `json:"plannedMinutes"`
+	AvailableMinutes int          `json:"availableMinutes"`
+}
+
+// planCandidate is an open task considered for the plan.
+type planCandidate struct {
+	Task    Task
+	Context string
+	Score   int
+}
+
+// planPick is a candidate chosen for the day, in plan order.
+type planPick struct {
+	Candidate planCandidate
+	Minutes   int
+	Estimated bool
+	Reason    string
+}
+
+type planAppointment struct {
+	Title      string
+	Start, End time.Time
+}
+
+// AIPlanDay proposes an ordered plan for today from the user's open tasks, fitted into
+// the available hours around the given appointments. Nothing is changed; accepted items
+// can be scheduled with /api/ai/plan-day/accept.
+// encore:api public method=POST path=/api/ai/plan-day
+func AIPlanDay(ctx context.Context, req *AIPlanDayRequest) (*AIPlanDayResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	clock := clockFromContext(ctx)
+
+	if req.AvailableHours <= 0 || req.AvailableHours > 24 {
+		return nil, errors.New("availableHours must be between 0 and 24")
+	}
+	start := clock.Now.Truncate(time.Minute)
+	if req.StartAt != "" {
+		h, m, ok := parseClock(req.StartAt)
+		if !ok || h > 23 || m > 59 {
+			return nil, errors.New("invalid startAt")
+		}
+		today := clock.Today()
+		start = time.Date(today.Year(), today.Month(), today.Day(), h, m, 0, 0, today.Location())
+	}
+	end := start.Add(time.Duration(req.AvailableHours * float64(time.Hour)))
+	if dayEnd := clock.Today().AddDate(0, 0, 1); end.After(dayEnd) {
+		end = dayEnd
+	}
+	appointments, err := parsePlanAppointments(req.Appointments, clock)
+	if err != nil {
+		return nil, err
+	}
+	available := freePlanMinutes(start, end, appointments)
+
+	candidates, err := loadPlanCandidates(ctx, userID, clock)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return &AIPlanDayResponse{
+			Message:          "You have no open tasks to plan.",
+			Items:            appointmentPlanItems(appointments),
+			AvailableMinutes: available,
+		}, nil
+	}
+
+	prompt := getPrompt(ctx, promptPlanDay, userID)
+	input := planDayInput(candidates, appointments, available, clock)
+	picks, err := aiPlanPicks(ctx, userID, input, prompt, candidates)
+	if err != nil {
+		logAIInteraction(&userID, input, "", "planDay", false, err.Error(), prompt.Label())
+		if aiErrorCode(err) == errs.ResourceExhausted {
+			return nil, err
+		}
+		// Without the model the plan follows the score order
+		picks = heuristicPlanPicks(candidates, clock)
+	} else {
+		logAIInteraction(&userID, input, "", "planDay", true, "", prompt.Label())
+	}
+
+	items, planned := schedulePlan(start, end, appointments, picks)
+	msg := fmt.Sprintf("Planned %d tasks (%s) for today.", countPlanTasks(items), formatPlanMinutes(planned))
+	if planned == 0 {
+		msg = "None of your open tasks fit into the available time."
+	}
+	return &AIPlanDayResponse{
+		Message:          msg,
+		Items:            items,
+		PlannedMinutes:   planned,
+		AvailableMinutes: available,
+	}, nil
+}
+
+func parsePlanAppointments(in []PlanAppointment, clock userClock) ([]planAppointment, error) {
+	today := clock.Today()
+	parse := func(s string) (time.Time, bool) {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t.In(clock.Location()), true
+		}
+		h, m, ok := parseClock(strings.TrimSpace(s))
+		if !ok || h > 23 || m > 59 {
+			return time.Time{}, false
+		}
+		return time.Date(today.Year(), today.Month(), today.Day(), h, m, 0, 0, today.Location()), true
+	}
+	var out []planAppointment
+	for _, a := range in {
+		start, ok1 := parse(a.Start)
+		end, ok2 := parse(a.End)
+		if !ok1 || !ok2 || !end.After(start) {
+			return nil, fmt.Errorf("invalid appointment %q", a.Title)
+		}
+		out = append(out, planAppointment{Title: a.Title, Start: start, End: end})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out, nil
+}
+
+// freePlanMinutes is the time between start and end not covered by appointments.
+func freePlanMinutes(start, end time.Time, appointments []planAppointment) int {
+	free := end.Sub(start)
+	cursor := start
+	for _, a := range appointments {
+		s, e := a.Start, a.End
+		if s.Before(cursor) {
+			s = cursor
+		}
+		if e.After(end) {
+			e = end
+		}
+		if e.After(s) {
+			free -= e.Sub(s)
+			cursor = e
+		}
+	}
+	if free < 0 {
+		return 0
+	}
+	return int(free / time.Minute)
+}
+
+// loadPlanCandidates returns the open tasks with the highest planTaskScore.
+func loadPlanCandidates(ctx context.Context, userID primitive.ObjectID, clock userClock) ([]planCandidate, error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	db := client.Database("gtd")
+
+	contexts := map[primitive.ObjectID]string{}
+	naCur, err := db.Collection("nextactions").Find(ctx, bson.M{"userId": userID})
+	if err == nil {
+		for naCur.Next(ctx) {
+			var na NextAction
+			if err := naCur.Decode(&na); err == nil {
+				contexts[na.ID] = na.ContextName
+			}
+		}
+		naCur.Close(ctx)
+	}
+
+	cur, err := db.Collection("tasks").Find(ctx, planCandidateFilter(userID, clock))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var candidates []planCandidate
+	for cur.Next(ctx) {
+		var t Task
+		if err := cur.Decode(&t); err != nil {
+			continue
+		}
+		c := planCandidate{Task: t, Score: planTaskScore(t, clock)}
+		if t.NextActionID != nil {
+			c.Context = contexts[*t.NextActionID]
+		}
+		candidates = append(candidates, c)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Context != b.Context {
+			return a.Context < b.Context
+		}
+		return a.Task.CreatedAt.Before(b.Task.CreatedAt)
+	})
+	if len(candidates) > planMaxCandidates {
+		candidates = candidates[:planMaxCandidates]
+	}
+	return candidates, nil
+}
+
+// planCandidateFilter selects the open tasks that can be done today. Tasks that become
+// available later today can still be planned; someday and waiting-for tasks can't.
+func planCandidateFilter(userID primitive.ObjectID, clock userClock) bson.M {
+	return bson.M{
+		"userId":     userID,
+		"completed":  false,
+		"trashed":    false,
+		"category":   bson.M{"$nin": bson.A{"someday", "waiting"}},
+		"deferUntil": notDeferred(clock.Today().AddDate(0, 0, 1)),
+	}
+}
+
+// planTaskScore ranks a task for today: overdue and due-today tasks first, then by
+// priority, with a small bonus for quick tasks.
+func planTaskScore(t Task, clock userClock) int {
+	score := 0
+	if taskHasDeadline(t) {
+		today := clock.Today()
+		due := t.DueDate.In(clock.Location())
+		switch {
+		case due.Before(today):
+			days := int(today.Sub(startOfDay(due)).Hours() / 24)
+			if days > 14 {
+				days = 14
+			}
+			score += 100 + days
+		case due.Before(today.AddDate(0, 0, 1)):
+			score += 80
+		case due.Before(today.AddDate(0, 0, 3)):
+			score += 20
+		}
+	}
+	if t.Priority >= 1 && t.Priority <= 5 {
+		score += (6 - t.Priority) * 10
+	}
+	if t.EstimatedMinutes > 0 && t.EstimatedMinutes <= 15 {
+		score += 5
+	}
+	return score
+}
+
+// planDayInput is the user message for SystemPromptPlanDay.
+func planDayInput(candidates []planCandidate, appointments []planAppointment, available int, clock userClock) string {
+	type taskInput struct {
+		N        int    `json:"n"`
+		Title    string `json:"title"`
+		Due      string `json:"due,omitempty"`
+		Priority int    `json:"priority,omitempty"`
+		Context  string `json:"context,omitempty"`
+		Minutes  *int   `json:"minutes"`
+	}
+	type appointmentInput struct {
+		Title string `json:"title"`
+		Start string `json:"start"`
+		End   string `json:"end"`
+	}
+	input := struct {
+		Now              string             `json:"now"`
+		AvailableMinutes int                `json:"availableMinutes"`
+		Appointments     []appointmentInput `json:"appointments"`
+		Tasks            []taskInput        `json:"tasks"`
+	}{
+		Now:              clock.Now.Format(time.RFC3339),
+		AvailableMinutes: available,
+		Appointments:     []appointmentInput{},
+	}
+	for _, a := range appointments {
+		input.Appointments = append(input.Appointments, appointmentInput{a.Title, a.Start.Format("15:04"), a.End.Format("15:04")})
+	}
+	for i, c := range candidates {
+		ti := taskInput{N: i + 1, Title: c.Task.Title, Context: c.Context}
+		if taskHasDeadline(c.Task) {
+			ti.Due = c.Task.DueDate.In(clock.Location()).Format("2006-01-02")
+		}
+		if c.Task.Priority >= 1 && c.Task.Priority <= 5 {
+			ti.Priority = c.Task.Priority
+		}
+		if c.Task.EstimatedMinutes > 0 {
+			m := c.Task.EstimatedMinutes
+			ti.Minutes = &m
+		}
+		input.Tasks = append(input.Tasks, ti)
+	}
+	b, _ := json.Marshal(input)
+	return string(b)
+}
+
+// aiPlanPicks asks the model to choose and order the candidates. Unknown or repeated
+// task numbers are dropped.
+func aiPlanPicks(ctx context.Context, userID primitive.ObjectID, input string, prompt activePrompt, candidates []planCandidate) ([]planPick, error) {
+	resp, err := callGroqChat(ctx, &userID, input, prompt)
+	if err != nil {
+		return nil, err
+	}
+	var aiResp struct {
+		Items []struct {
+			N       int    `json:"n"`
+			Minutes int    `json:"minutes"`
+			Reason  string `json:"reason"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(resp), &aiResp); err != nil {
+		return nil, errors.New("AI response could not be parsed as JSON: " + err.Error())
+	}
+	seen := map[int]bool{}
+	var picks []planPick
+	for _, item := range aiResp.Items {
+		if item.N < 1 || item.N > len(candidates) || seen[item.N] {
+			continue
+		}
+		seen[item.N] = true
+		c := candidates[item.N-1]
+		pick := planPick{Candidate: c, Minutes: c.Task.EstimatedMinutes, Reason: item.Reason}
+		if pick.Minutes <= 0 {
+			pick.Minutes, pick.Estimated = item.Minutes, true
+			if pick.Minutes <= 0 || pick.Minutes > 8*60 {
+				pick.Minutes = planDefaultMinutes
+			}
+		}
+		picks = append(picks, pick)
+	}
+	if len(picks) == 0 && len(aiResp.Items) > 0 {
+		return nil, errors.New("AI plan referenced no known tasks")
+	}
+	return picks, nil
+}
+
+// heuristicPlanPicks orders the candidates by score, grouping tasks of the same context
+// that are equally urgent.
+func heuristicPlanPicks(candidates []planCandidate, clock userClock) []planPick {
+	var picks []planPick
+	for _, c := range candidates {
+		pick := planPick{Candidate: c, Minutes: c.Task.EstimatedMinutes, Reason: heuristicPlanReason(c.Task, clock)}
+		if pick.Minutes <= 0 {
+			pick.Minutes, pick.Estimated = planDefaultMinutes, true
+		}
+		picks = append(picks, pick)
+	}
+	return picks
+}
+
+func heuristicPlanReason(t Task, clock userClock) string {
+	var parts []string
+	if taskHasDeadline(t) {
+		today := clock.Today()
+		due := t.DueDate.In(clock.Location())
+		switch {
+		case due.Before(today):
+			parts = append(parts, "overdue")
+		case due.Before(today.AddDate(0, 0, 1)):
+			parts = append(parts, "due today")
+		case due.Before(today.AddDate(0, 0, 3)):
+			parts = append(parts, "due "+due.Format("Mon"))
+		}
+	}
+	if t.Priority >= 1 && t.Priority <= 2 {
+		parts = append(parts, "high priority")
+	}
+	if t.EstimatedMinutes > 0 && t.EstimatedMinutes <= 15 {
+		parts = append(parts, "quick win")
+	}
+	if len(parts) == 0 {
+		return "Open task with time left today"
+	}
+	s := strings.Join(parts, ", ")
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// schedulePlan places the picks in order from start, skipping over appointments, and
+// leaves out tasks that don't fit before end. The appointments are merged into the result.
+func schedulePlan(start, end time.Time, appointments []planAppointment, picks []planPick) ([]AIPlanItem, int) {
+	items := []AIPlanItem{}
+	planned := 0
+	cursor := start
+	for _, p := range picks {
+		d := time.Duration(p.Minutes) * time.Minute
+		slot, ok := nextPlanSlot(cursor, end, d, appointments)
+		if !ok {
+			continue // a shorter task later in the order may still fit
+		}
+		t := p.Candidate.Task
+		items = append(items, AIPlanItem{
+			Type:      "task",
+			TaskID:    t.ID.Hex(),
+			Title:     t.Title,
+			Start:     slot,
+			End:       slot.Add(d),
+			Minutes:   p.Minutes,
+			Estimated: p.Estimated,
+			Reason:    p.Reason,
+			Context:   p.Candidate.Context,
+			Priority:  t.Priority,
+			DueDate:   t.DueDate,
+		})
+		planned += p.Minutes
+		cursor = slot.Add(d)
+	}
+	items = append(items, appointmentPlanItems(appointments)...)
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Start.Before(items[j].Start) })
+	return items, planned
+}
+
+// nextPlanSlot returns the earliest time from cursor at which d fits without overlapping
+// an appointment and ends by end.
+func nextPlanSlot(cursor, end time.Time, d time.Duration, appointments []planAppointment) (time.Time, bool) {
+	for _, a := range appointments {
+		if !a.End.After(cursor) {
+			continue
+		}
+		if !a.Start.Before(cursor.Add(d)) {
+			break
+		}
+		cursor = a.End
+	}
+	return cursor, !cursor.Add(d).After(end)
+}
+
+func appointmentPlanItems(appointments []planAppointment) []AIPlanItem {
+	items := []AIPlanItem{}
+	for _, a := range appointments {
+		items = append(items, AIPlanItem{
+			Type:    "appointment",
+			Title:   a.Title,
+			Start:   a.Start,
+			End:     a.End,
+			Minutes: int(a.End.Sub(a.Start) / time.Minute),
+		})
+	}
+	return items
+}
+
+func countPlanTasks(items []AIPlanItem) int {
+	n := 0
+	for _, item := range items {
+		if item.Type == "task" {
+			n++
+		}
+	}
+	return n
+}
+
+func formatPlanMinutes(m int) string {
+	if m < 60 {
+		return fmt.Sprintf("%d min", m)
+	}
+	if m%60 == 0 {
+		return fmt.Sprintf("%dh", m/60)
+	}
+	return fmt.Sprintf("%dh %02dmin", m/60, m%60)
+}
+
+type AIPlanAcceptItem struct {
+	TaskID string `json:"taskId"`
+	Start  string `json:"start"` // the item's start, RFC 3339
+}
+
+type AIPlanAcceptRequest struct {
+	Authorization string             `header:"Authorization"`
+	TimeZone      string             `header:"X-Timezone"`
+	Items         []AIPlanAcceptItem `json:"items"`
+}
+
+type AIPlanAcceptResponse struct {
+	Message string `json:"message"`
+	Updated int    `json:"updated"`
+	Tasks   []Task `json:"tasks"`
+}
+
+// AIPlanAccept sets the due date of each accepted plan item to its planned start. The
+// change is recorded as one AI action and can be undone.
+// encore:api public method=POST path=/api/ai/plan-day/accept
+func AIPlanAccept(ctx context.Context, req *AIPlanAcceptRequest) (*AIPlanAcceptResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	clock := clockFromContext(ctx)
+	if len(req.Items) == 0 {
+		return nil, errors.New("no items to accept")
+	}
+
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	tasksCol := client.Database("gtd").Collection("tasks")
+	ctx, finish := beginAIAction(ctx, userID, "planDay", "")
+	defer finish()
+
+	tasks := []Task{}
+	for _, item := range req.Items {
+		objID, err := primitive.ObjectIDFromHex(item.TaskID)
+		if err != nil {
+			return nil, errors.New("invalid task id")
+		}
+		due, err := parseTaskDate(item.Start, clock)
+		if err != nil {
+			return nil, errors.New("invalid start for task " + item.TaskID)
+		}
+		filter := bson.M{"_id": objID, "userId": userID, "trashed": false}
+		before := snapshotForAction(ctx, tasksCol, objID)
+		res, err := tasksCol.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"dueDate": due, "updatedAt": time.Now()}})
+		if err != nil || res.MatchedCount == 0 {
+			continue
+		}
+		recordActionUpdate(ctx, tasksCol, objID, before)
+		rescheduleTaskReminders(ctx, client.Database("gtd"), objID, due)
+		var t Task
+		if err := tasksCol.FindOne(ctx, filter).Decode(&t); err == nil {
+			tasks = append(tasks, t)
+		}
+	}
+	return &AIPlanAcceptResponse{
+		Message: fmt.Sprintf("Scheduled %d tasks for today.", len(tasks)),
+		Updated: len(tasks),
+		Tasks:   tasks,
+	}, nil
+}
@@ -0,0 +1,162 @@
+package encoreapp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func planClock(hhmm string) time.Time {
+	t, _ := time.Parse("2006-01-02 15:04", "2026-03-02 "+hhmm)
+	return t
+}
+
+func planAppointments(spans ...[2]string) []planAppointment {
+	var out []planAppointment
+	for _, s := range spans {
+		out = append(out, planAppointment{Title: s[0] + "-" + s[1], Start: planClock(s[0]), End: planClock(s[1])})
+	}
+	return out
+}
+
+func TestFreePlanMinutes(t *testing.T) {
+	cases := []struct {
+		name         string
+		appointments []planAppointment
+		want         int
+	}{
+		{"no appointments", nil, 480},
+		{"one appointment", planAppointments([2]string{"10:00", "11:00"}), 420},
+		{"back to back", planAppointments([2]string{"10:00", "11:00"}, [2]string{"11:00", "11:30"}), 390},
+		{"overlapping", planAppointments([2]string{"10:00", "11:00"}, [2]string{"10:30", "11:30"}), 390},
+		{"nested", planAppointments([2]string{"10:00", "12:00"}, [2]string{"10:30", "11:00"}), 360},
+		{"clipped to the day", planAppointments([2]string{"08:00", "10:00"}, [2]string{"16:00", "18:00"}), 360},
+		{"outside the day", planAppointments([2]string{"07:00", "08:30"}, [2]string{"17:00", "18:00"}), 480},
+		{"whole day", planAppointments([2]string{"08:00", "18:00"}), 0},
+	}
+	for _, c := range cases {
+		if got := freePlanMinutes(planClock("09:00"), planClock("17:00"), c.appointments); got != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNextPlanSlot(t *testing.T) {
+	day := planAppointments([2]string{"10:00", "11:00"}, [2]string{"11:30", "12:00"})
+	cases := []struct {
+		name    string
+		cursor  string
+		minutes int
+		want    string
+		ok      bool
+	}{
+		{"fits before the first appointment", "09:00", 60, "09:00", true},
+		{"pushed past an overlapping appointment", "09:30", 60, "12:00", true},
+		{"fits in the gap", "10:30", 30, "11:00", true},
+		{"too long for the gap", "10:30", 45, "12:00", true},
+		{"inside an appointment", "11:40", 15, "12:00", true},
+		{"ends exactly at the end of the day", "16:00", 60, "16:00", true},
+		{"runs past the end of the day", "16:30", 60, "16:30", false},
+	}
+	for _, c := range cases {
+		got, ok := nextPlanSlot(planClock(c.cursor), planClock("17:00"), time.Duration(c.minutes)*time.Minute, day)
+		if ok != c.ok || (ok && !got.Equal(planClock(c.want))) {
+			t.Errorf("%s: got %s %v, want %s %v", c.name, got.Format("15:04"), ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestSchedulePlan(t *testing.T) {
+	pick := func(title string, minutes int) planPick {
+		return planPick{Candidate: planCandidate{Task: Task{Title: title}}, Minutes: minutes}
+	}
+	cases := []struct {
+		name         string
+		appointments []planAppointment
+		picks        []planPick
+		want         []string // "HH:MM title" in start order
+		planned      int
+	}{
+		{"fills the day in order", nil,
+			[]planPick{pick("a", 60), pick("b", 30)},
+			[]string{"09:00 a", "10:00 b"}, 90},
+		{"works around appointments",
+			planAppointments([2]string{"09:30", "10:00"}),
+			[]planPick{pick("a", 60), pick("b", 15)},
+			[]string{"09:30 09:30-10:00", "10:00 a", "11:00 b"}, 75},
+		{"skips a task that doesn't fit but keeps shorter ones",
+			planAppointments([2]string{"10:00", "16:30"}),
+			[]planPick{pick("a", 45), pick("long", 90), pick("b", 30)},
+			[]string{"09:00 a", "10:00 10:00-16:30", "16:30 b"}, 75},
+		{"nothing fits",
+			planAppointments([2]string{"09:00", "17:00"}),
+			[]planPick{pick("a", 15)},
+			[]string{"09:00 09:00-17:00"}, 0},
+	}
+	for _, c := range cases {
+		items, planned := schedulePlan(planClock("09:00"), planClock("17:00"), c.appointments, c.picks)
+		var got []string
+		for _, item := range items {
+			got = append(got, item.Start.Format("15:04")+" "+item.Title)
+		}
+		if planned != c.planned || strings.Join(got, ", ") != strings.Join(c.want, ", ") {
+			t.Errorf("%s: got %v (%d min), want %v (%d min)", c.name, got, planned, c.want, c.planned)
+		}
+	}
+}
+
+func TestPlanTaskScoreAndReason(t *testing.T) {
+	clock := userClock{Now: planClock("09:00")}
+	due := func(days int) *time.Time {
+		d := clock.Today().AddDate(0, 0, days).Add(17 * time.Hour)
+		return &d
+	}
+	created := clock.Now.AddDate(0, 0, -30)
+	cases := []struct {
+		name   string
+		task   Task
+		score  int
+		reason string
+	}{
+		{"overdue", Task{DueDate: due(-3), Priority: PriorityUnset, CreatedAt: created}, 103, "Overdue"},
+		{"overdue is capped", Task{DueDate: due(-40), Priority: PriorityUnset, CreatedAt: created}, 114, "Overdue"},
+		{"due today, p1", Task{DueDate: due(0), Priority: 1, CreatedAt: created}, 130, "Due today, high priority"},
+		{"due in two days", Task{DueDate: due(2), Priority: 3, CreatedAt: created}, 50, "Due Wed"},
+		{"undated, created a month ago", Task{Priority: 3, CreatedAt: created}, 30, "Open task with time left today"},
+		{"undated quick win", Task{Priority: 2, EstimatedMinutes: 10, CreatedAt: created}, 45, "High priority, quick win"},
+	}
+	for _, c := range cases {
+		if got := planTaskScore(c.task, clock); got != c.score {
+			t.Errorf("%s: score %d, want %d", c.name, got, c.score)
+		}
+		if got := heuristicPlanReason(c.task, clock); got != c.reason {
+			t.Errorf("%s: reason %q, want %q", c.name, got, c.reason)
+		}
+	}
+}
+
+func TestPlanCandidateFilter(t *testing.T) {
+	userID := primitive.NewObjectID()
+	clock := userClock{Now: planClock("09:00")}
+	later := planClock("15:00")
+	tomorrow := clock.Today().AddDate(0, 0, 1).Add(9 * time.Hour)
+	cases := []struct {
+		task Task
+		want bool
+	}{
+		{Task{UserID: userID, Category: "nextActions"}, true},
+		{Task{UserID: userID, Category: "inbox"}, true},
+		{Task{UserID: userID, Category: "projects", DeferUntil: &later}, true},
+		{Task{UserID: userID, Category: "someday"}, false},
+		{Task{UserID: userID, Category: "waiting"}, false},
+		{Task{UserID: userID, Category: "inbox", DeferUntil: &tomorrow}, false},
+		{Task{UserID: userID, Category: "inbox", Completed: true}, false},
+	}
+	for _, c := range cases {
+		if got := matchesFilter(t, planCandidateFilter(userID, clock), c.task); got != c.want {
+			t.Errorf("%+v: got %v, want %v", c.task, got, c.want)
+		}
+	}
+}
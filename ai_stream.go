@@ -0,0 +1,192 @@
+package encoreapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"encore.dev/beta/errs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Intents that run an action instead of answering in text. Anything else is streamed as chat.
+var assistantActionIntents = map[string]bool{
+	"summarize":     true,
+	"list":          true,
+	"createTask":    true,
+	"createProject": true,
+	"completeTask":  true,
+	"updateEntity":  true,
+	"bulkUpdate":    true,
+}
+
+type AIAssistantStreamRequest struct {
+	Prompt string `json:"prompt"`
+}
+
+// sseWriter writes Server-Sent Events and flushes after each one.
+type sseWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (s *sseWriter) send(event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// writeJSONError writes an error body for raw endpoints.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// AIAssistantStream is the Server-Sent Events variant of /api/ai/assistant. It sends an
+// "intent" event once the prompt is classified, "token" events while a chat answer is
+// generated, and ends with a "result" event holding the AIAssistantResponse or an
+// "error" event.
+// encore:api public raw method=POST path=/api/ai/assistant/stream
+func AIAssistantStream(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	authHeader := req.Header.Get("Authorization")
+	userID, err := getUserObjectIDFromAuth(ctx, authHeader)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var body AIAssistantStreamRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || strings.TrimSpace(body.Prompt) == "" {
+		writeJSONError(w, http.StatusBadRequest, "prompt is required")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+	sse := &sseWriter{w: w, flusher: flusher}
+
+	assistantReq := &AIAssistantRequest{
+		Prompt:        body.Prompt,
+		Authorization: authHeader,
+		TimeZone:      req.Header.Get("X-Timezone"),
+	}
+	ctx = withUserClock(ctx, userID, assistantReq.TimeZone)
+	ctx, finish := beginAIAction(ctx, userID, "", body.Prompt)
+	defer finish()
+
+	resp, err := streamAssistant(ctx, sse, userID, assistantReq)
+	if err != nil {
+		sse.send("error", map[string]interface{}{
+			"error":  err.Error(),
+			"status": httpStatusForError(err),
+		})
+		return
+	}
+	sse.send("result", resp)
+}
+
+func streamAssistant(ctx context.Context, sse *sseWriter, userID primitive.ObjectID, req *AIAssistantRequest) (*AIAssistantResponse, error) {
+	if llmBreaker.Open() {
+		return providerDownResponse(), nil
+	}
+
+	parseVersion := getPrompt(ctx, promptParseIntent, userID).Label()
+	intent := "chat"
+	parseResp, err := parseIntent(ctx, userID, req.Prompt)
+	if err != nil {
+		logAIInteraction(&userID, req.Prompt, "", "error", false, err.Error(), parseVersion)
+		if aiErrorCode(err) == errs.ResourceExhausted {
+			return nil, err
+		}
+		if aiErrorCode(err) == errs.Unavailable {
+			return providerDownResponse(), nil
+		}
+	} else {
+		logAIInteraction(&userID, req.Prompt, "", parseResp.Intent, true, "", parseVersion)
+		intent = parseResp.Intent
+	}
+	if err := sse.send("intent", map[string]string{"intent": intent}); err != nil {
+		return nil, err
+	}
+
+	if assistantActionIntents[intent] {
+		return runAssistantIntent(ctx, req, intent)
+	}
+
+	systemPrompt := groundedChatPrompt(ctx, userID)
+	answer, err := streamGroqChat(ctx, &userID, req.Prompt, systemPrompt, func(text string) error {
+		return sse.send("token", map[string]string{"text": text})
+	})
+	if err != nil {
+		logAIInteraction(&userID, req.Prompt, answer, "chat", false, err.Error(), systemPrompt.Label())
+		return nil, err
+	}
+	logAIInteraction(&userID, req.Prompt, answer, "chat", true, "", systemPrompt.Label())
+	return &AIAssistantResponse{Intent: "chat", Message: answer}, nil
+}
+
+// streamGroqChat is callGroqChat for streamed answers. With cassettes enabled the
+// recorded answer is delivered as a single fragment.
+func streamGroqChat(ctx context.Context, userID *primitive.ObjectID, userPrompt string, prompt activePrompt, onToken func(string) error) (string, error) {
+	if secrets.LLM_CASSETTE_MODE != "" {
+		answer, err := callGroqChat(ctx, userID, userPrompt, prompt)
+		if err != nil {
+			return "", err
+		}
+		return answer, onToken(answer)
+	}
+
+	reqBody := newChatRequest(ctx, userPrompt, prompt)
+	if userID != nil {
+		if err := checkAIQuota(ctx, *userID); err != nil {
+			return "", err
+		}
+	}
+	if !llmBreaker.allow() {
+		return "", aiError(&llmError{kind: ErrProviderDown, msg: "AI provider is unavailable (circuit open)"})
+	}
+	client := &httpLLMClient{baseURL: llmBaseURL(), apiKey: secrets.GROQ_API_KEY, http: llmHTTPClient}
+	answer, usage, err := client.Stream(ctx, reqBody, onToken)
+	llmBreaker.finish(ctx, err)
+	if userID != nil {
+		recordAIUsage(ctx, *userID, reqBody.Model, usage)
+	}
+	if err != nil {
+		return answer, aiError(err)
+	}
+	if answer == "" {
+		return "", errors.New("empty response content from Groq API")
+	}
+
+	var userIDStr string
+	if userID != nil {
+		userIDStr = userID.Hex()
+	}
+	LogEvent("user_prompt", userIDStr, map[string]interface{}{
+		"prompt": userPrompt,
+	})
+	LogEvent("ai_reply", userIDStr, map[string]interface{}{
+		"reply":          answer,
+		"prompt_version": prompt.Label(),
+		"streamed":       true,
+	})
+	return answer, nil
+}
@@ -0,0 +1,113 @@
+package encoreapp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestAssistantReplay runs the streamed assistant flow offline from the cassettes in
+// testdata/cassettes: the prompt is classified, then chat prompts are answered through
+// the token stream and task prompts have their fields extracted. Action intents stop
+// after extraction, as their endpoints need auth and a database. Refresh the cassettes
+// against a model after changing a prompt:
+//
+//	LLM_BASE_URL=... LLM_CASSETTE_MODE=record go test -run TestAssistantReplay
+func TestAssistantReplay(t *testing.T) {
+	mode := os.Getenv("LLM_CASSETTE_MODE")
+	if mode == "" {
+		mode = "replay"
+	}
+	secrets.LLM_BASE_URL = os.Getenv("LLM_BASE_URL")
+	secrets.LLM_MODEL = os.Getenv("LLM_MODEL")
+	secrets.GROQ_API_KEY = os.Getenv("GROQ_API_KEY")
+	secrets.LLM_CASSETTE_MODE, secrets.LLM_CASSETTE_DIR = mode, ""
+	defer func() {
+		secrets.LLM_BASE_URL, secrets.LLM_MODEL, secrets.GROQ_API_KEY = "", "", ""
+		secrets.LLM_CASSETTE_MODE = ""
+	}()
+
+	// The user and clock are part of the recorded requests, so they are pinned.
+	userID, _ := primitive.ObjectIDFromHex("65f1c0de5e1f0a0b0c0d0e0f")
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	ctx := context.WithValue(context.Background(), userClockKey{}, userClock{Now: now})
+
+	cases := []struct {
+		prompt  string
+		intent  string
+		answer  string // chat: substring of the streamed answer
+		title   string // createTask: substring of the extracted title
+		dueDate string
+	}{
+		{prompt: "What's the two-minute rule?", intent: "chat", answer: "two minutes"},
+		{prompt: "call the dentist tomorrow at 3pm", intent: "createTask", title: "dentist", dueDate: "2026-03-03T15:00:00Z"},
+		{prompt: "submit the expense report by friday", intent: "createTask", title: "expense report", dueDate: "2026-03-06"},
+		{prompt: "what's on my list for today?", intent: "list"},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		resp, err := streamAssistant(ctx, &sseWriter{w: rec, flusher: rec}, userID, &AIAssistantRequest{Prompt: c.prompt})
+		events := parseSSEEvents(rec.Body.String())
+		if len(events) == 0 || events[0].name != "intent" || events[0].data["intent"] != c.intent {
+			t.Errorf("%q: events %v, want intent %q first", c.prompt, events, c.intent)
+			continue
+		}
+
+		switch c.intent {
+		case "chat":
+			if err != nil {
+				t.Errorf("%q: %v", c.prompt, err)
+				continue
+			}
+			var streamed strings.Builder
+			for _, e := range events[1:] {
+				if e.name == "token" {
+					streamed.WriteString(e.data["text"])
+				}
+			}
+			if resp.Intent != "chat" || streamed.String() != resp.Message || !strings.Contains(strings.ToLower(resp.Message), c.answer) {
+				t.Errorf("%q: streamed %q, message %q, want it to mention %q", c.prompt, streamed.String(), resp.Message, c.answer)
+			}
+		case "createTask":
+			task, err := extractTask(ctx, userID, c.prompt)
+			if err != nil {
+				t.Errorf("%q: extractTask: %v", c.prompt, err)
+				continue
+			}
+			if !strings.Contains(strings.ToLower(task.Title), c.title) || !evalSameDueDate(c.dueDate, task.DueDate, userClock{Now: now}) {
+				t.Errorf("%q: title %q, due %q, want %q due %s", c.prompt, task.Title, task.DueDate, c.title, c.dueDate)
+			}
+		}
+	}
+}
+
+type sseEvent struct {
+	name string
+	data map[string]string
+}
+
+// parseSSEEvents decodes the events written by sseWriter. Data that isn't a flat JSON
+// object of strings, like the final result, is left empty.
+func parseSSEEvents(body string) []sseEvent {
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var e sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				e.name = name
+			} else if data, ok := strings.CutPrefix(line, "data: "); ok {
+				json.Unmarshal([]byte(data), &e.data)
+			}
+		}
+		if e.name != "" {
+			events = append(events, e)
+		}
+	}
+	return events
+}
@@ -0,0 +1,524 @@
+package encoreapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Email capture: every user gets an address <token>@CAPTURE_EMAIL_DOMAIN, and mail sent
+// or forwarded there becomes an inbox task. The inbound relay POSTs the raw MIME message
+// to /api/inbound/email, either as the request body or as the "email" (SendGrid) or
+// "body-mime" (Mailgun) form field, and authenticates with CAPTURE_INBOUND_SECRET in the
+// X-Capture-Secret header or the secret query parameter.
+
+const (
+	maxInboundEmailSize   = 25 << 20
+	maxCapturedBodyBytes  = 1 << 20
+	maxCaptureDescription = 5000 // runes
+	maxCaptureAIInput     = 2000 // runes of body sent for extraction
+	maxMIMEDepth          = 10
+)
+
+type CaptureAddressRequest struct {
+	Authorization string `header:"Authorization"`
+}
+
+type CaptureAddressResponse struct {
+	Address string `json:"address"`
+	UseAI   bool   `json:"useAI"`
+}
+
+type CapturedEmailResponse struct {
+	Email CapturedEmail `json:"email"`
+}
+
+// GetCaptureAddress returns the user's capture address, creating it on first use.
+// encore:api public method=GET path=/api/capture/address
+func GetCaptureAddress(ctx context.Context, req *CaptureAddressRequest) (*CaptureAddressResponse, error) {
+	return captureAddress(ctx, req.Authorization, false)
+}
+
+// RotateCaptureAddress replaces the capture address; mail to the old one is rejected.
+// encore:api public method=POST path=/api/capture/address/rotate
+func RotateCaptureAddress(ctx context.Context, req *CaptureAddressRequest) (*CaptureAddressResponse, error) {
+	return captureAddress(ctx, req.Authorization, true)
+}
+
+func captureAddress(ctx context.Context, authorization string, rotate bool) (*CaptureAddressResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	if secrets.CAPTURE_EMAIL_DOMAIN == "" {
+		return nil, errors.New("email capture is not configured")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	users := client.Database("gtd").Collection("users")
+	token, err := newCaptureToken()
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.M{"_id": userID}
+	if !rotate {
+		filter["captureToken"] = bson.M{"$exists": false}
+	}
+	if _, err := users.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"captureToken": token}}); err != nil {
+		return nil, errors.New("failed to create capture address")
+	}
+	var user User
+	if err := users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return nil, errors.New("failed to load profile")
+	}
+	return &CaptureAddressResponse{Address: user.CaptureToken + "@" + secrets.CAPTURE_EMAIL_DOMAIN, UseAI: user.CaptureUseAI}, nil
+}
+
+// GetTaskEmail returns the captured email a task was created from.
+// encore:api public method=GET path=/api/tasks/:id/email
+func GetTaskEmail(ctx context.Context, id string, req *CaptureAddressRequest) (*CapturedEmailResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	taskID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid task id")
+	}
+	var email CapturedEmail
+	if err := client.Database("gtd").Collection("captured_emails").FindOne(ctx, bson.M{"taskId": taskID, "userId": userID}).Decode(&email); err != nil {
+		return nil, errors.New("captured email not found")
+	}
+	return &CapturedEmailResponse{Email: email}, nil
+}
+
+// InboundEmail turns a message sent to a capture address into an inbox task.
+// encore:api public raw method=POST path=/api/inbound/email
+func InboundEmail(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	if secrets.CAPTURE_INBOUND_SECRET == "" {
+		writeJSONError(w, http.StatusServiceUnavailable, "email capture is not configured")
+		return
+	}
+	secret := req.Header.Get("X-Capture-Secret")
+	if secret == "" {
+		secret = req.URL.Query().Get("secret")
+	}
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(secrets.CAPTURE_INBOUND_SECRET)) != 1 {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	req.Body = http.MaxBytesReader(w, req.Body, maxInboundEmailSize)
+	raw, envelopeTo, err := readInboundRequest(req)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	email, err := parseInboundEmail(bytes.NewReader(raw))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid email: "+err.Error())
+		return
+	}
+	if envelopeTo != "" {
+		email.Recipients = append([]string{envelopeTo}, email.Recipients...)
+	}
+
+	client, err := GetMongoClient()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "database connection failed")
+		return
+	}
+	db := client.Database("gtd")
+	user, ok := findCaptureUser(ctx, db, email.Recipients)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown capture address")
+		return
+	}
+
+	captured := db.Collection("captured_emails")
+	if email.MessageID != "" {
+		var existing CapturedEmail
+		if err := captured.FindOne(ctx, bson.M{"userId": user.ID, "messageId": email.MessageID}).Decode(&existing); err == nil {
+			writeCaptureResult(w, existing, true) // relay retry
+			return
+		}
+	}
+
+	task, usedAI, err := createCapturedTask(withUserClock(ctx, user.ID, ""), user, email)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "failed to create task")
+		return
+	}
+	record := CapturedEmail{
+		ID:          primitive.NewObjectID(),
+		UserID:      user.ID,
+		TaskID:      task.ID,
+		MessageID:   email.MessageID,
+		From:        email.From,
+		Subject:     email.Subject,
+		Attachments: email.Attachments,
+		UsedAI:      usedAI,
+		ReceivedAt:  time.Now(),
+	}
+	if _, err := captured.InsertOne(ctx, record); err != nil {
+		log.Printf("Failed to store captured email for task %s: %v", task.ID.Hex(), err)
+	}
+	LogEvent("email_captured", user.ID.Hex(), map[string]interface{}{
+		"taskId":      task.ID.Hex(),
+		"attachments": len(email.Attachments),
+		"usedAI":      usedAI,
+	})
+	writeCaptureResult(w, record, false)
+}
+
+func writeCaptureResult(w http.ResponseWriter, email CapturedEmail, duplicate bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"taskId":    email.TaskID.Hex(),
+		"usedAI":    email.UsedAI,
+		"duplicate": duplicate,
+	})
+}
+
+// readInboundRequest returns the raw message and, if the relay sent one, the envelope
+// recipient.
+func readInboundRequest(req *http.Request) ([]byte, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" && mediaType != "application/x-www-form-urlencoded" {
+		raw, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, "", errors.New("message too large")
+		}
+		return raw, req.URL.Query().Get("to"), nil
+	}
+	if mediaType == "multipart/form-data" {
+		if err := req.ParseMultipartForm(maxInboundEmailSize); err != nil {
+			return nil, "", errors.New("invalid form")
+		}
+	} else if err := req.ParseForm(); err != nil {
+		return nil, "", errors.New("invalid form")
+	}
+	to := req.FormValue("recipient")
+	if to == "" {
+		to = req.FormValue("to")
+	}
+	for _, field := range []string{"email", "body-mime"} {
+		if v := req.FormValue(field); v != "" {
+			return []byte(v), to, nil
+		}
+	}
+	return nil, "", errors.New("no raw message in form")
+}
+
+// findCaptureUser returns the user owning the first capture address among recipients.
+func findCaptureUser(ctx context.Context, db *mongo.Database, recipients []string) (User, bool) {
+	for _, addr := range recipients {
+		token, ok := captureTokenFromAddress(addr, secrets.CAPTURE_EMAIL_DOMAIN)
+		if !ok {
+			continue
+		}
+		var user User
+		if err := db.Collection("users").FindOne(ctx, bson.M{"captureToken": token}).Decode(&user); err == nil {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// captureTokenFromAddress extracts the token from "<token>[+tag]@domain".
+func captureTokenFromAddress(addr, domain string) (string, bool) {
+	if parsed, err := mail.ParseAddress(addr); err == nil {
+		addr = parsed.Address
+	}
+	at := strings.LastIndex(addr, "@")
+	if at <= 0 || domain == "" || !strings.EqualFold(addr[at+1:], domain) {
+		return "", false
+	}
+	local := strings.ToLower(addr[:at])
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	return local, local != ""
+}
+
+func newCaptureToken() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// createCapturedTask creates the task, through AI extraction when the user enabled it.
+// Extraction failures (quota, provider down) fall back to a plain inbox task.
+func createCapturedTask(ctx context.Context, user User, email *inboundEmail) (*Task, bool, error) {
+	title, description := captureTaskText(email)
+	if user.CaptureUseAI {
+		input := title
+		if body := truncateRunes(email.Text, maxCaptureAIInput); body != "" {
+			input += "\n\n" + body
+		}
+		task, err := aiCreateTaskForUser(ctx, user.ID, input)
+		if err == nil {
+			if task.Description == "" && description != "" {
+				if client, err := GetMongoClient(); err == nil {
+					_, _ = client.Database("gtd").Collection("tasks").UpdateOne(ctx, bson.M{"_id": task.ID}, bson.M{"$set": bson.M{"description": description}})
+					task.Description = description
+				}
+			}
+			return task, true, nil
+		}
+		log.Printf("AI extraction failed for captured email, creating plain task: %v", err)
+	}
+	resp, err := createTaskForUser(ctx, user.ID, &CreateTaskRequest{Title: title, Description: description, Category: "inbox"})
+	if err != nil {
+		return nil, false, err
+	}
+	return &resp.Task, false, nil
+}
+
+var (
+	forwardPrefix = regexp.MustCompile(`(?i)^\s*fwd?\s*:\s*`)
+	// "-- " starts a signature; quoted-printable decoding drops the trailing space.
+	signatureDelimiter = regexp.MustCompile(`(?m)^-- ?$`)
+)
+
+// captureTaskText derives the title from the subject, without forwarding prefixes, or
+// from the first body line, and the description from the body without its signature.
+func captureTaskText(email *inboundEmail) (title, description string) {
+	title = email.Subject
+	for forwardPrefix.MatchString(title) {
+		title = forwardPrefix.ReplaceAllString(title, "")
+	}
+	body := strings.ReplaceAll(email.Text, "\r\n", "\n")
+	if loc := signatureDelimiter.FindStringIndex(body); loc != nil {
+		body = body[:loc[0]]
+	}
+	body = strings.TrimSpace(body)
+	title = strings.TrimSpace(title)
+	if title == "" {
+		for _, line := range strings.Split(body, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				title = truncateRunes(line, 120)
+				break
+			}
+		}
+	}
+	if title == "" {
+		title = "Email from " + email.From
+	}
+	return title, truncateRunes(body, maxCaptureDescription)
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// inboundEmail is the part of a parsed message that capture uses.
+type inboundEmail struct {
+	From        string
+	Subject     string
+	MessageID   string
+	Recipients  []string
+	Text        string // text/plain body, or the HTML body as text
+	Attachments []EmailAttachment
+}
+
+var headerDecoder = &mime.WordDecoder{CharsetReader: latin1CharsetReader}
+
+// parseInboundEmail reads a raw RFC 5322 message.
+func parseInboundEmail(r io.Reader) (*inboundEmail, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	email := &inboundEmail{MessageID: strings.Trim(msg.Header.Get("Message-Id"), "<> ")}
+	if subject, err := headerDecoder.DecodeHeader(msg.Header.Get("Subject")); err == nil {
+		email.Subject = subject
+	} else {
+		email.Subject = msg.Header.Get("Subject")
+	}
+	if from, err := msg.Header.AddressList("From"); err == nil && len(from) > 0 {
+		email.From = from[0].Address
+	}
+	for _, h := range []string{"Delivered-To", "X-Original-To", "To", "Cc"} {
+		for _, v := range msg.Header[textproto.CanonicalMIMEHeaderKey(h)] {
+			list, err := mail.ParseAddressList(v)
+			if err != nil {
+				continue
+			}
+			for _, a := range list {
+				email.Recipients = append(email.Recipients, a.Address)
+			}
+		}
+	}
+
+	var plain, htmlBody string
+	if err := walkMIMEPart(textproto.MIMEHeader(msg.Header), msg.Body, email, &plain, &htmlBody, 0); err != nil {
+		return nil, err
+	}
+	email.Text = plain
+	if strings.TrimSpace(email.Text) == "" && htmlBody != "" {
+		email.Text = htmlToText(htmlBody)
+	}
+	return email, nil
+}
+
+// walkMIMEPart collects the first text/plain and text/html bodies and the metadata of
+// attachments.
+func walkMIMEPart(h textproto.MIMEHeader, body io.Reader, email *inboundEmail, plain, htmlBody *string, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxMIMEDepth || params["boundary"] == "" {
+			return nil
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkMIMEPart(part.Header, part, email, plain, htmlBody, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	decoded := decodeTransferEncoding(body, h.Get("Content-Transfer-Encoding"))
+	disposition, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if decodedName, err := headerDecoder.DecodeHeader(filename); err == nil {
+		filename = decodedName
+	}
+	if mediaType == "message/rfc822" && filename == "" {
+		filename = "message.eml"
+	}
+	if disposition == "attachment" || filename != "" {
+		size, _ := io.Copy(io.Discard, decoded)
+		if filename == "" {
+			filename = "attachment"
+		}
+		email.Attachments = append(email.Attachments, EmailAttachment{Filename: filename, ContentType: mediaType, Size: size})
+		return nil
+	}
+
+	switch {
+	case mediaType == "text/plain" && *plain == "":
+		*plain = readTextPart(decoded, params["charset"])
+	case mediaType == "text/html" && *htmlBody == "":
+		*htmlBody = readTextPart(decoded, params["charset"])
+	default:
+		io.Copy(io.Discard, decoded)
+	}
+	return nil
+}
+
+func decodeTransferEncoding(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+func readTextPart(r io.Reader, charset string) string {
+	b, _ := io.ReadAll(io.LimitReader(r, maxCapturedBodyBytes))
+	if isLatin1(charset) {
+		return latin1ToUTF8(b)
+	}
+	return strings.ToValidUTF8(string(b), "�")
+}
+
+// Latin-1 and its Windows superset are the common non-UTF-8 charsets in mail; others
+// are passed through with invalid bytes replaced.
+func isLatin1(charset string) bool {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "cp1252":
+		return true
+	}
+	return false
+}
+
+func latin1ToUTF8(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func latin1CharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	if !isLatin1(charset) {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	b, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	return strings.NewReader(latin1ToUTF8(b)), nil
+}
+
+var (
+	htmlDropBlocks = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	htmlLineBreaks = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|h[1-6])>`)
+	htmlTags       = regexp.MustCompile(`<[^>]*>`)
+	blankLines     = regexp.MustCompile(`\n[ \t]*(\n[ \t]*)+`)
+)
+
+// htmlToText reduces an HTML body to readable text for HTML-only messages.
+func htmlToText(s string) string {
+	s = htmlDropBlocks.ReplaceAllString(s, "")
+	s = htmlLineBreaks.ReplaceAllString(s, "\n")
+	s = htmlTags.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,116 @@
+package encoreapp
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const forwardedEmail = "From: Ada Lovelace <ada@example.com>\r\n" +
+	"To: 3f9a1c@in.example.org\r\n" +
+	"Cc: Bob <bob@example.com>\r\n" +
+	"Subject: =?UTF-8?Q?Fwd:_Angebot_f=C3=BCr_M=C3=BCller?=\r\n" +
+	"Message-ID: <abc123@mail.example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Please review the offer by Friday.=0A=0AThanks\r\n" +
+	"-- \r\n" +
+	"Ada\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=UTF-8\r\n" +
+	"\r\n" +
+	"<p>Please review the offer by Friday.</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"offer.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"offer.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--outer--\r\n"
+
+func TestParseInboundEmail(t *testing.T) {
+	email, err := parseInboundEmail(strings.NewReader(forwardedEmail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Subject != "Fwd: Angebot für Müller" || email.From != "ada@example.com" || email.MessageID != "abc123@mail.example.com" {
+		t.Errorf("headers: %+v", email)
+	}
+	if len(email.Recipients) != 2 || email.Recipients[0] != "3f9a1c@in.example.org" {
+		t.Errorf("recipients = %v", email.Recipients)
+	}
+	if !strings.HasPrefix(email.Text, "Please review the offer by Friday.\n\nThanks") {
+		t.Errorf("text = %q", email.Text)
+	}
+	if len(email.Attachments) != 1 || email.Attachments[0] != (EmailAttachment{Filename: "offer.pdf", ContentType: "application/pdf", Size: 9}) {
+		t.Errorf("attachments = %+v", email.Attachments)
+	}
+
+	title, description := captureTaskText(email)
+	if title != "Angebot für Müller" {
+		t.Errorf("title = %q", title)
+	}
+	if description != "Please review the offer by Friday.\n\nThanks" {
+		t.Errorf("description = %q", description)
+	}
+}
+
+func TestParseInboundEmailHTMLOnly(t *testing.T) {
+	raw := "From: a@example.com\r\nSubject: \r\nContent-Type: text/html; charset=iso-8859-1\r\n\r\n" +
+		"<html><head><style>p{}</style></head><body><p>Call  the\xe9 plumber</p><p>Tom &amp; Jerry</p></body></html>"
+	email, err := parseInboundEmail(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Text != "Call theé plumber\nTom & Jerry" {
+		t.Errorf("text = %q", email.Text)
+	}
+	if title, _ := captureTaskText(email); title != "Call theé plumber" {
+		t.Errorf("title = %q", title)
+	}
+}
+
+func TestCaptureTokenFromAddress(t *testing.T) {
+	cases := []struct {
+		addr, token string
+		ok          bool
+	}{
+		{"3F9A1C@in.example.org", "3f9a1c", true},
+		{"Inbox <3f9a1c+work@IN.example.org>", "3f9a1c", true},
+		{"3f9a1c@example.org", "", false},
+		{"@in.example.org", "", false},
+	}
+	for _, c := range cases {
+		token, ok := captureTokenFromAddress(c.addr, "in.example.org")
+		if token != c.token || ok != c.ok {
+			t.Errorf("%q: got %q, %v", c.addr, token, ok)
+		}
+	}
+}
+
+func TestReadInboundRequestForm(t *testing.T) {
+	form := url.Values{"recipient": {"3f9a1c@in.example.org"}, "body-mime": {forwardedEmail}}
+	req := httptest.NewRequest("POST", "/api/inbound/email", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	raw, to, err := readInboundRequest(req)
+	if err != nil || to != "3f9a1c@in.example.org" || string(raw) != forwardedEmail {
+		t.Errorf("got %q, %v", to, err)
+	}
+
+	req = httptest.NewRequest("POST", "/api/inbound/email?to=x@in.example.org", strings.NewReader(forwardedEmail))
+	req.Header.Set("Content-Type", "message/rfc822")
+	raw, to, err = readInboundRequest(req)
+	if err != nil || to != "x@in.example.org" || string(raw) != forwardedEmail {
+		t.Errorf("raw body: got %q, %v", to, err)
+	}
+}
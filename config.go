@@ -3,6 +3,7 @@ package encoreapp
 import (
 	"log"
 	"os"
+	"sync"
 )
 
 // Centralized configuration secrets for the app
@@ -11,6 +12,34 @@ var secrets struct {
 	MONGODB_URI              string
 	FIREBASE_SERVICE_ACCOUNT string
 	SERVER_ENV               string
+	LLM_BASE_URL             string // OpenAI-compatible API root; defaults to Groq
+	LLM_MODEL                string
+	LLM_CASSETTE_MODE        string // "record" or "replay" LLM calls, see llm.go
+	LLM_CASSETTE_DIR         string
+	AI_PLAN_QUOTAS           string // JSON overrides of the daily quotas in usage.go
+	EMBEDDING_BASE_URL       string // OpenAI-compatible embeddings API; local hashing if empty
+	EMBEDDING_MODEL          string
+	EMBEDDING_API_KEY        string
+	REMINDER_NOTIFIERS       string // comma-separated: log, fcm, email, webhook; "log" if empty
+	REMINDER_WEBHOOK_URL     string
+	REMINDER_WEBHOOK_SECRET  string // signs webhook bodies (X-Signature: sha256=<hex HMAC>)
+	SMTP_HOST                string
+	SMTP_PORT                string
+	SMTP_USERNAME            string
+	SMTP_PASSWORD            string
+	SMTP_FROM                string
+	MAIL_SENDER              string // "smtp" or "file"; smtp when SMTP_HOST is set
+	MAIL_DROP_DIR            string // where the file sender writes .eml files
+	CAPTURE_EMAIL_DOMAIN     string // domain of the per-user capture addresses
+	CAPTURE_INBOUND_SECRET   string // shared with the inbound mail relay, see capture.go
+}
+
+var servicesOnce sync.Once
+
+// ensureServices initializes services once for code that doesn't run behind GetUser,
+// such as cron-triggered endpoints on a freshly started instance.
+func ensureServices() {
+	servicesOnce.Do(func() { InitializeServices() })
 }
 
 // Initialize all services
@@ -22,6 +51,26 @@ func InitializeServices() error {
 	secrets.MONGODB_URI = os.Getenv("MONGODB_URI")
 	secrets.FIREBASE_SERVICE_ACCOUNT = os.Getenv("FIREBASE_SERVICE_ACCOUNT")
 	secrets.SERVER_ENV = os.Getenv("SERVER_ENV")
+	secrets.LLM_BASE_URL = os.Getenv("LLM_BASE_URL")
+	secrets.LLM_MODEL = os.Getenv("LLM_MODEL")
+	secrets.LLM_CASSETTE_MODE = os.Getenv("LLM_CASSETTE_MODE")
+	secrets.LLM_CASSETTE_DIR = os.Getenv("LLM_CASSETTE_DIR")
+	secrets.AI_PLAN_QUOTAS = os.Getenv("AI_PLAN_QUOTAS")
+	secrets.EMBEDDING_BASE_URL = os.Getenv("EMBEDDING_BASE_URL")
+	secrets.EMBEDDING_MODEL = os.Getenv("EMBEDDING_MODEL")
+	secrets.EMBEDDING_API_KEY = os.Getenv("EMBEDDING_API_KEY")
+	secrets.REMINDER_NOTIFIERS = os.Getenv("REMINDER_NOTIFIERS")
+	secrets.REMINDER_WEBHOOK_URL = os.Getenv("REMINDER_WEBHOOK_URL")
+	secrets.REMINDER_WEBHOOK_SECRET = os.Getenv("REMINDER_WEBHOOK_SECRET")
+	secrets.SMTP_HOST = os.Getenv("SMTP_HOST")
+	secrets.SMTP_PORT = os.Getenv("SMTP_PORT")
+	secrets.SMTP_USERNAME = os.Getenv("SMTP_USERNAME")
+	secrets.SMTP_PASSWORD = os.Getenv("SMTP_PASSWORD")
+	secrets.SMTP_FROM = os.Getenv("SMTP_FROM")
+	secrets.MAIL_SENDER = os.Getenv("MAIL_SENDER")
+	secrets.MAIL_DROP_DIR = os.Getenv("MAIL_DROP_DIR")
+	secrets.CAPTURE_EMAIL_DOMAIN = os.Getenv("CAPTURE_EMAIL_DOMAIN")
+	secrets.CAPTURE_INBOUND_SECRET = os.Getenv("CAPTURE_INBOUND_SECRET")
 
 	if secrets.SERVER_ENV == "" {
 		secrets.SERVER_ENV = "development" // Default to development
@@ -0,0 +1,661 @@
+package encoreapp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Deterministic natural-language date parsing, used before calling the model and to
+// validate the dueDate it returns. All results are in the user's time zone.
+//
+// Conventions:
+//   - "friday" / "this friday" is the next Friday on or after tomorrow (today for "this").
+//   - "next friday" is the Friday of next week (weeks start on Monday).
+//   - "end of week" is Friday, "this weekend" is Saturday.
+//   - a time of day that has already passed today with no date means tomorrow.
+
+// naturalDate is a date expression found in text.
+type naturalDate struct {
+	Time    time.Time
+	HasTime bool   // false when only a calendar day was given
+	Text    string // the matched expression
+}
+
+type dateParser struct {
+	now      time.Time
+	dayFirst bool // numeric dates are day/month instead of month/day
+	whole    bool // the text is only a date, so ambiguous words need no cue
+}
+
+var weekdayWords = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// Abbreviations that are also ordinary words ("sun cream", "I sat"), and the month "may".
+// They only count as dates next to a cue, see dateParser.cued.
+var ambiguousDateWords = map[string]bool{
+	"sun": true, "mon": true, "tue": true, "tues": true, "wed": true, "thu": true,
+	"thur": true, "thurs": true, "fri": true, "sat": true, "may": true,
+}
+
+// Words that announce a date when they directly precede one.
+var dateCueWords = map[string]bool{
+	"on": true, "by": true, "due": true, "until": true, "till": true, "before": true,
+	"this": true, "next": true, "starting": true, "start": true, "beginning": true, "from": true,
+}
+
+var monthWords = map[string]time.Month{
+	"january": time.January, "jan": time.January,
+	"february": time.February, "feb": time.February,
+	"march": time.March, "mar": time.March,
+	"april": time.April, "apr": time.April,
+	"may":  time.May,
+	"june": time.June, "jun": time.June,
+	"july": time.July, "jul": time.July,
+	"august": time.August, "aug": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September,
+	"october": time.October, "oct": time.October,
+	"november": time.November, "nov": time.November,
+	"december": time.December, "dec": time.December,
+}
+
+var numberWords = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6,
+	"seven": 7, "eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12,
+}
+
+// parseNaturalDate parses text that consists entirely of a date expression,
+// e.g. "tomorrow 3pm", "next Friday", "in 2 weeks" or "end of month".
+func parseNaturalDate(text string, clock userClock) (time.Time, bool) {
+	return clock.parser().parse(text)
+}
+
+// findDateExpression returns the first date expression inside free text.
+func findDateExpression(text string, clock userClock) (naturalDate, bool) {
+	all := clock.parser().findAll(text)
+	if len(all) == 0 {
+		return naturalDate{}, false
+	}
+	return all[0], true
+}
+
+func (p dateParser) parse(text string) (time.Time, bool) {
+	text = strings.TrimSpace(text)
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t, true
+	}
+	if t, err := time.ParseInLocation("2006-01-02", text, p.now.Location()); err == nil {
+		return t, true
+	}
+	tokens := tokenizeDateText(text)
+	if len(tokens) == 0 {
+		return time.Time{}, false
+	}
+	p.whole = true
+	res, n := p.parseAt(tokens, 0)
+	if n != len(tokens) {
+		return time.Time{}, false
+	}
+	return res.Time, true
+}
+
+// findAll returns the non-overlapping date expressions in text, in order.
+func (p dateParser) findAll(text string) []naturalDate {
+	tokens := tokenizeDateText(text)
+	var found []naturalDate
+	for i := 0; i < len(tokens); i++ {
+		if res, n := p.parseAt(tokens, i); n > 0 {
+			res.Text = strings.Join(tokens[i:i+n], " ")
+			found = append(found, res)
+			i += n - 1
+		}
+	}
+	return found
+}
+
+// cued reports whether the date word at tokens[i] is next to something that makes it a
+// date: a cue word before it, or a time of day right before or after it.
+func (p dateParser) cued(tokens []string, i int) bool {
+	if p.whole {
+		return true
+	}
+	if i > 0 && dateCueWords[tokens[i-1]] {
+		return true
+	}
+	for k := 1; k <= 3 && k <= i; k++ {
+		if _, _, n := p.timePart(tokens, i-k); n == k {
+			return true
+		}
+	}
+	_, _, n := p.timePart(tokens, i+1)
+	return n > 0
+}
+
+func tokenizeDateText(text string) []string {
+	fields := strings.Fields(strings.ToLower(text))
+	tokens := make([]string, 0, len(fields))
+	for _, f := range fields {
+		f = strings.Trim(f, ",.!?;()\"'")
+		if f != "" {
+			tokens = append(tokens, f)
+		}
+	}
+	return tokens
+}
+
+func (p dateParser) today() time.Time {
+	return startOfDay(p.now)
+}
+
+// startOfDay returns midnight of t's calendar day in t's location.
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// parseAt parses a date and/or time starting at tokens[i] and returns how many tokens it used.
+func (p dateParser) parseAt(tokens []string, i int) (naturalDate, int) {
+	start := i
+	// Connectors are only consumed when a date follows them
+	if i < len(tokens) && (tokens[i] == "on" || tokens[i] == "by" || tokens[i] == "due" || tokens[i] == "starting") {
+		if _, _, n := p.datePart(tokens, i+1); n > 0 {
+			i++
+		}
+	}
+
+	if day, exact, n := p.datePart(tokens, i); n > 0 {
+		i += n
+		if exact {
+			return naturalDate{Time: day, HasTime: true}, i - start
+		}
+		if h, m, tn := p.timePart(tokens, i); tn > 0 {
+			return naturalDate{Time: day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute), HasTime: true}, i + tn - start
+		}
+		return naturalDate{Time: day}, i - start
+	}
+
+	if h, m, tn := p.timePart(tokens, i); tn > 0 {
+		i += tn
+		if day, exact, n := p.datePart(tokens, i); n > 0 && !exact {
+			return naturalDate{Time: day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute), HasTime: true}, i + n - start
+		}
+		t := p.today().Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute)
+		if t.Before(p.now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return naturalDate{Time: t, HasTime: true}, i - start
+	}
+	return naturalDate{}, 0
+}
+
+// datePart parses a calendar day. exact is set when the expression also fixes the time
+// (e.g. "in 2 hours", "tonight").
+func (p dateParser) datePart(tokens []string, i int) (day time.Time, exact bool, n int) {
+	if i >= len(tokens) {
+		return time.Time{}, false, 0
+	}
+	today := p.today()
+	tok := tokens[i]
+	next := func(k int) string {
+		if i+k < len(tokens) {
+			return tokens[i+k]
+		}
+		return ""
+	}
+
+	switch tok {
+	case "today":
+		return today, false, 1
+	case "tonight":
+		return today.Add(20 * time.Hour), true, 1
+	case "tomorrow", "tmrw", "tmr":
+		return today.AddDate(0, 0, 1), false, 1
+	case "eod":
+		return today.Add(23*time.Hour + 59*time.Minute), true, 1
+	case "eow":
+		return p.endOfWeek(), false, 1
+	case "eom":
+		return endOfMonth(today), false, 1
+	case "day":
+		if next(1) == "after" && next(2) == "tomorrow" {
+			return today.AddDate(0, 0, 2), false, 3
+		}
+	case "this":
+		if wd, ok := weekdayWords[next(1)]; ok {
+			return nextWeekday(today, wd, true), false, 2
+		}
+		if next(1) == "weekend" {
+			return nextWeekday(today, time.Saturday, true), false, 2
+		}
+	case "next":
+		if wd, ok := weekdayWords[next(1)]; ok {
+			return mondayOf(today).AddDate(0, 0, 7+weekdayOffset(wd)), false, 2
+		}
+		switch next(1) {
+		case "week":
+			return mondayOf(today).AddDate(0, 0, 7), false, 2
+		case "month":
+			return time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location()), false, 2
+		case "year":
+			return time.Date(today.Year()+1, time.January, 1, 0, 0, 0, 0, today.Location()), false, 2
+		}
+	case "end":
+		k := 1
+		if next(k) == "of" {
+			k++
+		}
+		if next(k) == "the" {
+			k++
+		}
+		switch next(k) {
+		case "day":
+			return today.Add(23*time.Hour + 59*time.Minute), true, k + 1
+		case "week":
+			return p.endOfWeek(), false, k + 1
+		case "month":
+			return endOfMonth(today), false, k + 1
+		case "year":
+			return time.Date(today.Year(), time.December, 31, 0, 0, 0, 0, today.Location()), false, k + 1
+		}
+	case "in":
+		if d, ex, k := p.relative(tokens, i+1); k > 0 {
+			return d, ex, k + 1
+		}
+	}
+
+	if wd, ok := weekdayWords[tok]; ok && (!ambiguousDateWords[tok] || p.cued(tokens, i)) {
+		return nextWeekday(today, wd, false), false, 1
+	}
+	// "2 days from now", "3 weeks later"
+	if d, ex, k := p.relative(tokens, i); k > 0 && (next(k) == "from" && next(k+1) == "now") {
+		return d, ex, k + 2
+	} else if k > 0 && next(k) == "later" {
+		return d, ex, k + 1
+	}
+	if t, err := time.Parse(time.RFC3339, tok); err == nil {
+		return t.In(p.now.Location()), true, 1
+	}
+	if t, err := time.ParseInLocation("2006-01-02", tok, p.now.Location()); err == nil {
+		return t, false, 1
+	}
+	if d, ok := p.numericDate(tok); ok {
+		return d, false, 1
+	}
+	return p.monthDayDate(tokens, i)
+}
+
+// relative parses "<n> <unit>" as an offset from now.
+func (p dateParser) relative(tokens []string, i int) (time.Time, bool, int) {
+	if i+1 >= len(tokens) {
+		return time.Time{}, false, 0
+	}
+	n, ok := numberWords[tokens[i]]
+	if !ok {
+		v, err := strconv.Atoi(tokens[i])
+		if err != nil || v < 0 {
+			return time.Time{}, false, 0
+		}
+		n = v
+	}
+	today := p.today()
+	switch strings.TrimSuffix(tokens[i+1], "s") {
+	case "minute", "min":
+		return p.now.Add(time.Duration(n) * time.Minute).Truncate(time.Minute), true, 2
+	case "hour", "hr":
+		return p.now.Add(time.Duration(n) * time.Hour).Truncate(time.Minute), true, 2
+	case "day":
+		return today.AddDate(0, 0, n), false, 2
+	case "week", "wk":
+		return today.AddDate(0, 0, 7*n), false, 2
+	case "month":
+		return today.AddDate(0, n, 0), false, 2
+	case "year":
+		return today.AddDate(n, 0, 0), false, 2
+	}
+	return time.Time{}, false, 0
+}
+
+// numericDate parses "6/12" or "6/12/2026" (month first unless dayFirst).
+func (p dateParser) numericDate(tok string) (time.Time, bool) {
+	parts := strings.Split(tok, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return time.Time{}, false
+	}
+	nums := make([]int, len(parts))
+	for i, s := range parts {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return time.Time{}, false
+		}
+		nums[i] = v
+	}
+	month, day := nums[0], nums[1]
+	if p.dayFirst {
+		month, day = day, month
+	}
+	year := -1
+	if len(nums) == 3 {
+		year = nums[2]
+		if year < 100 {
+			year += 2000
+		}
+	}
+	return p.calendarDate(year, time.Month(month), day)
+}
+
+// monthDayDate parses "june 12", "june 12th 2026", "12 june" and "12th of june".
+func (p dateParser) monthDayDate(tokens []string, i int) (time.Time, bool, int) {
+	at := func(k int) string {
+		if i+k < len(tokens) {
+			return tokens[i+k]
+		}
+		return ""
+	}
+	var month time.Month
+	var day, n int
+	if m, ok := monthWords[at(0)]; ok {
+		d, ok := parseOrdinal(at(1))
+		if !ok {
+			return time.Time{}, false, 0
+		}
+		// "I may 5 go" is not May 5: in free text an ambiguous month needs a cue, an
+		// ordinal ("may 5th"), a year or a time after the day.
+		if ambiguousDateWords[at(0)] && !p.cued(tokens, i) && !isOrdinalWord(at(1)) && !isYearWord(at(2)) {
+			if _, _, tn := p.timePart(tokens, i+2); tn == 0 {
+				return time.Time{}, false, 0
+			}
+		}
+		month, day, n = m, d, 2
+	} else if d, ok := parseOrdinal(at(0)); ok {
+		k := 1
+		if at(k) == "of" {
+			k++
+		}
+		m, ok := monthWords[at(k)]
+		if !ok {
+			return time.Time{}, false, 0
+		}
+		if ambiguousDateWords[at(k)] && k == 1 && !isOrdinalWord(at(0)) && !isYearWord(at(2)) && !p.cued(tokens, i) {
+			return time.Time{}, false, 0
+		}
+		month, day, n = m, d, k+1
+	} else {
+		return time.Time{}, false, 0
+	}
+	year := -1
+	if y, err := strconv.Atoi(at(n)); err == nil && isYearWord(at(n)) {
+		year = y
+		n++
+	}
+	d, ok := p.calendarDate(year, month, day)
+	if !ok {
+		return time.Time{}, false, 0
+	}
+	return d, false, n
+}
+
+// calendarDate builds a date; without a year it picks the next occurrence from today.
+func (p dateParser) calendarDate(year int, month time.Month, day int) (time.Time, bool) {
+	if month < time.January || month > time.December || day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	today := p.today()
+	y := year
+	if y < 0 {
+		y = today.Year()
+	}
+	d := time.Date(y, month, day, 0, 0, 0, 0, today.Location())
+	if d.Month() != month {
+		return time.Time{}, false // e.g. February 30
+	}
+	if year < 0 && d.Before(today) {
+		d = d.AddDate(1, 0, 0)
+	}
+	return d, true
+}
+
+// timePart parses a time of day such as "3pm", "at 15:30", "3:30 pm" or "noon".
+func (p dateParser) timePart(tokens []string, i int) (hour, minute, n int) {
+	if i >= len(tokens) {
+		return 0, 0, 0
+	}
+	at := false
+	if tokens[i] == "at" || tokens[i] == "@" {
+		at = true
+		i++
+		n++
+		if i >= len(tokens) {
+			return 0, 0, 0
+		}
+	}
+	switch tokens[i] {
+	case "noon", "midday":
+		return 12, 0, n + 1
+	case "midnight":
+		return 0, 0, n + 1
+	case "morning":
+		return 9, 0, n + 1
+	case "afternoon":
+		return 15, 0, n + 1
+	case "evening":
+		return 19, 0, n + 1
+	}
+
+	tok := tokens[i]
+	suffix := ""
+	for _, s := range []string{"am", "pm", "a.m", "p.m", "a.m.", "p.m."} {
+		if strings.HasSuffix(tok, s) && len(tok) > len(s) {
+			suffix = s[:1]
+			tok = strings.TrimSuffix(tok, s)
+			break
+		}
+	}
+	used := 1
+	if suffix == "" && i+1 < len(tokens) {
+		switch tokens[i+1] {
+		case "am", "a.m", "a.m.":
+			suffix, used = "a", 2
+		case "pm", "p.m", "p.m.":
+			suffix, used = "p", 2
+		}
+	}
+
+	h, m, ok := parseClock(tok)
+	if !ok {
+		return 0, 0, 0
+	}
+	switch suffix {
+	case "a", "p":
+		if h < 1 || h > 12 {
+			return 0, 0, 0
+		}
+		if suffix == "p" && h != 12 {
+			h += 12
+		}
+		if suffix == "a" && h == 12 {
+			h = 0
+		}
+	default:
+		// A bare number is only a time after "at" ("at 3") or in 24h form ("15:00")
+		if !at && !strings.Contains(tok, ":") {
+			return 0, 0, 0
+		}
+		if !strings.Contains(tok, ":") && h >= 1 && h <= 7 {
+			h += 12
+		}
+	}
+	if h > 23 || m > 59 {
+		return 0, 0, 0
+	}
+	return h, m, n + used
+}
+
+func parseClock(s string) (int, int, bool) {
+	s = strings.Replace(s, ".", ":", 1)
+	hs, ms, hasMin := strings.Cut(s, ":")
+	h, err := strconv.Atoi(hs)
+	if err != nil || h < 0 {
+		return 0, 0, false
+	}
+	m := 0
+	if hasMin {
+		if len(ms) != 2 {
+			return 0, 0, false
+		}
+		m, err = strconv.Atoi(ms)
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return h, m, true
+}
+
+func isYearWord(s string) bool {
+	y, err := strconv.Atoi(s)
+	return err == nil && y >= 1000 && y <= 9999
+}
+
+// isOrdinalWord reports whether s is a day number with a suffix, like "5th".
+func isOrdinalWord(s string) bool {
+	for _, suf := range []string{"st", "nd", "rd", "th"} {
+		if strings.HasSuffix(s, suf) {
+			_, ok := parseOrdinal(s)
+			return ok
+		}
+	}
+	return false
+}
+
+func parseOrdinal(s string) (int, bool) {
+	for _, suf := range []string{"st", "nd", "rd", "th"} {
+		s = strings.TrimSuffix(s, suf)
+	}
+	d, err := strconv.Atoi(s)
+	if err != nil || d < 1 || d > 31 {
+		return 0, false
+	}
+	return d, true
+}
+
+// nextWeekday returns the next wd after day, or day itself when includeToday is set.
+func nextWeekday(day time.Time, wd time.Weekday, includeToday bool) time.Time {
+	diff := (int(wd) - int(day.Weekday()) + 7) % 7
+	if diff == 0 && !includeToday {
+		diff = 7
+	}
+	return day.AddDate(0, 0, diff)
+}
+
+// weekdayOffset is the number of days from Monday to wd.
+func weekdayOffset(wd time.Weekday) int {
+	return (int(wd) + 6) % 7
+}
+
+func mondayOf(day time.Time) time.Time {
+	return day.AddDate(0, 0, -weekdayOffset(day.Weekday()))
+}
+
+func (p dateParser) endOfWeek() time.Time {
+	return nextWeekday(p.today(), time.Friday, true)
+}
+
+func endOfMonth(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month()+1, 0, 0, 0, 0, 0, day.Location())
+}
+
+// reconcileDueDate validates the model's dueDate against the expressions in the user's
+// prompt. The model's date is kept when any of them agrees with it; otherwise the first
+// expression wins. With no expression in the prompt the model's date is kept if it
+// parses, otherwise the task gets no due date ("").
+func reconcileDueDate(modelDate string, prompt string, clock userClock) (string, bool) {
+	modelTime, modelErr := parseTaskDate(modelDate, clock)
+	found := clock.parser().findAll(prompt)
+	if len(found) == 0 {
+		if modelErr != nil {
+			return "", modelDate != ""
+		}
+		return modelTime.Format(time.RFC3339), false
+	}
+	if modelErr == nil {
+		for _, local := range found {
+			sameDay := startOfDay(modelTime.In(clock.Location())).Equal(startOfDay(local.Time))
+			if sameDay && (!local.HasTime || modelTime.Equal(local.Time)) {
+				return modelTime.Format(time.RFC3339), false
+			}
+		}
+	}
+	return found[0].Time.Format(time.RFC3339), true
+}
+
+// withDateHint appends the locally resolved date expression to a prompt so the model
+// doesn't have to do date arithmetic itself.
+func withDateHint(prompt string, clock userClock) string {
+	hint, ok := findDateExpression(prompt, clock)
+	if !ok {
+		return prompt
+	}
+	return fmt.Sprintf("%s\n(Note: \"%s\" means %s)", prompt, hint.Text, hint.Time.Format(time.RFC3339))
+}
+
+// Phrases that introduce a start (defer) date rather than a deadline.
+var deferDateMarkers = [][]string{
+	{"starting"}, {"start"}, {"beginning"}, {"from"},
+	{"not", "before"}, {"defer", "until"}, {"deferred", "until"}, {"hide", "until"},
+}
+
+// splitDeferDate finds a start date such as "starting next Monday" in text. rest is the
+// text without it, in which the due date is then looked for.
+func splitDeferDate(text string, clock userClock) (start naturalDate, rest string, ok bool) {
+	p := clock.parser()
+	tokens := tokenizeDateText(text)
+	for i := range tokens {
+	markers:
+		for _, marker := range deferDateMarkers {
+			j := i + len(marker)
+			if j > len(tokens) {
+				continue
+			}
+			for k, word := range marker {
+				if tokens[i+k] != word {
+					continue markers
+				}
+			}
+			if res, n := p.parseAt(tokens, j); n > 0 {
+				res.Text = strings.Join(tokens[i:j+n], " ")
+				rest := append(append([]string{}, tokens[:i]...), tokens[j+n:]...)
+				return res, strings.Join(rest, " "), true
+			}
+		}
+	}
+	return naturalDate{}, text, false
+}
+
+// withTaskDateHints is withDateHint for task extraction, noting a start date separately
+// from the due date.
+func withTaskDateHints(text string, clock userClock) string {
+	start, rest, ok := splitDeferDate(text, clock)
+	if !ok {
+		return withDateHint(text, clock)
+	}
+	hinted := fmt.Sprintf("%s\n(Note: start date \"%s\" means %s)", text, start.Text, start.Time.Format(time.RFC3339))
+	if due, ok := findDateExpression(rest, clock); ok {
+		hinted += fmt.Sprintf("\n(Note: \"%s\" means %s)", due.Text, due.Time.Format(time.RFC3339))
+	}
+	return hinted
+}
+
+func logDueDateCorrection(userID primitive.ObjectID, modelDate string, resolved string) {
+	LogEvent("ai_due_date_corrected", userID.Hex(), map[string]interface{}{
+		"model":    modelDate,
+		"resolved": resolved,
+	})
+}
@@ -0,0 +1,133 @@
+package encoreapp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSplitDeferDate(t *testing.T) {
+	clock := userClock{Now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)} // a Monday
+	cases := []struct {
+		text, start, rest string
+	}{
+		{"Review the budget starting next Monday", "2026-03-09", "review the budget"},
+		{"Renew passport not before March 20, due April 1", "2026-03-20", "renew passport due april 1"},
+		{"Plan the offsite, defer until tomorrow", "2026-03-03", "plan the offsite"},
+	}
+	for _, c := range cases {
+		start, rest, ok := splitDeferDate(c.text, clock)
+		if !ok {
+			t.Errorf("%q: no start date found", c.text)
+			continue
+		}
+		if got := start.Time.Format("2006-01-02"); got != c.start || rest != c.rest {
+			t.Errorf("%q: got %s, %q; want %s, %q", c.text, got, rest, c.start, c.rest)
+		}
+	}
+
+	for _, text := range []string{"Start the quarterly report", "Email from Anna tomorrow", "Call mom tomorrow at 3pm"} {
+		if start, _, ok := splitDeferDate(text, clock); ok {
+			t.Errorf("%q: unexpected start date %v", text, start.Time)
+		}
+	}
+}
+
+func TestParseNaturalDate(t *testing.T) {
+	clock := userClock{Now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)} // a Monday
+	cases := []struct {
+		text, want string
+	}{
+		{"today", "2026-03-02 00:00"},
+		{"tomorrow 3pm", "2026-03-03 15:00"},
+		{"friday", "2026-03-06 00:00"},
+		{"monday", "2026-03-09 00:00"},
+		{"this monday", "2026-03-02 00:00"},
+		{"next friday", "2026-03-13 00:00"},
+		{"this weekend", "2026-03-07 00:00"},
+		{"end of week", "2026-03-06 00:00"},
+		{"end of month", "2026-03-31 00:00"},
+		{"next month", "2026-04-01 00:00"},
+		{"in 2 weeks", "2026-03-16 00:00"},
+		{"3 days from now", "2026-03-05 00:00"},
+		{"in 2 hours", "2026-03-02 11:00"},
+		{"tonight", "2026-03-02 20:00"},
+		{"8am", "2026-03-03 08:00"},
+		{"at 3", "2026-03-02 15:00"},
+		{"june 12", "2026-06-12 00:00"},
+		{"12th of june", "2026-06-12 00:00"},
+		{"feb 1", "2027-02-01 00:00"},
+		{"6/12", "2026-06-12 00:00"},
+		{"fri 3pm", "2026-03-06 15:00"},
+		{"by sat", "2026-03-07 00:00"},
+		{"sat", "2026-03-07 00:00"},
+		{"may 5", "2026-05-05 00:00"},
+		{"2026-04-01", "2026-04-01 00:00"},
+	}
+	for _, c := range cases {
+		got, ok := parseNaturalDate(c.text, clock)
+		if !ok || got.Format("2006-01-02 15:04") != c.want {
+			t.Errorf("%q: got %v (%v), want %s", c.text, got, ok, c.want)
+		}
+	}
+	for _, text := range []string{"", "soon", "february 30", "13/40"} {
+		if got, ok := parseNaturalDate(text, clock); ok {
+			t.Errorf("%q: unexpected date %v", text, got)
+		}
+	}
+
+	clock.Locale = "de-DE"
+	if got, ok := parseNaturalDate("6/12", clock); !ok || got.Format("2006-01-02") != "2026-12-06" {
+		t.Errorf("day-first 6/12: got %v", got)
+	}
+}
+
+func TestFindDateExpressionAmbiguousWords(t *testing.T) {
+	clock := userClock{Now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	cases := []struct {
+		text, want string // want "" when no date should be found
+	}{
+		{"Buy sun cream by next tuesday", "2026-03-10 00:00"},
+		{"Fix the chair I sat on", ""},
+		{"I may 5 go", ""},
+		{"Wed the plans together", ""},
+		{"Dentist on sat", "2026-03-07 00:00"},
+		{"Call mom fri 3pm", "2026-03-06 15:00"},
+		{"Submit the form by May 5", "2026-05-05 00:00"},
+		{"Party may 5th", "2026-05-05 00:00"},
+		{"Renew by 5 may", "2026-05-05 00:00"},
+		{"Pay rent friday", "2026-03-06 00:00"},
+	}
+	for _, c := range cases {
+		got, ok := findDateExpression(c.text, clock)
+		switch {
+		case c.want == "" && ok:
+			t.Errorf("%q: unexpected date %q (%v)", c.text, got.Text, got.Time)
+		case c.want != "" && (!ok || got.Time.Format("2006-01-02 15:04") != c.want):
+			t.Errorf("%q: got %v (%v), want %s", c.text, got.Time, ok, c.want)
+		}
+	}
+}
+
+func TestReconcileDueDate(t *testing.T) {
+	clock := userClock{Now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	cases := []struct {
+		model, prompt string
+		want          string
+		corrected     bool
+	}{
+		{"2026-03-10", "Buy sun cream by next tuesday", "2026-03-10T00:00:00Z", false},
+		{"2026-03-03", "Pay Bob on friday, remind me tomorrow", "2026-03-03T00:00:00Z", false},
+		{"2026-03-20", "Call mom friday", "2026-03-06T00:00:00Z", true},
+		{"2026-03-06T15:00:00Z", "Call mom friday at 3pm", "2026-03-06T15:00:00Z", false},
+		{"2026-03-06T10:00:00Z", "Call mom friday at 3pm", "2026-03-06T15:00:00Z", true},
+		{"2026-04-01", "Fix the chair I sat on", "2026-04-01T00:00:00Z", false},
+		{"not a date", "Water the plants", "", true},
+		{"", "Water the plants", "", false},
+	}
+	for _, c := range cases {
+		got, corrected := reconcileDueDate(c.model, c.prompt, clock)
+		if got != c.want || corrected != c.corrected {
+			t.Errorf("(%q, %q): got %s, %v; want %s, %v", c.model, c.prompt, got, corrected, c.want, c.corrected)
+		}
+	}
+}
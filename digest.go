@@ -0,0 +1,291 @@
+package encoreapp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"encore.dev/cron"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Email digest: a daily or weekly summary of what's due, overdue, waiting on others and
+// recently completed, sent at the user's chosen local time. A cron job checks for due
+// digests every five minutes.
+
+const (
+	defaultDigestTime   = "07:00"
+	digestSectionLimit  = 20
+	digestTaskFetchSize = 200
+)
+
+type DispatchDigestsResponse struct {
+	Sent int `json:"sent"`
+}
+
+var _ = cron.NewJob("dispatch-email-digests", cron.JobConfig{
+	Title:    "Send email digests",
+	Every:    5 * cron.Minute,
+	Endpoint: DispatchDigests,
+})
+
+// DispatchDigests sends the email digests that are due.
+// encore:api private method=POST path=/api/internal/digest/dispatch
+func DispatchDigests(ctx context.Context) (*DispatchDigestsResponse, error) {
+	ensureServices()
+	sent, err := dispatchEmailDigests(ctx, newMailSender(), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &DispatchDigestsResponse{Sent: sent}, nil
+}
+
+type digestItem struct {
+	Title  string
+	Detail string
+}
+
+type digestSection struct {
+	Title string
+	Items []digestItem
+	More  int // items left out over digestSectionLimit
+}
+
+type digestData struct {
+	Subject  string
+	Greeting string
+	Sections []digestSection
+}
+
+var digestTextTemplate = texttemplate.Must(texttemplate.New("digest.txt").Parse(`{{.Greeting}}
+{{range .Sections}}
+{{.Title}}
+{{range .Items}}- {{.Title}}{{if .Detail}} ({{.Detail}}){{end}}
+{{end}}{{if .More}}  and {{.More}} more
+{{end}}{{end}}
+You can change or turn off this digest in your profile settings.
+`))
+
+var digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest.html").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, Helvetica, Arial, sans-serif; color: #222; max-width: 560px;">
+<p>{{.Greeting}}</p>
+{{range .Sections}}<h3 style="margin: 20px 0 6px;">{{.Title}}</h3>
+<ul style="padding-left: 20px; margin: 0;">
+{{range .Items}}<li>{{.Title}}{{if .Detail}} <span style="color: #777;">({{.Detail}})</span>{{end}}</li>
+{{end}}{{if .More}}<li style="color: #777;">and {{.More}} more</li>
+{{end}}</ul>
+{{end}}<p style="color: #777; font-size: 12px; margin-top: 24px;">You can change or turn off this digest in your profile settings.</p>
+</body>
+</html>
+`))
+
+// renderDigest returns the plain-text and HTML bodies.
+func renderDigest(d digestData) (text, html string, err error) {
+	var tb, hb bytes.Buffer
+	if err := digestTextTemplate.Execute(&tb, d); err != nil {
+		return "", "", err
+	}
+	if err := digestHTMLTemplate.Execute(&hb, d); err != nil {
+		return "", "", err
+	}
+	return tb.String(), hb.String(), nil
+}
+
+// digestDue reports whether user should get a digest at clock.Now: the frequency is set,
+// it's Monday for weekly digests, the send time has passed and none was sent today.
+func digestDue(user User, clock userClock) bool {
+	switch user.DigestFrequency {
+	case "daily":
+	case "weekly":
+		if clock.Now.Weekday() != time.Monday {
+			return false
+		}
+	default:
+		return false
+	}
+	at := user.DigestTime
+	if at == "" {
+		at = defaultDigestTime
+	}
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		t, _ = time.Parse("15:04", defaultDigestTime)
+	}
+	today := clock.Today()
+	sendAt := time.Date(today.Year(), today.Month(), today.Day(), t.Hour(), t.Minute(), 0, 0, clock.Location())
+	return !clock.Now.Before(sendAt) && user.LastEmailDigestOn != today.Format("2006-01-02")
+}
+
+// dispatchEmailDigests sends the digests due at now. Each user is claimed by recording
+// today's date before sending, so concurrent workers don't send twice. The claim is
+// released when building or sending fails, so the next run retries.
+func dispatchEmailDigests(ctx context.Context, sender MailSender, now time.Time) (int, error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return 0, err
+	}
+	db := client.Database("gtd")
+	users := db.Collection("users")
+	cur, err := users.Find(ctx, bson.M{"digestFrequency": bson.M{"$in": []string{"daily", "weekly"}}, "email": bson.M{"$ne": ""}})
+	if err != nil {
+		return 0, err
+	}
+	var candidates []User
+	if err := cur.All(ctx, &candidates); err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, user := range candidates {
+		loc, ok := loadTimeZone(user.TimeZone)
+		if !ok {
+			loc = time.UTC
+		}
+		clock := userClock{Now: now.In(loc), Locale: user.Locale}
+		if !digestDue(user, clock) {
+			continue
+		}
+		today := clock.Today().Format("2006-01-02")
+		res, err := users.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "lastEmailDigestOn": bson.M{"$ne": today}},
+			bson.M{"$set": bson.M{"lastEmailDigestOn": today}},
+		)
+		if err != nil || res.ModifiedCount == 0 {
+			continue
+		}
+		data, err := buildDigest(ctx, db, user, clock)
+		if err == nil && len(data.Sections) == 0 {
+			continue // nothing to report
+		}
+		var text, html string
+		if err == nil {
+			text, html, err = renderDigest(data)
+		}
+		if err == nil {
+			err = sender.Send(ctx, Mail{To: user.Email, Subject: data.Subject, Text: text, HTML: html})
+		}
+		if err != nil {
+			LogEvent("digest_failed", user.ID.Hex(), map[string]interface{}{"error": err.Error()})
+			users.UpdateOne(ctx,
+				bson.M{"_id": user.ID, "lastEmailDigestOn": today},
+				bson.M{"$set": bson.M{"lastEmailDigestOn": user.LastEmailDigestOn}},
+			)
+			continue
+		}
+		LogEvent("digest_sent", user.ID.Hex(), map[string]interface{}{"frequency": user.DigestFrequency, "sections": digestSectionCounts(data)})
+		sent++
+	}
+	return sent, nil
+}
+
+// digestDueFilter selects the user's open tasks with a deadline in the range of a
+// bulkDueFilter keyword. The email and push digests count from it, so they agree;
+// waiting-for tasks have a section of their own.
+func digestDueFilter(userID primitive.ObjectID, due string, clock userClock) bson.M {
+	return bson.M{
+		"userId":     userID,
+		"completed":  false,
+		"trashed":    false,
+		"deferUntil": notDeferred(clock.Now),
+		"category":   bson.M{"$ne": "waiting"},
+		"dueDate":    bulkDueFilter(due, clock),
+	}
+}
+
+// buildDigest loads the user's sections. Daily digests cover today and yesterday's
+// completions; weekly ones the coming seven days and the past week's completions.
+func buildDigest(ctx context.Context, db *mongo.Database, user User, clock userClock) (digestData, error) {
+	tasksCol := db.Collection("tasks")
+	today := clock.Today()
+	weekly := user.DigestFrequency == "weekly"
+
+	dueKeyword, dueTitle, completedFrom, completedTitle := "today", "Due today", today.AddDate(0, 0, -1), "Completed yesterday"
+	subject := "Your day: " + today.Format("Mon 2 Jan")
+	if weekly {
+		dueKeyword, dueTitle, completedFrom, completedTitle = "thisWeek", "Due this week", today.AddDate(0, 0, -7), "Completed last week"
+		subject = "Your week: " + today.Format("2 Jan") + " – " + today.AddDate(0, 0, 6).Format("2 Jan")
+	}
+
+	dueFilter := digestDueFilter(user.ID, dueKeyword, clock)
+	overdueFilter := digestDueFilter(user.ID, "overdue", clock)
+	waitingFilter := bson.M{"userId": user.ID, "completed": false, "trashed": false, "deferUntil": notDeferred(clock.Now), "category": "waiting"}
+	completedFilter := bson.M{"userId": user.ID, "completed": true, "trashed": false, "completedAt": bson.M{"$gte": completedFrom, "$lt": today}}
+
+	queries := []struct {
+		title  string
+		filter bson.M
+		sort   bson.D
+		detail func(Task) string
+	}{
+		{"Overdue", overdueFilter, bson.D{{Key: "dueDate", Value: 1}}, func(t Task) string { return "due " + t.DueDate.In(clock.Location()).Format("Mon 2 Jan") }},
+		{dueTitle, dueFilter, bson.D{{Key: "dueDate", Value: 1}}, func(t Task) string { return digestDueDetail(*t.DueDate, clock, weekly) }},
+		{"Waiting for", waitingFilter, bson.D{{Key: "updatedAt", Value: 1}}, func(t Task) string { return t.DelegatedTo }},
+		{completedTitle, completedFilter, bson.D{{Key: "completedAt", Value: -1}}, func(Task) string { return "" }},
+	}
+
+	data := digestData{Subject: subject, Greeting: digestGreeting(user, weekly)}
+	for _, q := range queries {
+		cur, err := tasksCol.Find(ctx, q.filter, options.Find().SetSort(q.sort).SetLimit(digestTaskFetchSize))
+		if err != nil {
+			return digestData{}, err
+		}
+		var tasks []Task
+		if err := cur.All(ctx, &tasks); err != nil {
+			return digestData{}, err
+		}
+		section := digestSection{Title: q.title}
+		for _, t := range tasks {
+			if len(section.Items) == digestSectionLimit {
+				section.More++
+				continue
+			}
+			section.Items = append(section.Items, digestItem{Title: t.Title, Detail: q.detail(t)})
+		}
+		if len(section.Items) > 0 {
+			data.Sections = append(data.Sections, section)
+		}
+	}
+	return data, nil
+}
+
+func digestGreeting(user User, weekly bool) string {
+	name := strings.Fields(user.Name)
+	hello := "Hi"
+	if len(name) > 0 {
+		hello += " " + name[0]
+	}
+	if weekly {
+		return hello + ", here's your week."
+	}
+	return hello + ", here's your day."
+}
+
+// digestDueDetail shows the due time, and the weekday in weekly digests. Midnight due
+// dates are treated as date-only.
+func digestDueDetail(due time.Time, clock userClock, withDay bool) string {
+	local := due.In(clock.Location())
+	var parts []string
+	if withDay {
+		parts = append(parts, local.Format("Mon"))
+	}
+	if local.Hour() != 0 || local.Minute() != 0 {
+		parts = append(parts, local.Format("15:04"))
+	}
+	return strings.Join(parts, " ")
+}
+
+// digestSectionCounts summarises a digest for logging, e.g. "Overdue: 2, Due today: 3".
+func digestSectionCounts(d digestData) string {
+	var parts []string
+	for _, s := range d.Sections {
+		parts = append(parts, fmt.Sprintf("%s: %d", s.Title, len(s.Items)+s.More))
+	}
+	return strings.Join(parts, ", ")
+}
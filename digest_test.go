@@ -0,0 +1,244 @@
+package encoreapp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDigestDue(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	monday := func(h, m int) userClock {
+		return userClock{Now: time.Date(2026, 3, 2, h, m, 0, 0, berlin)}
+	}
+	cases := []struct {
+		name  string
+		user  User
+		clock userClock
+		want  bool
+	}{
+		{"off", User{}, monday(9, 0), false},
+		{"daily before default time", User{DigestFrequency: "daily"}, monday(6, 59), false},
+		{"daily at default time", User{DigestFrequency: "daily"}, monday(7, 0), true},
+		{"custom time", User{DigestFrequency: "daily", DigestTime: "18:30"}, monday(18, 0), false},
+		{"already sent", User{DigestFrequency: "daily", LastEmailDigestOn: "2026-03-02"}, monday(9, 0), false},
+		{"sent yesterday", User{DigestFrequency: "daily", LastEmailDigestOn: "2026-03-01"}, monday(9, 0), true},
+		{"weekly on monday", User{DigestFrequency: "weekly"}, monday(9, 0), true},
+		{"weekly on tuesday", User{DigestFrequency: "weekly"}, userClock{Now: time.Date(2026, 3, 3, 9, 0, 0, 0, berlin)}, false},
+	}
+	for _, c := range cases {
+		if got := digestDue(c.user, c.clock); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	data := digestData{
+		Subject:  "Your day: Mon 2 Mar",
+		Greeting: "Hi Ada, here's your day.",
+		Sections: []digestSection{
+			{Title: "Due today", Items: []digestItem{{Title: "Send <draft> to Bob", Detail: "14:00"}}},
+			{Title: "Waiting for", Items: []digestItem{{Title: "Contract", Detail: "Legal"}}, More: 3},
+		},
+	}
+	text, html, err := renderDigest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Hi Ada", "Due today\n- Send <draft> to Bob (14:00)\n", "- Contract (Legal)\n  and 3 more\n"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text body missing %q:\n%s", want, text)
+		}
+	}
+	if !strings.Contains(html, "Send &lt;draft&gt; to Bob") || strings.Contains(html, "<draft>") {
+		t.Errorf("HTML body not escaped:\n%s", html)
+	}
+	if !strings.Contains(html, "and 3 more") {
+		t.Errorf("HTML body missing overflow line:\n%s", html)
+	}
+}
+
+func TestDigestDueDetail(t *testing.T) {
+	clock := userClock{Now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	if got := digestDueDetail(time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC), clock, true); got != "Wed" {
+		t.Errorf("got %q, want Wed", got)
+	}
+	if got := digestDueDetail(time.Date(2026, 3, 2, 14, 0, 0, 0, time.UTC), clock, false); got != "14:00" {
+		t.Errorf("got %q, want 14:00", got)
+	}
+}
+
+func TestDigestDueFilter(t *testing.T) {
+	clock := userClock{Now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	userID := primitive.NewObjectID()
+	at := func(days, hour int) *time.Time {
+		d := time.Date(2026, 3, 2+days, hour, 0, 0, 0, time.UTC)
+		return &d
+	}
+	task := func(due *time.Time) Task {
+		return Task{UserID: userID, DueDate: due, Category: "next", CreatedAt: *at(-10, 9)}
+	}
+	waiting := task(at(-1, 12))
+	waiting.Category = "waiting"
+	done := task(at(0, 15))
+	done.Completed = true
+	deferred := task(at(-1, 12))
+	deferred.DeferUntil = at(1, 0)
+	cases := []struct {
+		name           string
+		task           Task
+		today, overdue bool
+	}{
+		{"due later today", task(at(0, 15)), true, false},
+		{"due yesterday", task(at(-1, 12)), false, true},
+		{"due tomorrow", task(at(1, 9)), false, false},
+		{"undated, created days ago", task(nil), false, false},
+		{"waiting for", waiting, false, false},
+		{"completed", done, false, false},
+		{"deferred", deferred, false, false},
+		{"someone else's", Task{UserID: primitive.NewObjectID(), DueDate: at(0, 15)}, false, false},
+	}
+	for _, c := range cases {
+		if got := matchesFilter(t, digestDueFilter(userID, "today", clock), c.task); got != c.today {
+			t.Errorf("%s: due today = %v, want %v", c.name, got, c.today)
+		}
+		if got := matchesFilter(t, digestDueFilter(userID, "overdue", clock), c.task); got != c.overdue {
+			t.Errorf("%s: overdue = %v, want %v", c.name, got, c.overdue)
+		}
+	}
+}
+
+// matchesFilter evaluates filter against doc the way Mongo would, for the operators the
+// task queries use, so they can be tested without a database. Missing fields only
+// match nil, $ne and $not conditions.
+func matchesFilter(t *testing.T, filter bson.M, doc interface{}) bool {
+	t.Helper()
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m bson.M
+	if err := bson.Unmarshal(raw, &m); err != nil {
+		t.Fatal(err)
+	}
+	return matchDocument(t, filter, m)
+}
+
+func matchDocument(t *testing.T, filter, doc bson.M) bool {
+	for key, cond := range filter {
+		switch key {
+		case "$and", "$or":
+			any, all := false, true
+			for _, sub := range cond.(bson.A) {
+				ok := matchDocument(t, sub.(bson.M), doc)
+				any, all = any || ok, all && ok
+			}
+			if (key == "$and" && !all) || (key == "$or" && !any) {
+				return false
+			}
+		default:
+			if strings.HasPrefix(key, "$") {
+				t.Fatalf("matchesFilter: unsupported operator %s", key)
+			}
+			if !matchValue(t, doc[key], cond) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func matchValue(t *testing.T, v, cond interface{}) bool {
+	ops, ok := cond.(bson.M)
+	if !ok {
+		return filterValuesEqual(v, cond)
+	}
+	for op, arg := range ops {
+		switch op {
+		case "$ne":
+			if filterValuesEqual(v, arg) {
+				return false
+			}
+		case "$not":
+			if matchValue(t, v, arg) {
+				return false
+			}
+		case "$in", "$nin":
+			found := false
+			for _, a := range arg.(bson.A) {
+				found = found || filterValuesEqual(v, a)
+			}
+			if found != (op == "$in") {
+				return false
+			}
+		case "$lt", "$lte", "$gt", "$gte":
+			c, ok := compareFilterValues(v, arg)
+			if !ok || (op == "$lt" && c >= 0) || (op == "$lte" && c > 0) || (op == "$gt" && c <= 0) || (op == "$gte" && c < 0) {
+				return false
+			}
+		default:
+			t.Fatalf("matchesFilter: unsupported operator %s", op)
+		}
+	}
+	return true
+}
+
+// normalizeFilterValue maps decoded documents and Go filter values onto comparable types.
+func normalizeFilterValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case primitive.DateTime:
+		return x.Time().UTC()
+	case time.Time:
+		return x.UTC().Truncate(time.Millisecond)
+	case *primitive.ObjectID:
+		if x == nil {
+			return nil
+		}
+		return *x
+	case int:
+		return float64(x)
+	case int32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	}
+	return v
+}
+
+func filterValuesEqual(a, b interface{}) bool {
+	a, b = normalizeFilterValue(a), normalizeFilterValue(b)
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	}
+	return a == b
+}
+
+func compareFilterValues(a, b interface{}) (int, bool) {
+	a, b = normalizeFilterValue(a), normalizeFilterValue(b)
+	switch x := a.(type) {
+	case time.Time:
+		y, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		return x.Compare(y), true
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,448 @@
+package encoreapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Tasks and projects are embedded lazily: vectors are stored in the "embeddings"
+// collection keyed by entity and model, and recomputed when the entity's text no longer
+// matches the stored hash. Writes refresh them in the background.
+
+// Embedder turns texts into vectors. Vectors of one model are comparable by cosine similarity.
+type Embedder interface {
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// Dimensions of the local hashing embedder.
+const hashingDims = 512
+
+// Texts per request to a remote embeddings API.
+const embeddingBatchSize = 64
+
+// Results below this similarity are not returned by semantic search.
+const semanticMinScore = 0.2
+
+// newEmbedder returns the configured embeddings API, or the local hashing embedder when
+// EMBEDDING_BASE_URL is not set.
+func newEmbedder() Embedder {
+	if secrets.EMBEDDING_BASE_URL == "" {
+		return hashingEmbedder{dims: hashingDims}
+	}
+	return &httpEmbedder{
+		baseURL: strings.TrimRight(secrets.EMBEDDING_BASE_URL, "/"),
+		apiKey:  secrets.EMBEDDING_API_KEY,
+		model:   secrets.EMBEDDING_MODEL,
+		http:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// hashingEmbedder hashes words and character trigrams into a fixed-size vector. It needs
+// no model and captures lexical overlap only, so it is meant as a fallback and for tests.
+type hashingEmbedder struct {
+	dims int
+}
+
+func (e hashingEmbedder) Model() string {
+	return fmt.Sprintf("hashing-%d", e.dims)
+}
+
+func (e hashingEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		v := make([]float64, e.dims)
+		for _, word := range embeddingTokens(text) {
+			e.add(v, "w:"+word, 1)
+			padded := []rune(" " + word + " ")
+			for j := 0; j+3 <= len(padded); j++ {
+				e.add(v, "t:"+string(padded[j:j+3]), 0.5)
+			}
+		}
+		vectors[i] = normalizeVector(v)
+	}
+	return vectors, nil
+}
+
+func (e hashingEmbedder) add(v []float64, feature string, weight float64) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum&(1<<63) != 0 {
+		weight = -weight // signed hashing keeps collisions from adding up
+	}
+	v[sum%uint64(e.dims)] += weight
+}
+
+func embeddingTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// httpEmbedder calls an OpenAI-compatible /embeddings endpoint.
+type httpEmbedder struct {
+	baseURL string
+	apiKey  string
+	model   string
+	http    *http.Client
+}
+
+func (e *httpEmbedder) Model() string {
+	return e.model
+}
+
+func (e *httpEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += embeddingBatchSize {
+		end := start + embeddingBatchSize
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := e.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+func (e *httpEmbedder) embedBatch(ctx context.Context, texts []string) ([][]float64, error) {
+	b, err := json.Marshal(map[string]interface{}{"model": e.model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", e.baseURL+"/embeddings", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("embeddings API error (status %d)", resp.StatusCode)
+	}
+	var body struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode embeddings: %v", err)
+	}
+	vectors := make([][]float64, len(texts))
+	for _, d := range body.Data {
+		if d.Index >= 0 && d.Index < len(vectors) {
+			vectors[d.Index] = normalizeVector(d.Embedding)
+		}
+	}
+	for _, v := range vectors {
+		if v == nil {
+			return nil, errors.New("embeddings API returned too few vectors")
+		}
+	}
+	return vectors, nil
+}
+
+func normalizeVector(v []float64) []float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := math.Sqrt(sum)
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// cosineSimilarity of two vectors; 0 when the dimensions differ.
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// hybridScore blends a fuzzy title score (0-100) with cosine similarity. A strong
+// semantic match lifts a weak title match, but never lowers it.
+func hybridScore(fuzzyScore int, similarity float64) int {
+	if similarity <= 0 {
+		return fuzzyScore
+	}
+	semantic := int(math.Round(math.Min(similarity, 1) * 100))
+	if blended := (fuzzyScore + 2*semantic) / 3; blended > fuzzyScore {
+		return blended
+	}
+	return fuzzyScore
+}
+
+// embeddable is the text of one task or project.
+type embeddable struct {
+	Type string // "task" or "project"
+	ID   primitive.ObjectID
+	Text string
+}
+
+func embeddingText(title, description string) string {
+	return strings.TrimSpace(title + "\n" + description)
+}
+
+func embeddingTextHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:16])
+}
+
+// loadEmbeddings returns the vectors of items, computing and storing the ones that are
+// missing or outdated.
+func loadEmbeddings(ctx context.Context, embedder Embedder, userID primitive.ObjectID, items []embeddable) (map[primitive.ObjectID][]float64, error) {
+	vectors := map[primitive.ObjectID][]float64{}
+	if len(items) == 0 {
+		return vectors, nil
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("embeddings")
+
+	ids := make([]primitive.ObjectID, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	cur, err := col.Find(ctx, bson.M{"userId": userID, "model": embedder.Model(), "entityId": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	stored := map[primitive.ObjectID]Embedding{}
+	for cur.Next(ctx) {
+		var e Embedding
+		if err := cur.Decode(&e); err == nil {
+			stored[e.EntityID] = e
+		}
+	}
+	cur.Close(ctx)
+
+	var stale []embeddable
+	for _, item := range items {
+		if e, ok := stored[item.ID]; ok && e.TextHash == embeddingTextHash(item.Text) {
+			vectors[item.ID] = e.Vector
+		} else {
+			stale = append(stale, item)
+		}
+	}
+	if len(stale) == 0 {
+		return vectors, nil
+	}
+
+	texts := make([]string, len(stale))
+	for i, item := range stale {
+		texts[i] = item.Text
+	}
+	computed, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var writes []mongo.WriteModel
+	for i, item := range stale {
+		vectors[item.ID] = computed[i]
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"entityId": item.ID, "model": embedder.Model()}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"userId":     userID,
+				"entityType": item.Type,
+				"textHash":   embeddingTextHash(item.Text),
+				"vector":     computed[i],
+				"updatedAt":  now,
+			}}).
+			SetUpsert(true))
+	}
+	if _, err := col.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		log.Printf("Failed to store embeddings for user %s: %v", userID.Hex(), err)
+	}
+	return vectors, nil
+}
+
+// refreshEmbedding recomputes one entity's vector after a write. It runs detached from
+// the request so a slow embeddings API doesn't delay the response.
+func refreshEmbedding(userID primitive.ObjectID, entityType string, id primitive.ObjectID, text string) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+		defer cancel()
+		if _, err := loadEmbeddings(ctx, newEmbedder(), userID, []embeddable{{Type: entityType, ID: id, Text: text}}); err != nil {
+			log.Printf("Failed to refresh embedding of %s %s: %v", entityType, id.Hex(), err)
+		}
+	}()
+}
+
+// semanticScores returns the cosine similarity of query to each item.
+func semanticScores(ctx context.Context, userID primitive.ObjectID, query string, items []embeddable) (map[primitive.ObjectID]float64, error) {
+	if len(items) == 0 {
+		return map[primitive.ObjectID]float64{}, nil // nothing to compare, skip the embedding call
+	}
+	embedder := newEmbedder()
+	q, err := embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	vectors, err := loadEmbeddings(ctx, embedder, userID, items)
+	if err != nil {
+		return nil, err
+	}
+	scores := make(map[primitive.ObjectID]float64, len(vectors))
+	for id, v := range vectors {
+		scores[id] = cosineSimilarity(q[0], v)
+	}
+	return scores, nil
+}
+
+type SemanticSearchRequest struct {
+	Authorization string `header:"Authorization"`
+	Query         string `query:"q"`
+	Type          string `query:"type"`  // "task", "project" or "" for both
+	Limit         int    `query:"limit"` // default 10, max 50
+}
+
+type SemanticSearchResult struct {
+	Type    string   `json:"type"`
+	ID      string   `json:"id"`
+	Title   string   `json:"title"`
+	Score   float64  `json:"score"`
+	Task    *Task    `json:"task,omitempty"`
+	Project *Project `json:"project,omitempty"`
+}
+
+type SemanticSearchResponse struct {
+	Results []SemanticSearchResult `json:"results"`
+}
+
+// SemanticSearch ranks the user's tasks and projects by meaning rather than spelling,
+// e.g. "the dentist thing" finds "Book appointment with Dr. Lee" with a suitable model.
+// encore:api public method=GET path=/api/search/semantic
+func SemanticSearch(ctx context.Context, req *SemanticSearchRequest) (*SemanticSearchResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, errors.New("q is required")
+	}
+	if req.Type != "" && req.Type != "task" && req.Type != "project" {
+		return nil, errors.New("type must be task or project")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 10
+	} else if limit > 50 {
+		limit = 50
+	}
+
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	db := client.Database("gtd")
+	var items []embeddable
+	tasks := map[primitive.ObjectID]Task{}
+	projects := map[primitive.ObjectID]Project{}
+	if req.Type != "project" {
+		cur, err := db.Collection("tasks").Find(ctx, bson.M{"userId": userID, "trashed": false})
+		if err != nil {
+			return nil, err
+		}
+		for cur.Next(ctx) {
+			var t Task
+			if err := cur.Decode(&t); err == nil {
+				tasks[t.ID] = t
+				items = append(items, embeddable{Type: "task", ID: t.ID, Text: embeddingText(t.Title, t.Description)})
+			}
+		}
+		cur.Close(ctx)
+	}
+	if req.Type != "task" {
+		cur, err := db.Collection("projects").Find(ctx, bson.M{"userId": userID})
+		if err != nil {
+			return nil, err
+		}
+		for cur.Next(ctx) {
+			var p Project
+			if err := cur.Decode(&p); err == nil {
+				projects[p.ID] = p
+				items = append(items, embeddable{Type: "project", ID: p.ID, Text: projectEmbeddingText(p)})
+			}
+		}
+		cur.Close(ctx)
+	}
+
+	scores, err := semanticScores(ctx, userID, req.Query, items)
+	if err != nil {
+		return nil, err
+	}
+	results := []SemanticSearchResult{}
+	for _, item := range items {
+		score := scores[item.ID]
+		if score < semanticMinScore {
+			continue
+		}
+		r := SemanticSearchResult{Type: item.Type, ID: item.ID.Hex(), Score: math.Round(score*1000) / 1000}
+		if item.Type == "task" {
+			t := tasks[item.ID]
+			r.Title, r.Task = t.Title, &t
+		} else {
+			p := projects[item.ID]
+			r.Title, r.Project = p.Name, &p
+		}
+		results = append(results, r)
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return &SemanticSearchResponse{Results: results}, nil
+}
+
+func projectEmbeddingText(p Project) string {
+	if p.Description == nil {
+		return embeddingText(p.Name, "")
+	}
+	return embeddingText(p.Name, *p.Description)
+}
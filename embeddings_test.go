@@ -0,0 +1,113 @@
+package encoreapp
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHashingEmbedderRanksSimilarTextsHigher(t *testing.T) {
+	e := hashingEmbedder{dims: hashingDims}
+	vectors, err := e.Embed(context.Background(), []string{
+		"dentist appointment",
+		"Book dentist appointment for Friday",
+		"Renew car insurance",
+		"",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var norm float64
+	for _, x := range vectors[0] {
+		norm += x * x
+	}
+	if math.Abs(norm-1) > 1e-9 {
+		t.Errorf("vector norm² = %v, want 1", norm)
+	}
+	related := cosineSimilarity(vectors[0], vectors[1])
+	unrelated := cosineSimilarity(vectors[0], vectors[2])
+	if related <= unrelated || related < semanticMinScore {
+		t.Errorf("related %.3f, unrelated %.3f", related, unrelated)
+	}
+	if s := cosineSimilarity(vectors[0], vectors[3]); s != 0 {
+		t.Errorf("similarity to empty text = %v, want 0", s)
+	}
+
+	again, _ := e.Embed(context.Background(), []string{"dentist appointment"})
+	if cosineSimilarity(vectors[0], again[0]) < 0.999999 {
+		t.Error("hashing embedder is not deterministic")
+	}
+}
+
+func TestHybridScore(t *testing.T) {
+	cases := []struct {
+		fuzzy      int
+		similarity float64
+		want       int
+	}{
+		{fuzzy: 40, similarity: 0, want: 40},
+		{fuzzy: 40, similarity: 0.85, want: 70},
+		{fuzzy: 90, similarity: 0.3, want: 90}, // never lowers a good title match
+		{fuzzy: 10, similarity: 1.2, want: 70},
+	}
+	for _, c := range cases {
+		if got := hybridScore(c.fuzzy, c.similarity); got != c.want {
+			t.Errorf("hybridScore(%d, %v) = %d, want %d", c.fuzzy, c.similarity, got, c.want)
+		}
+	}
+}
+
+func TestHTTPEmbedderOrdersByIndex(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/embeddings" || r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("unexpected request %s %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "test-embed" || len(req.Input) != 2 {
+			t.Errorf("unexpected body %+v", req)
+		}
+		// Out of order on purpose
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"index": 1, "embedding": []float64{0, 2}},
+				{"index": 0, "embedding": []float64{3, 4}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	e := &httpEmbedder{baseURL: server.URL, apiKey: "key", model: "test-embed", http: &http.Client{Timeout: time.Second}}
+	vectors, err := e.Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vectors[0][0] != 0.6 || vectors[0][1] != 0.8 || vectors[1][1] != 1 {
+		t.Errorf("vectors = %v", vectors)
+	}
+}
+
+func TestSemanticScoresWithoutItemsSkipsEmbedding(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	secrets.EMBEDDING_BASE_URL = server.URL
+	defer func() { secrets.EMBEDDING_BASE_URL = "" }()
+
+	scores, err := semanticScores(context.Background(), primitive.NewObjectID(), "dentist", nil)
+	if err != nil || len(scores) != 0 || calls != 0 {
+		t.Errorf("scores %v, err %v, %d embedding calls", scores, err, calls)
+	}
+}
@@ -0,0 +1,293 @@
+package encoreapp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	fuzzy "github.com/paul-mannino/go-fuzzywuzzy"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Offline evaluation of intent parsing and task extraction.
+//
+// Each line of testdata/eval/*.jsonl is a golden case:
+//
+//	{"id": "...", "prompt": "...", "now": "RFC 3339 (optional)", "timeZone": "IANA (optional)",
+//	 "expect": {"intent": "createTask", "title": "...", "dueDate": "2026-03-03 or RFC 3339",
+//	            "deferUntil": "2026-03-09", "projectName": "...", "nextActionName": "...", "priority": 1}}
+//
+// Only the fields present in "expect" are scored. A date-only dueDate or deferUntil matches
+// any time on that day in the case's time zone. The eval needs a model, so it is skipped unless
+// LLM_BASE_URL points at an OpenAI-compatible server, or a recorded run is replayed:
+//
+//	LLM_BASE_URL=http://localhost:11434/v1 LLM_MODEL=llama3.1 go test -run TestEval -v
+//	LLM_BASE_URL=... LLM_CASSETTE_MODE=record go test -run TestEval   # record a run
+//	LLM_CASSETTE_MODE=replay go test -run TestEval                    # replay it offline
+//
+// Recordings go to testdata/eval/cassettes (or LLM_CASSETTE_DIR). None are committed, so
+// replaying is skipped until a run has been recorded.
+//
+// Set EVAL_REPORT to write the report as JSON and EVAL_MIN_INTENT_ACCURACY (0-1) to fail
+// the run below a threshold.
+
+const evalDefaultNow = "2026-03-02T09:00:00Z" // a Monday
+
+type evalCase struct {
+	ID       string       `json:"id"`
+	Prompt   string       `json:"prompt"`
+	Now      string       `json:"now"`
+	TimeZone string       `json:"timeZone"`
+	Expect   evalExpected `json:"expect"`
+}
+
+type evalExpected struct {
+	Intent         string  `json:"intent"`
+	Title          *string `json:"title"`
+	DueDate        *string `json:"dueDate"`
+	DeferUntil     *string `json:"deferUntil"`
+	ProjectName    *string `json:"projectName"`
+	NextActionName *string `json:"nextActionName"`
+	Priority       *int    `json:"priority"`
+}
+
+// evalFieldScore counts, for one field, how often the model produced a value
+// and how often that value was right.
+type evalFieldScore struct {
+	Expected  int     `json:"expected"`
+	Predicted int     `json:"predicted"`
+	Correct   int     `json:"correct"`
+	Precision float64 `json:"precision"`
+	Recall    float64 `json:"recall"`
+}
+
+type evalReport struct {
+	Model          string                     `json:"model"`
+	Cases          int                        `json:"cases"`
+	IntentCorrect  int                        `json:"intentCorrect"`
+	IntentAccuracy float64                    `json:"intentAccuracy"`
+	Fields         map[string]*evalFieldScore `json:"fields"`
+	Failures       []string                   `json:"failures"`
+}
+
+func TestEval(t *testing.T) {
+	if os.Getenv("LLM_BASE_URL") == "" && os.Getenv("LLM_CASSETTE_MODE") != "replay" {
+		t.Skip("set LLM_BASE_URL or LLM_CASSETTE_MODE=replay to run the model evaluation")
+	}
+	saved := secrets
+	t.Cleanup(func() { secrets = saved })
+	secrets.LLM_BASE_URL = os.Getenv("LLM_BASE_URL")
+	secrets.LLM_MODEL = os.Getenv("LLM_MODEL")
+	secrets.GROQ_API_KEY = os.Getenv("GROQ_API_KEY")
+	secrets.LLM_CASSETTE_MODE = os.Getenv("LLM_CASSETTE_MODE")
+	secrets.LLM_CASSETTE_DIR = os.Getenv("LLM_CASSETTE_DIR")
+	if secrets.LLM_CASSETTE_DIR == "" {
+		secrets.LLM_CASSETTE_DIR = filepath.Join("testdata", "eval", "cassettes")
+	}
+	if secrets.LLM_CASSETTE_MODE == "replay" {
+		if recorded, _ := filepath.Glob(filepath.Join(secrets.LLM_CASSETTE_DIR, "*.json")); len(recorded) == 0 {
+			t.Skipf("no recorded run in %s to replay", secrets.LLM_CASSETTE_DIR)
+		}
+	}
+
+	cases := loadEvalCases(t)
+	report := evalReport{Model: llmModel(), Fields: map[string]*evalFieldScore{}}
+	for _, name := range []string{"title", "dueDate", "deferUntil", "projectName", "nextActionName", "priority"} {
+		report.Fields[name] = &evalFieldScore{}
+	}
+
+	userID := primitive.NewObjectID()
+	for _, c := range cases {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		ctx = context.WithValue(ctx, userClockKey{}, evalClock(t, c))
+		runEvalCase(ctx, userID, c, &report)
+		cancel()
+	}
+
+	report.Cases = len(cases)
+	if report.Cases > 0 {
+		report.IntentAccuracy = float64(report.IntentCorrect) / float64(report.Cases)
+	}
+	for _, f := range report.Fields {
+		if f.Predicted > 0 {
+			f.Precision = float64(f.Correct) / float64(f.Predicted)
+		}
+		if f.Expected > 0 {
+			f.Recall = float64(f.Correct) / float64(f.Expected)
+		}
+	}
+	logEvalReport(t, report)
+
+	if path := os.Getenv("EVAL_REPORT"); path != "" {
+		b, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Errorf("writing report: %v", err)
+		}
+	}
+	if min := os.Getenv("EVAL_MIN_INTENT_ACCURACY"); min != "" {
+		threshold, err := strconv.ParseFloat(min, 64)
+		if err != nil {
+			t.Fatalf("invalid EVAL_MIN_INTENT_ACCURACY: %v", err)
+		}
+		if report.IntentAccuracy < threshold {
+			t.Errorf("intent accuracy %.2f is below %.2f", report.IntentAccuracy, threshold)
+		}
+	}
+}
+
+func runEvalCase(ctx context.Context, userID primitive.ObjectID, c evalCase, report *evalReport) {
+	parsed, err := parseIntent(ctx, userID, c.Prompt)
+	if err != nil {
+		report.Failures = append(report.Failures, fmt.Sprintf("%s: parseIntent: %v", c.ID, err))
+		return
+	}
+	if parsed.Intent == c.Expect.Intent {
+		report.IntentCorrect++
+	} else {
+		report.Failures = append(report.Failures, fmt.Sprintf("%s: intent %q, want %q", c.ID, parsed.Intent, c.Expect.Intent))
+	}
+	if c.Expect.Intent != "createTask" {
+		return
+	}
+
+	// Field extraction is scored on the expected intent, independent of classification
+	task, err := extractTask(ctx, userID, c.Prompt)
+	if err != nil {
+		report.Failures = append(report.Failures, fmt.Sprintf("%s: extractTask: %v", c.ID, err))
+		task = &aiTaskFields{}
+	}
+	clock := clockFromContext(ctx)
+	scoreEvalField(report, c.ID, "title", c.Expect.Title, task.Title, func(want, got string) bool {
+		return fuzzy.TokenSetRatio(strings.ToLower(want), strings.ToLower(got)) >= 85
+	})
+	scoreEvalField(report, c.ID, "dueDate", c.Expect.DueDate, task.DueDate, func(want, got string) bool {
+		return evalSameDueDate(want, got, clock)
+	})
+	scoreEvalField(report, c.ID, "deferUntil", c.Expect.DeferUntil, task.DeferUntil, func(want, got string) bool {
+		return evalSameDueDate(want, got, clock)
+	})
+	scoreEvalField(report, c.ID, "projectName", c.Expect.ProjectName, task.ProjectName, evalSameName)
+	scoreEvalField(report, c.ID, "nextActionName", c.Expect.NextActionName, task.NextActionName, evalSameName)
+
+	var wantPriority *string
+	if c.Expect.Priority != nil {
+		p := strconv.Itoa(*c.Expect.Priority)
+		wantPriority = &p
+	}
+	gotPriority := ""
+	if task.Priority >= 1 && task.Priority <= 5 {
+		gotPriority = strconv.Itoa(task.Priority)
+	}
+	scoreEvalField(report, c.ID, "priority", wantPriority, gotPriority, func(want, got string) bool { return want == got })
+}
+
+func scoreEvalField(report *evalReport, id, name string, want *string, got string, equal func(want, got string) bool) {
+	if want == nil {
+		return
+	}
+	score := report.Fields[name]
+	if *want != "" {
+		score.Expected++
+	}
+	if got == "" || got == "null" {
+		if *want != "" {
+			report.Failures = append(report.Failures, fmt.Sprintf("%s: %s missing, want %q", id, name, *want))
+		}
+		return
+	}
+	score.Predicted++
+	if *want != "" && equal(*want, got) {
+		score.Correct++
+		return
+	}
+	report.Failures = append(report.Failures, fmt.Sprintf("%s: %s %q, want %q", id, name, got, *want))
+}
+
+func evalSameName(want, got string) bool {
+	norm := func(s string) string { return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "@")) }
+	return norm(want) == norm(got)
+}
+
+func evalSameDueDate(want, got string, clock userClock) bool {
+	gotTime, err := parseTaskDate(got, clock)
+	if err != nil {
+		return false
+	}
+	if wantDay, err := time.ParseInLocation("2006-01-02", want, clock.Location()); err == nil {
+		return startOfDay(gotTime.In(clock.Location())).Equal(wantDay)
+	}
+	wantTime, err := time.Parse(time.RFC3339, want)
+	return err == nil && wantTime.Equal(gotTime)
+}
+
+func evalClock(t *testing.T, c evalCase) userClock {
+	nowStr := c.Now
+	if nowStr == "" {
+		nowStr = evalDefaultNow
+	}
+	now, err := time.Parse(time.RFC3339, nowStr)
+	if err != nil {
+		t.Fatalf("%s: invalid now: %v", c.ID, err)
+	}
+	if c.TimeZone != "" {
+		loc, ok := loadTimeZone(c.TimeZone)
+		if !ok {
+			t.Fatalf("%s: invalid time zone %q", c.ID, c.TimeZone)
+		}
+		now = now.In(loc)
+	}
+	return userClock{Now: now}
+}
+
+func loadEvalCases(t *testing.T) []evalCase {
+	files, err := filepath.Glob(filepath.Join("testdata", "eval", "*.jsonl"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no golden files in testdata/eval: %v", err)
+	}
+	var cases []evalCase
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("opening %s: %v", path, err)
+		}
+		scanner := bufio.NewScanner(f)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var c evalCase
+			if err := json.Unmarshal([]byte(text), &c); err != nil {
+				t.Fatalf("%s:%d: %v", path, line, err)
+			}
+			cases = append(cases, c)
+		}
+		f.Close()
+	}
+	return cases
+}
+
+func logEvalReport(t *testing.T, r evalReport) {
+	t.Logf("model %s: intent accuracy %.1f%% (%d/%d)", r.Model, 100*r.IntentAccuracy, r.IntentCorrect, r.Cases)
+	names := make([]string, 0, len(r.Fields))
+	for name := range r.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.Fields[name]
+		t.Logf("  %-15s precision %5.1f%% (%d/%d)  recall %5.1f%% (%d/%d)",
+			name, 100*f.Precision, f.Correct, f.Predicted, 100*f.Recall, f.Correct, f.Expected)
+	}
+	for _, failure := range r.Failures {
+		t.Logf("  FAIL %s", failure)
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	firebase "firebase.google.com/go/v4"
 	"firebase.google.com/go/v4/auth"
+	"firebase.google.com/go/v4/messaging"
 	"google.golang.org/api/option"
 )
 
@@ -61,6 +62,23 @@ func InitFirebase() error {
 	return initError
 }
 
+var (
+	firebaseMessaging *messaging.Client
+	messagingOnce     sync.Once
+	messagingErr      error
+)
+
+// getFirebaseMessaging returns the Cloud Messaging client of the Firebase app.
+func getFirebaseMessaging(ctx context.Context) (*messaging.Client, error) {
+	if err := InitFirebase(); err != nil {
+		return nil, err
+	}
+	messagingOnce.Do(func() {
+		firebaseMessaging, messagingErr = firebaseApp.Messaging(ctx)
+	})
+	return firebaseMessaging, messagingErr
+}
+
 // Returns the Firebase user info if the token is valid, else error.
 func getFirebaseUser(ctx context.Context, idToken string) (*auth.Token, error) {
 	if idToken == "" {
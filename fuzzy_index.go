@@ -0,0 +1,249 @@
+package encoreapp
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Fuzzy entity resolution scores a bounded candidate set instead of every document. Each
+// user's titles/names are kept in an in-memory trigram index per collection; a query's
+// candidates are the entries sharing the most trigrams with it. The index is dropped on
+// writes in this process (invalidateFuzzyIndex) and rebuilt after fuzzyIndexTTL, which
+// bounds staleness when several instances serve the same user.
+//
+// Users with at most fuzzyFullScanLimit documents are still scored in full, so semantic
+// matches without any shared letters keep working for them.
+
+const (
+	fuzzyCandidateLimit  = 50
+	fuzzyCandidateWindow = 1000 // ranked candidates checked against the caller's filter
+	fuzzyFullScanLimit   = 1000
+	fuzzyIndexTTL        = 10 * time.Minute
+	fuzzyIndexMaxUsers   = 2000 // cached indexes before the oldest are evicted
+)
+
+// fuzzyEntry is one indexed document.
+type fuzzyEntry struct {
+	ID   primitive.ObjectID
+	Text string
+}
+
+type trigramIndex struct {
+	entries  []fuzzyEntry
+	sizes    []int              // distinct trigrams per entry
+	postings map[string][]int32 // trigram -> entry positions
+	builtAt  time.Time
+}
+
+func newTrigramIndex(entries []fuzzyEntry) *trigramIndex {
+	ix := &trigramIndex{
+		entries:  entries,
+		sizes:    make([]int, len(entries)),
+		postings: map[string][]int32{},
+		builtAt:  time.Now(),
+	}
+	for i, e := range entries {
+		grams := trigrams(e.Text)
+		ix.sizes[i] = len(grams)
+		for g := range grams {
+			ix.postings[g] = append(ix.postings[g], int32(i))
+		}
+	}
+	return ix
+}
+
+// trigrams returns the distinct trigrams of the lower-cased words of s, each word padded
+// with spaces so short words and word boundaries count too.
+func trigrams(s string) map[string]struct{} {
+	grams := map[string]struct{}{}
+	for _, word := range strings.Fields(strings.ToLower(s)) {
+		r := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(r); i++ {
+			grams[string(r[i:i+3])] = struct{}{}
+		}
+	}
+	return grams
+}
+
+// candidates returns up to limit entry IDs ranked by the Dice coefficient of their
+// trigram sets with the query's.
+func (ix *trigramIndex) candidates(query string, limit int) []primitive.ObjectID {
+	q := trigrams(query)
+	if len(q) == 0 {
+		return nil
+	}
+	shared := make([]uint16, len(ix.entries))
+	var hit []int32
+	for g := range q {
+		for _, pos := range ix.postings[g] {
+			if shared[pos] == 0 {
+				hit = append(hit, pos)
+			}
+			shared[pos]++
+		}
+	}
+	score := func(pos int32) float64 {
+		return 2 * float64(shared[pos]) / float64(len(q)+ix.sizes[pos])
+	}
+	sort.Slice(hit, func(i, j int) bool { return score(hit[i]) > score(hit[j]) })
+	if len(hit) > limit {
+		hit = hit[:limit]
+	}
+	ids := make([]primitive.ObjectID, len(hit))
+	for i, pos := range hit {
+		ids[i] = ix.entries[pos].ID
+	}
+	return ids
+}
+
+var (
+	fuzzyIndexMu sync.Mutex
+	fuzzyIndexes = map[string]*trigramIndex{}
+)
+
+// Fields holding the matched text, by collection.
+var fuzzyTextFields = map[string]string{
+	"tasks":       "title",
+	"projects":    "name",
+	"nextactions": "context_name",
+}
+
+func fuzzyIndexKey(colName string, userID primitive.ObjectID) string {
+	return colName + ":" + userID.Hex()
+}
+
+// invalidateFuzzyIndex drops the user's cached index of colName after a document was
+// created or renamed.
+func invalidateFuzzyIndex(colName string, userID primitive.ObjectID) {
+	fuzzyIndexMu.Lock()
+	delete(fuzzyIndexes, fuzzyIndexKey(colName, userID))
+	fuzzyIndexMu.Unlock()
+}
+
+// narrowFuzzyFilter restricts filter to the best trigram candidates for query. The index
+// covers every document, including completed and trashed ones, so ranked candidates are
+// checked against filter in growing windows until fuzzyCandidateLimit of them match or
+// fuzzyCandidateWindow have been tried. It returns filter unchanged for small collections
+// or when the index can't be loaded.
+func narrowFuzzyFilter(ctx context.Context, colName string, userID primitive.ObjectID, query string, filter bson.M) bson.M {
+	ix, err := loadFuzzyIndex(ctx, colName, userID)
+	if err != nil || len(ix.entries) <= fuzzyFullScanLimit {
+		return filter
+	}
+	ranked := ix.candidates(query, fuzzyCandidateWindow)
+	ids := []primitive.ObjectID{}
+	for start, size := 0, fuzzyCandidateLimit; start < len(ranked) && len(ids) < fuzzyCandidateLimit; start, size = start+size, size*2 {
+		end := start + size
+		if end > len(ranked) {
+			end = len(ranked)
+		}
+		matched, err := fuzzyMatchingIDs(ctx, colName, filter, ranked[start:end])
+		if err != nil {
+			return filter
+		}
+		ids = append(ids, matched...)
+	}
+	narrowed := bson.M{}
+	for k, v := range filter {
+		narrowed[k] = v
+	}
+	narrowed["_id"] = bson.M{"$in": ids}
+	return narrowed
+}
+
+// fuzzyMatchingIDs returns the ids whose documents match filter. Tests replace it.
+var fuzzyMatchingIDs = func(ctx context.Context, colName string, filter bson.M, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, err
+	}
+	f := bson.M{}
+	for k, v := range filter {
+		f[k] = v
+	}
+	f["_id"] = bson.M{"$in": ids}
+	cur, err := client.Database("gtd").Collection(colName).Find(ctx, f, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	matched := make([]primitive.ObjectID, len(docs))
+	for i, d := range docs {
+		matched[i] = d.ID
+	}
+	return matched, nil
+}
+
+func loadFuzzyIndex(ctx context.Context, colName string, userID primitive.ObjectID) (*trigramIndex, error) {
+	key := fuzzyIndexKey(colName, userID)
+	fuzzyIndexMu.Lock()
+	ix, ok := fuzzyIndexes[key]
+	fuzzyIndexMu.Unlock()
+	if ok && time.Since(ix.builtAt) < fuzzyIndexTTL {
+		return ix, nil
+	}
+
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, err
+	}
+	field := fuzzyTextFields[colName]
+	opts := options.Find().SetProjection(bson.M{"_id": 1, field: 1})
+	cur, err := client.Database("gtd").Collection(colName).Find(ctx, bson.M{"userId": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var entries []fuzzyEntry
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			continue
+		}
+		id, _ := doc["_id"].(primitive.ObjectID)
+		text, _ := doc[field].(string)
+		entries = append(entries, fuzzyEntry{ID: id, Text: text})
+	}
+	ix = newTrigramIndex(entries)
+
+	fuzzyIndexMu.Lock()
+	defer fuzzyIndexMu.Unlock()
+	if len(fuzzyIndexes) >= fuzzyIndexMaxUsers {
+		evictOldestFuzzyIndexes()
+	}
+	fuzzyIndexes[key] = ix
+	return ix, nil
+}
+
+// evictOldestFuzzyIndexes drops expired indexes, or the oldest half if none expired.
+// Callers hold fuzzyIndexMu.
+func evictOldestFuzzyIndexes() {
+	for key, ix := range fuzzyIndexes {
+		if time.Since(ix.builtAt) >= fuzzyIndexTTL {
+			delete(fuzzyIndexes, key)
+		}
+	}
+	if len(fuzzyIndexes) < fuzzyIndexMaxUsers {
+		return
+	}
+	keys := make([]string, 0, len(fuzzyIndexes))
+	for key := range fuzzyIndexes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return fuzzyIndexes[keys[i]].builtAt.Before(fuzzyIndexes[keys[j]].builtAt) })
+	for _, key := range keys[:len(keys)/2] {
+		delete(fuzzyIndexes, key)
+	}
+}
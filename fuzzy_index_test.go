@@ -0,0 +1,163 @@
+package encoreapp
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	fuzzy "github.com/paul-mannino/go-fuzzywuzzy"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var benchVerbs = []string{"Call", "Email", "Buy", "Book", "Review", "Write", "Fix", "Plan", "Schedule", "Clean", "Pay", "Renew", "Update", "Prepare", "Send"}
+var benchObjects = []string{"dentist", "quarterly report", "groceries", "car insurance", "flight to Berlin", "team offsite", "tax return", "garage", "birthday gift", "landlord", "invoice", "slides", "passport", "gym membership", "kitchen sink", "budget", "newsletter", "vet appointment", "bike tyre", "contract"}
+var benchQualifiers = []string{"", "for mom", "before Friday", "with Alex", "again", "next week", "for the client", "online", "at the office", "for Q3"}
+
+// syntheticTasks returns n task titles in the style of real GTD lists.
+func syntheticTasks(n int) []fuzzyEntry {
+	r := rand.New(rand.NewSource(1))
+	entries := make([]fuzzyEntry, n)
+	for i := range entries {
+		title := fmt.Sprintf("%s %s %s", benchVerbs[r.Intn(len(benchVerbs))], benchObjects[r.Intn(len(benchObjects))], benchQualifiers[r.Intn(len(benchQualifiers))])
+		entries[i] = fuzzyEntry{ID: primitive.NewObjectID(), Text: strings.TrimSpace(fmt.Sprintf("%s #%d", title, i))}
+	}
+	return entries
+}
+
+func bestFullScan(entries []fuzzyEntry, query string) (primitive.ObjectID, int) {
+	var best primitive.ObjectID
+	bestScore := -1
+	for _, e := range entries {
+		if s := fuzzy.Ratio(strings.ToLower(query), strings.ToLower(e.Text)); s > bestScore {
+			best, bestScore = e.ID, s
+		}
+	}
+	return best, bestScore
+}
+
+func bestIndexed(ix *trigramIndex, byID map[primitive.ObjectID]string, query string) (primitive.ObjectID, int) {
+	var best primitive.ObjectID
+	bestScore := -1
+	for _, id := range ix.candidates(query, fuzzyCandidateLimit) {
+		if s := fuzzy.Ratio(strings.ToLower(query), strings.ToLower(byID[id])); s > bestScore {
+			best, bestScore = id, s
+		}
+	}
+	return best, bestScore
+}
+
+func TestTrigramCandidatesKeepBestMatch(t *testing.T) {
+	entries := syntheticTasks(10000)
+	ix := newTrigramIndex(entries)
+	byID := map[primitive.ObjectID]string{}
+	for _, e := range entries {
+		byID[e.ID] = e.Text
+	}
+
+	// Misspelled and partial versions of existing titles
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 40; i++ {
+		target := entries[r.Intn(len(entries))].Text
+		query := []rune(strings.ToLower(target))
+		pos := r.Intn(len(query))
+		query = append(query[:pos], query[pos+1:]...) // drop one character
+		_, want := bestFullScan(entries, string(query))
+		_, got := bestIndexed(ix, byID, string(query))
+		if got != want {
+			t.Errorf("%q: indexed best score %d, full scan %d", string(query), got, want)
+		}
+	}
+
+	if ids := ix.candidates("   ", fuzzyCandidateLimit); ids != nil {
+		t.Errorf("blank query returned %d candidates", len(ids))
+	}
+}
+
+func TestNarrowFuzzyFilterSkipsCandidatesOutsideFilter(t *testing.T) {
+	userID := primitive.NewObjectID()
+	// 200 completed tasks outrank the one open task for the query.
+	entries := syntheticTasks(2000)
+	completed := map[primitive.ObjectID]bool{}
+	for i := 0; i < 200; i++ {
+		entries[i].Text = "Call dentist"
+		completed[entries[i].ID] = true
+	}
+	open := primitive.NewObjectID()
+	entries = append(entries, fuzzyEntry{ID: open, Text: "Call the dentist about the crown"})
+
+	key := fuzzyIndexKey("tasks", userID)
+	fuzzyIndexMu.Lock()
+	fuzzyIndexes[key] = newTrigramIndex(entries)
+	fuzzyIndexMu.Unlock()
+	saved := fuzzyMatchingIDs
+	t.Cleanup(func() {
+		fuzzyMatchingIDs = saved
+		invalidateFuzzyIndex("tasks", userID)
+	})
+	var checked int
+	fuzzyMatchingIDs = func(ctx context.Context, colName string, filter bson.M, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+		checked += len(ids)
+		var matched []primitive.ObjectID
+		for _, id := range ids {
+			if filter["completed"] == false && !completed[id] {
+				matched = append(matched, id)
+			}
+		}
+		return matched, nil
+	}
+
+	filter := bson.M{"userId": userID, "completed": false, "trashed": false}
+	narrowed := narrowFuzzyFilter(context.Background(), "tasks", userID, "call dentist", filter)
+	if _, ok := filter["_id"]; ok {
+		t.Error("narrowFuzzyFilter modified the caller's filter")
+	}
+	if narrowed["completed"] != false || narrowed["trashed"] != false {
+		t.Errorf("narrowed filter lost conditions: %v", narrowed)
+	}
+	in, _ := narrowed["_id"].(bson.M)["$in"].([]primitive.ObjectID)
+	found := false
+	for _, id := range in {
+		if completed[id] {
+			t.Fatalf("completed task %v among the candidates", id)
+		}
+		found = found || id == open
+	}
+	if !found {
+		t.Errorf("open task missing from %d candidates", len(in))
+	}
+	if len(in) < fuzzyCandidateLimit || checked > fuzzyCandidateWindow {
+		t.Errorf("%d candidates after checking %d", len(in), checked)
+	}
+}
+
+func BenchmarkFuzzyFullScan10k(b *testing.B) {
+	entries := syntheticTasks(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bestFullScan(entries, "book dentist apointment")
+	}
+}
+
+func BenchmarkFuzzyIndexed10k(b *testing.B) {
+	entries := syntheticTasks(10000)
+	ix := newTrigramIndex(entries)
+	byID := map[primitive.ObjectID]string{}
+	for _, e := range entries {
+		byID[e.ID] = e.Text
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bestIndexed(ix, byID, "book dentist apointment")
+	}
+}
+
+func BenchmarkTrigramIndexBuild10k(b *testing.B) {
+	entries := syntheticTasks(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newTrigramIndex(entries)
+	}
+}
@@ -0,0 +1,476 @@
+package encoreapp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+// llmBaseURL and llmModel select the chat completions backend. Any OpenAI-compatible
+// server (e.g. a local model) can be used by setting LLM_BASE_URL and LLM_MODEL.
+func llmBaseURL() string {
+	if secrets.LLM_BASE_URL != "" {
+		return strings.TrimSuffix(secrets.LLM_BASE_URL, "/")
+	}
+	return "https://api.groq.com/openai/v1"
+}
+
+func llmModel() string {
+	if secrets.LLM_MODEL != "" {
+		return secrets.LLM_MODEL
+	}
+	return "llama-3.1-8b-instant"
+}
+
+// llmClient sends one chat completion request to the model backend.
+type llmClient interface {
+	Complete(ctx context.Context, req GroqChatRequest) (*GroqChatResponse, error)
+}
+
+// newLLMClient returns the client configured by the LLM_* settings. With
+// LLM_CASSETTE_MODE set to "record" or "replay" calls go through a cassette directory.
+func newLLMClient() llmClient {
+	var client llmClient = &httpLLMClient{
+		baseURL: llmBaseURL(),
+		apiKey:  secrets.GROQ_API_KEY,
+		http:    llmHTTPClient,
+	}
+	client = &breakerLLMClient{breaker: llmBreaker, next: &retryingLLMClient{next: client, maxAttempts: llmMaxAttempts}}
+	if secrets.LLM_CASSETTE_MODE != "" {
+		dir := secrets.LLM_CASSETTE_DIR
+		if dir == "" {
+			dir = filepath.Join("testdata", "cassettes")
+		}
+		client = &cassetteLLMClient{mode: secrets.LLM_CASSETTE_MODE, dir: dir, next: client}
+	}
+	return client
+}
+
+// httpLLMClient talks to an OpenAI-compatible chat completions endpoint.
+type httpLLMClient struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+func (c *httpLLMClient) Complete(ctx context.Context, reqBody GroqChatRequest) (*GroqChatResponse, error) {
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/chat/completions", bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &llmError{kind: ErrProviderDown, msg: fmt.Sprintf("failed to make request: %v", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, llmStatusError(resp)
+	}
+
+	var groqResp GroqChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&groqResp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	return &groqResp, nil
+}
+
+// llmStatusError converts a non-200 provider response into an error.
+func llmStatusError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+
+	// Handle specific error cases
+	switch {
+	case resp.StatusCode == 429:
+		return &llmError{kind: ErrRateLimited, msg: "rate limit exceeded - too many requests", retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	case resp.StatusCode == 401:
+		return errors.New("authentication failed - invalid API key")
+	case resp.StatusCode == 403:
+		return errors.New("access forbidden - API key may be invalid or expired")
+	case resp.StatusCode >= 500:
+		return &llmError{kind: ErrProviderDown, msg: fmt.Sprintf("Groq API error (status %d)", resp.StatusCode), retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+	default:
+		return fmt.Errorf("Groq API error (status %d): %s", resp.StatusCode, string(body))
+	}
+}
+
+// groqStreamChunk is one "data:" event of a streamed completion. Groq reports usage in
+// x_groq on the last chunk, OpenAI-compatible servers in usage.
+type groqStreamChunk struct {
+	Choices []struct {
+		Delta GroqMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *GroqUsage `json:"usage"`
+	XGroq *struct {
+		Usage *GroqUsage `json:"usage"`
+	} `json:"x_groq"`
+}
+
+// Stream sends a streaming completion request and calls onDelta for each content
+// fragment. It returns the full content and the reported token usage.
+func (c *httpLLMClient) Stream(ctx context.Context, reqBody GroqChatRequest, onDelta func(string) error) (string, GroqUsage, error) {
+	var usage GroqUsage
+	reqBody.Stream = true
+	reqBody.StreamOptions = &GroqStreamOptions{IncludeUsage: true}
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", usage, fmt.Errorf("failed to marshal request: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/chat/completions", bytes.NewReader(b))
+	if err != nil {
+		return "", usage, fmt.Errorf("failed to create request: %v", err)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	// The whole stream can take longer than one non-streaming attempt, so rely on ctx
+	// for the deadline instead of the client timeout.
+	resp, err := (&http.Client{Transport: c.http.Transport}).Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", usage, ctx.Err()
+		}
+		return "", usage, &llmError{kind: ErrProviderDown, msg: fmt.Sprintf("failed to make request: %v", err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", usage, llmStatusError(resp)
+	}
+
+	var content strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			break
+		}
+		var chunk groqStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return content.String(), usage, fmt.Errorf("failed to decode stream chunk: %v", err)
+		}
+		if chunk.Usage != nil {
+			usage = *chunk.Usage
+		} else if chunk.XGroq != nil && chunk.XGroq.Usage != nil {
+			usage = *chunk.XGroq.Usage
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			if err := onDelta(choice.Delta.Content); err != nil {
+				return content.String(), usage, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return content.String(), usage, fmt.Errorf("failed to read stream: %v", err)
+	}
+	return content.String(), usage, nil
+}
+
+// Typed provider errors. callGroqChat converts them with aiError before they leave an
+// endpoint; use aiErrorCode to classify AI errors either way.
+var (
+	ErrRateLimited  = errors.New("AI provider rate limit exceeded")
+	ErrProviderDown = errors.New("AI provider is unavailable")
+)
+
+const (
+	llmRequestTimeout = 30 * time.Second // per attempt
+	llmMaxAttempts    = 3
+	llmBaseBackoff    = 500 * time.Millisecond
+	llmMaxBackoff     = 10 * time.Second
+)
+
+var llmHTTPClient = &http.Client{Timeout: llmRequestTimeout}
+
+// llmError is a retryable provider failure. It matches ErrRateLimited or ErrProviderDown.
+type llmError struct {
+	kind       error
+	msg        string
+	retryAfter time.Duration // from the Retry-After header, 0 if absent
+}
+
+func (e *llmError) Error() string { return e.msg }
+func (e *llmError) Unwrap() error { return e.kind }
+
+// aiError converts provider errors into the error returned to clients: rate limits
+// become ResourceExhausted and outages Unavailable. Other errors are returned as is.
+func aiError(err error) error {
+	var le *llmError
+	if !errors.As(err, &le) {
+		return err
+	}
+	code := errs.Unavailable
+	if errors.Is(le.kind, ErrRateLimited) {
+		code = errs.ResourceExhausted
+	}
+	return &errs.Error{Code: code, Message: le.msg}
+}
+
+// aiErrorCode classifies an AI error, converted or not: ResourceExhausted for quota and
+// rate limits, Unavailable when the provider is down, Unknown for anything else.
+func aiErrorCode(err error) errs.ErrCode {
+	var e *errs.Error
+	switch {
+	case errors.As(err, &e):
+		return e.Code
+	case errors.Is(err, ErrRateLimited):
+		return errs.ResourceExhausted
+	case errors.Is(err, ErrProviderDown):
+		return errs.Unavailable
+	default:
+		return errs.Unknown
+	}
+}
+
+// httpStatusForError maps AI errors to HTTP status codes, 500 for anything else.
+func httpStatusForError(err error) int {
+	switch code := aiErrorCode(err); {
+	case code == errs.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case code == errs.Unavailable:
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// retryingLLMClient retries rate-limited and failed calls with exponential backoff,
+// waiting at least as long as the provider's Retry-After. It gives up early when the
+// wait would outlast the context deadline.
+type retryingLLMClient struct {
+	next        llmClient
+	maxAttempts int
+}
+
+func (c *retryingLLMClient) Complete(ctx context.Context, req GroqChatRequest) (*GroqChatResponse, error) {
+	backoff := llmBaseBackoff
+	for attempt := 1; ; attempt++ {
+		resp, err := c.next.Complete(ctx, req)
+		var llmErr *llmError
+		if err == nil || !errors.As(err, &llmErr) || attempt >= c.maxAttempts {
+			return resp, err
+		}
+
+		wait := backoff + time.Duration(rand.Int63n(int64(backoff/2)))
+		if llmErr.retryAfter > wait {
+			wait = llmErr.retryAfter
+		}
+		if wait > llmMaxBackoff {
+			return nil, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return nil, err
+		}
+		LogEvent("llm_retry", "", map[string]interface{}{
+			"attempt": attempt,
+			"error":   err.Error(),
+			"wait":    wait.String(),
+		})
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(wait):
+		}
+		backoff *= 2
+	}
+}
+
+// circuitBreaker stops calling the provider after repeated failures. Once cooldown has
+// passed a single trial call is let through; its result closes or re-opens the circuit.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	trial     bool
+}
+
+var llmBreaker = &circuitBreaker{threshold: 5, cooldown: 30 * time.Second}
+
+// Open reports whether calls are currently being short-circuited.
+func (b *circuitBreaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.threshold && (time.Now().Before(b.openUntil) || b.trial)
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.trial {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// finish records the outcome of an allowed call. A call cut short by its own context
+// says nothing about the provider, so it only releases the trial slot.
+func (b *circuitBreaker) finish(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		b.mu.Lock()
+		b.trial = false
+		b.mu.Unlock()
+		return
+	}
+	b.record(err)
+}
+
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	if err == nil || !errors.Is(err, ErrProviderDown) {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+		LogEvent("llm_circuit_open", "", map[string]interface{}{
+			"failures": b.failures,
+			"until":    b.openUntil,
+		})
+	}
+}
+
+type breakerLLMClient struct {
+	breaker *circuitBreaker
+	next    llmClient
+}
+
+func (c *breakerLLMClient) Complete(ctx context.Context, req GroqChatRequest) (*GroqChatResponse, error) {
+	if !c.breaker.allow() {
+		return nil, &llmError{kind: ErrProviderDown, msg: "AI provider is unavailable (circuit open)"}
+	}
+	resp, err := c.next.Complete(ctx, req)
+	c.breaker.finish(ctx, err)
+	return resp, err
+}
+
+// cassetteLLMClient records model responses to files, or serves them back without
+// network access. A cassette is keyed by a hash of the model and messages, so the
+// injected date must be pinned for replays to match.
+type cassetteLLMClient struct {
+	mode string // "record" or "replay"
+	dir  string
+	next llmClient
+}
+
+// llmCassette is the file stored per request. The request is kept for reviewing diffs.
+type llmCassette struct {
+	Model      string           `json:"model"`
+	Messages   []GroqMessage    `json:"messages"`
+	Response   GroqChatResponse `json:"response"`
+	RecordedAt time.Time        `json:"recordedAt"`
+}
+
+func (c *cassetteLLMClient) Complete(ctx context.Context, req GroqChatRequest) (*GroqChatResponse, error) {
+	path := filepath.Join(c.dir, cassetteKey(req)+".json")
+	switch c.mode {
+	case "replay":
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("no cassette for this request (%s): %v", filepath.Base(path), err)
+		}
+		var cassette llmCassette
+		if err := json.Unmarshal(b, &cassette); err != nil {
+			return nil, fmt.Errorf("invalid cassette %s: %v", filepath.Base(path), err)
+		}
+		return &cassette.Response, nil
+	case "record":
+		resp, err := c.next.Complete(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		cassette := llmCassette{Model: req.Model, Messages: req.Messages, Response: *resp, RecordedAt: time.Now().UTC()}
+		b, err := json.MarshalIndent(cassette, "", "  ")
+		if err == nil {
+			err = os.MkdirAll(c.dir, 0o755)
+		}
+		if err == nil {
+			err = os.WriteFile(path, b, 0o644)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write cassette: %v", err)
+		}
+		return resp, nil
+	default:
+		return nil, fmt.Errorf("unknown LLM_CASSETTE_MODE %q", c.mode)
+	}
+}
+
+// cassetteKey hashes the parts of a request that determine the model's answer.
+func cassetteKey(req GroqChatRequest) string {
+	h := sha256.New()
+	h.Write([]byte(req.Model))
+	for _, m := range req.Messages {
+		h.Write([]byte{0})
+		h.Write([]byte(m.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(m.Content))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
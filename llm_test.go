@@ -0,0 +1,273 @@
+package encoreapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeLLMServer answers intent prompts with createTask and everything else with a task.
+func fakeLLMServer(t *testing.T, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		var req GroqChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding request: %v", err)
+		}
+		content := `{"title":"Call mom","dueDate":"2026-03-03T15:00:00Z","priority":2,"projectName":"","nextActionName":""}`
+		if strings.Contains(req.Messages[0].Content, "Decide the intent") {
+			content = `{"intent":"createTask","userPrompt":"call mom tomorrow at 3pm"}`
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": content}}},
+		})
+	}))
+}
+
+func TestLLMCassetteRecordReplay(t *testing.T) {
+	var calls int32
+	server := fakeLLMServer(t, &calls)
+	dir := t.TempDir()
+	defer func() {
+		secrets.LLM_BASE_URL, secrets.LLM_CASSETTE_MODE, secrets.LLM_CASSETTE_DIR = "", "", ""
+	}()
+
+	userID := primitive.NewObjectID()
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	ctx := context.WithValue(context.Background(), userClockKey{}, userClock{Now: now})
+	run := func() (*AIParseIntentResponse, *aiTaskFields) {
+		t.Helper()
+		intent, err := parseIntent(ctx, userID, "call mom tomorrow at 3pm")
+		if err != nil {
+			t.Fatalf("parseIntent: %v", err)
+		}
+		task, err := extractTask(ctx, userID, "call mom tomorrow at 3pm")
+		if err != nil {
+			t.Fatalf("extractTask: %v", err)
+		}
+		return intent, task
+	}
+
+	secrets.LLM_BASE_URL, secrets.LLM_CASSETTE_MODE, secrets.LLM_CASSETTE_DIR = server.URL, "record", dir
+	recordedIntent, recordedTask := run()
+	server.Close()
+	if calls != 2 {
+		t.Fatalf("recording made %d model calls, want 2", calls)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("got %d cassettes, want 2", len(files))
+	}
+
+	// The server is gone, so replay must be served from disk
+	secrets.LLM_CASSETTE_MODE = "replay"
+	intent, task := run()
+	if intent.Intent != recordedIntent.Intent || *task != *recordedTask {
+		t.Errorf("replay = %+v %+v, want %+v %+v", intent, task, recordedIntent, recordedTask)
+	}
+	if task.DueDate != "2026-03-03T15:00:00Z" {
+		t.Errorf("dueDate = %q", task.DueDate)
+	}
+
+	// A different prompt (or clock) has no cassette
+	if _, err := parseIntent(ctx, userID, "something else"); err == nil {
+		t.Error("expected an error for a request without a cassette")
+	}
+}
+
+func TestCassetteKeyDependsOnMessages(t *testing.T) {
+	req := GroqChatRequest{Model: "m", Messages: []GroqMessage{{Role: "system", Content: "a"}, {Role: "user", Content: "b"}}}
+	same := GroqChatRequest{Model: "m", Messages: []GroqMessage{{Role: "system", Content: "a"}, {Role: "user", Content: "b"}}}
+	shifted := GroqChatRequest{Model: "m", Messages: []GroqMessage{{Role: "system", Content: "ab"}, {Role: "user", Content: ""}}}
+	if cassetteKey(req) != cassetteKey(same) {
+		t.Error("equal requests have different keys")
+	}
+	if cassetteKey(req) == cassetteKey(shifted) {
+		t.Error("message boundaries are not part of the key")
+	}
+}
+
+func TestRetryingLLMClientRetriesProviderErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}],"usage":{"total_tokens":3}}`))
+	}))
+	defer server.Close()
+
+	client := &retryingLLMClient{next: &httpLLMClient{baseURL: server.URL, http: server.Client()}, maxAttempts: 3}
+	start := time.Now()
+	resp, err := client.Complete(context.Background(), GroqChatRequest{Model: "m"})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if calls != 2 || resp.Choices[0].Message.Content != "ok" || resp.Usage.TotalTokens != 3 {
+		t.Errorf("calls = %d, resp = %+v", calls, resp)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least the Retry-After of 1s", elapsed)
+	}
+}
+
+func TestRetryingLLMClientStopsAtDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &retryingLLMClient{next: &httpLLMClient{baseURL: server.URL, http: server.Client()}, maxAttempts: 3}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := client.Complete(ctx, GroqChatRequest{Model: "m"})
+	if !errors.Is(err, ErrProviderDown) {
+		t.Fatalf("err = %v, want ErrProviderDown", err)
+	}
+	if got := httpStatusForError(err); got != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", got)
+	}
+}
+
+func TestAIErrorCodes(t *testing.T) {
+	other := errors.New("no response choices from Groq API")
+	cases := []struct {
+		err    error
+		code   errs.ErrCode
+		status int
+	}{
+		{&llmError{kind: ErrRateLimited, msg: "rate limit exceeded"}, errs.ResourceExhausted, http.StatusTooManyRequests},
+		{&llmError{kind: ErrProviderDown, msg: "Groq API error (status 502)"}, errs.Unavailable, http.StatusServiceUnavailable},
+	}
+	for _, c := range cases {
+		converted := aiError(c.err)
+		e, ok := converted.(*errs.Error)
+		if !ok || e.Code != c.code || e.Message != c.err.Error() {
+			t.Errorf("aiError(%v) = %#v, want code %v", c.err, converted, c.code)
+		}
+		if got := aiErrorCode(c.err); got != c.code {
+			t.Errorf("aiErrorCode(%v) = %v, want %v", c.err, got, c.code)
+		}
+		if got := aiErrorCode(fmt.Errorf("chat: %w", converted)); got != c.code {
+			t.Errorf("aiErrorCode of converted %v = %v, want %v", c.err, got, c.code)
+		}
+		if got := httpStatusForError(converted); got != c.status {
+			t.Errorf("httpStatusForError(%v) = %d, want %d", c.err, got, c.status)
+		}
+	}
+	if aiError(other) != other || aiErrorCode(other) != errs.Unknown {
+		t.Error("other errors should pass through unclassified")
+	}
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	var calls int32
+	next := llmClientFunc(func(ctx context.Context, req GroqChatRequest) (*GroqChatResponse, error) {
+		atomic.AddInt32(&calls, 1)
+		if fail.Load() {
+			return nil, &llmError{kind: ErrProviderDown, msg: "down"}
+		}
+		return &GroqChatResponse{}, nil
+	})
+	breaker := &circuitBreaker{threshold: 2, cooldown: 50 * time.Millisecond}
+	client := &breakerLLMClient{breaker: breaker, next: next}
+	ctx := context.Background()
+
+	client.Complete(ctx, GroqChatRequest{})
+	client.Complete(ctx, GroqChatRequest{})
+	if !breaker.Open() {
+		t.Fatal("breaker should be open after 2 failures")
+	}
+	if _, err := client.Complete(ctx, GroqChatRequest{}); !errors.Is(err, ErrProviderDown) || calls != 2 {
+		t.Fatalf("open breaker: err = %v, calls = %d", err, calls)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	fail.Store(false)
+	if _, err := client.Complete(ctx, GroqChatRequest{}); err != nil {
+		t.Fatalf("trial call: %v", err)
+	}
+	if breaker.Open() {
+		t.Error("breaker should close after a successful trial")
+	}
+}
+
+func TestCircuitBreakerReleasesCancelledTrial(t *testing.T) {
+	var calls int32
+	next := llmClientFunc(func(ctx context.Context, req GroqChatRequest) (*GroqChatResponse, error) {
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			return nil, &llmError{kind: ErrProviderDown, msg: "down"}
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	breaker := &circuitBreaker{threshold: 2, cooldown: 20 * time.Millisecond}
+	client := &breakerLLMClient{breaker: breaker, next: next}
+	client.Complete(context.Background(), GroqChatRequest{})
+	client.Complete(context.Background(), GroqChatRequest{})
+	time.Sleep(30 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.Complete(ctx, GroqChatRequest{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("trial call: err = %v", err)
+	}
+	if !breaker.allow() {
+		t.Error("a cancelled trial should free the slot for the next trial")
+	}
+}
+
+type llmClientFunc func(ctx context.Context, req GroqChatRequest) (*GroqChatResponse, error)
+
+func (f llmClientFunc) Complete(ctx context.Context, req GroqChatRequest) (*GroqChatResponse, error) {
+	return f(ctx, req)
+}
+
+func TestHTTPLLMClientStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req GroqChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if !req.Stream {
+			t.Error("stream flag not set")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range []string{
+			`{"choices":[{"delta":{"role":"assistant"}}]}`,
+			`{"choices":[{"delta":{"content":"Hel"}}]}`,
+			`{"choices":[{"delta":{"content":"lo"}}],"x_groq":{"usage":{"prompt_tokens":7,"completion_tokens":2,"total_tokens":9}}}`,
+			`[DONE]`,
+		} {
+			w.Write([]byte("data: " + chunk + "\n\n"))
+		}
+	}))
+	defer server.Close()
+
+	client := &httpLLMClient{baseURL: server.URL, http: server.Client()}
+	var deltas []string
+	answer, usage, err := client.Stream(context.Background(), GroqChatRequest{Model: "m"}, func(s string) error {
+		deltas = append(deltas, s)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if answer != "Hello" || strings.Join(deltas, "|") != "Hel|lo" || usage.TotalTokens != 9 {
+		t.Errorf("answer = %q, deltas = %v, usage = %+v", answer, deltas, usage)
+	}
+}
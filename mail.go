@@ -0,0 +1,155 @@
+package encoreapp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Mail is an outgoing message. HTML is optional; with it the message is sent as
+// multipart/alternative with Text as the fallback.
+type Mail struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// MailSender delivers mail.
+type MailSender interface {
+	Send(ctx context.Context, m Mail) error
+}
+
+// newMailSender returns the sender chosen by MAIL_SENDER. Without it, mail goes over SMTP
+// when SMTP_HOST is set and into MAIL_DROP_DIR otherwise, so local runs need no server.
+func newMailSender() MailSender {
+	switch strings.ToLower(secrets.MAIL_SENDER) {
+	case "smtp":
+		return smtpMailSender{}
+	case "file":
+		return fileMailSender{dir: mailDropDir()}
+	}
+	if secrets.SMTP_HOST != "" {
+		return smtpMailSender{}
+	}
+	return fileMailSender{dir: mailDropDir()}
+}
+
+func mailDropDir() string {
+	if secrets.MAIL_DROP_DIR != "" {
+		return secrets.MAIL_DROP_DIR
+	}
+	return filepath.Join(os.TempDir(), "gtd-mail")
+}
+
+func mailFrom() string {
+	if secrets.SMTP_FROM != "" {
+		return secrets.SMTP_FROM
+	}
+	return "gtd@localhost"
+}
+
+// smtpMailSender sends using the SMTP_* settings.
+type smtpMailSender struct{}
+
+func (smtpMailSender) Send(ctx context.Context, m Mail) error {
+	if secrets.SMTP_HOST == "" || secrets.SMTP_FROM == "" {
+		return errors.New("SMTP_HOST and SMTP_FROM must be set")
+	}
+	port := secrets.SMTP_PORT
+	if port == "" {
+		port = "587"
+	}
+	var auth smtp.Auth
+	if secrets.SMTP_USERNAME != "" {
+		auth = smtp.PlainAuth("", secrets.SMTP_USERNAME, secrets.SMTP_PASSWORD, secrets.SMTP_HOST)
+	}
+	msg, err := buildMIMEMessage(secrets.SMTP_FROM, m, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(net.JoinHostPort(secrets.SMTP_HOST, port), auth, secrets.SMTP_FROM, []string{m.To}, msg)
+}
+
+// fileMailSender writes each message as an .eml file, for local development.
+type fileMailSender struct {
+	dir string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func (f fileMailSender) Send(ctx context.Context, m Mail) error {
+	now := time.Now()
+	msg, err := buildMIMEMessage(mailFrom(), m, now)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102-150405.000000000"), unsafeFileChars.ReplaceAllString(m.To, "_"))
+	return os.WriteFile(filepath.Join(f.dir, name), msg, 0o644)
+}
+
+// buildMIMEMessage renders m with headers, quoted-printable bodies and, when there is an
+// HTML body, a multipart/alternative structure.
+func buildMIMEMessage(from string, m Mail, date time.Time) ([]byte, error) {
+	if strings.ContainsAny(m.To, "\r\n") || strings.ContainsAny(from, "\r\n") {
+		return nil, errors.New("invalid mail address")
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMIME-Version: 1.0\r\n",
+		from, m.To, mime.QEncoding.Encode("utf-8", m.Subject), date.Format(time.RFC1123Z))
+
+	if m.HTML == "" {
+		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", m.Text},
+		{"text/html; charset=UTF-8", m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w interface{ Write([]byte) (int, error) }, s string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(s)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
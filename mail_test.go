@@ -0,0 +1,68 @@
+package encoreapp
+
+import (
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildMIMEMessageAlternative(t *testing.T) {
+	raw, err := buildMIMEMessage("gtd@example.com", Mail{
+		To:      "ada@example.com",
+		Subject: "Your day: Mo 2 März",
+		Text:    "plain",
+		HTML:    "<p>rich</p>",
+	}, time.Date(2026, 3, 2, 7, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "Your day: Mo 2 März" {
+		t.Errorf("subject = %q", subject)
+	}
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q", mediaType)
+	}
+	var bodies []string
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(p) // NextPart decodes quoted-printable
+		bodies = append(bodies, string(b))
+	}
+	if len(bodies) != 2 || bodies[0] != "plain" || bodies[1] != "<p>rich</p>" {
+		t.Errorf("parts = %q", bodies)
+	}
+
+	if _, err := buildMIMEMessage("gtd@example.com", Mail{To: "a@example.com\r\nBcc: x@example.com"}, time.Now()); err == nil {
+		t.Error("expected header injection to be rejected")
+	}
+}
+
+func TestFileMailSenderWritesEML(t *testing.T) {
+	dir := t.TempDir()
+	if err := (fileMailSender{dir: dir}).Send(context.Background(), Mail{To: "ada@example.com", Subject: "Hi", Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), "-ada_example.com.eml") {
+		t.Fatalf("entries = %v", entries)
+	}
+}
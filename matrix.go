@@ -0,0 +1,162 @@
+package encoreapp
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Eisenhower matrix: open, available tasks bucketed by importance and urgency, each bucket sorted by
+// taskScore. Explicit Important/Urgent flags win; otherwise priority 1-2 means important
+// and a deadline before the end of tomorrow means urgent.
+
+type TasksMatrixRequest struct {
+	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
+	Limit         int    `query:"limit"` // per quadrant, default 25, max 100
+}
+
+type MatrixTask struct {
+	Task      Task `json:"task"`
+	Score     int  `json:"score"`
+	Important bool `json:"important"`
+	Urgent    bool `json:"urgent"`
+}
+
+type TasksMatrixResponse struct {
+	DoFirst   []MatrixTask `json:"doFirst"`   // important and urgent
+	Schedule  []MatrixTask `json:"schedule"`  // important, not urgent
+	Delegate  []MatrixTask `json:"delegate"`  // urgent, not important
+	Eliminate []MatrixTask `json:"eliminate"` // neither
+}
+
+// encore:api public method=GET path=/api/tasks/matrix
+func GetTasksMatrix(ctx context.Context, req *TasksMatrixRequest) (*TasksMatrixResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	clock := clockFromContext(withUserClock(ctx, userID, req.TimeZone))
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 25
+	} else if limit > 100 {
+		limit = 100
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	cur, err := client.Database("gtd").Collection("tasks").Find(ctx, bson.M{
+		"userId":     userID,
+		"trashed":    false,
+		"completed":  false,
+		"category":   bson.M{"$nin": []string{"someday", "waiting"}},
+		"deferUntil": notDeferred(clock.Now),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var tasks []Task
+	for cur.Next(ctx) {
+		var t Task
+		if err := cur.Decode(&t); err == nil {
+			tasks = append(tasks, t)
+		}
+	}
+	return buildTasksMatrix(tasks, clock, limit), nil
+}
+
+func buildTasksMatrix(tasks []Task, clock userClock, limit int) *TasksMatrixResponse {
+	resp := &TasksMatrixResponse{DoFirst: []MatrixTask{}, Schedule: []MatrixTask{}, Delegate: []MatrixTask{}, Eliminate: []MatrixTask{}}
+	for _, t := range tasks {
+		mt := MatrixTask{Task: t, Score: taskScore(t, clock), Important: taskImportant(t), Urgent: taskUrgent(t, clock)}
+		switch {
+		case mt.Important && mt.Urgent:
+			resp.DoFirst = append(resp.DoFirst, mt)
+		case mt.Important:
+			resp.Schedule = append(resp.Schedule, mt)
+		case mt.Urgent:
+			resp.Delegate = append(resp.Delegate, mt)
+		default:
+			resp.Eliminate = append(resp.Eliminate, mt)
+		}
+	}
+	for _, q := range []*[]MatrixTask{&resp.DoFirst, &resp.Schedule, &resp.Delegate, &resp.Eliminate} {
+		sort.SliceStable(*q, func(i, j int) bool { return (*q)[i].Score > (*q)[j].Score })
+		if len(*q) > limit {
+			*q = (*q)[:limit]
+		}
+	}
+	return resp
+}
+
+// normalizePriority maps anything outside 1-5 to PriorityUnset.
+func normalizePriority(p int) int {
+	if p < 1 || p > 5 {
+		return PriorityUnset
+	}
+	return p
+}
+
+func taskImportant(t Task) bool {
+	if t.Important != nil {
+		return *t.Important
+	}
+	return t.Priority >= 1 && t.Priority <= 2
+}
+
+func taskUrgent(t Task, clock userClock) bool {
+	if t.Urgent != nil {
+		return *t.Urgent
+	}
+	return taskHasDeadline(t) && t.DueDate.Before(clock.Today().AddDate(0, 0, 2))
+}
+
+// taskHasDeadline reports whether the task has a due date. Undated tasks are stored
+// without one, so dueDate range queries leave them out as well.
+func taskHasDeadline(t Task) bool {
+	return t.DueDate != nil
+}
+
+// taskScore ranks a task from 0 to 100: up to 45 points for priority, 45 for an
+// approaching or missed deadline and 10 for age, so old tasks slowly surface.
+func taskScore(t Task, clock userClock) int {
+	score := 0
+	if t.Priority >= 1 && t.Priority <= 5 {
+		score += (6 - t.Priority) * 9
+	} else {
+		score += 12 // unset ranks between priorities 5 and 4
+	}
+	if taskHasDeadline(t) {
+		today := clock.Today()
+		due := t.DueDate.In(clock.Location())
+		switch {
+		case due.Before(today):
+			score += 45
+		case due.Before(today.AddDate(0, 0, 1)):
+			score += 40
+		case due.Before(today.AddDate(0, 0, 2)):
+			score += 32
+		case due.Before(today.AddDate(0, 0, 4)):
+			score += 22
+		case due.Before(today.AddDate(0, 0, 8)):
+			score += 12
+		case due.Before(today.AddDate(0, 0, 15)):
+			score += 5
+		}
+	}
+	if !t.CreatedAt.IsZero() {
+		age := int(clock.Now.Sub(t.CreatedAt).Hours() / 24 / 3) // a point every 3 days
+		if age > 10 {
+			age = 10
+		}
+		if age > 0 {
+			score += age
+		}
+	}
+	return score
+}
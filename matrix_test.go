@@ -0,0 +1,67 @@
+package encoreapp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildTasksMatrix(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	clock := userClock{Now: now}
+	created := now.AddDate(0, 0, -1)
+	at := func(days int) *time.Time { d := now.AddDate(0, 0, days); return &d }
+	yes, no := true, false
+
+	tasks := []Task{
+		{Title: "overdue p1", Priority: 1, DueDate: at(-2), CreatedAt: created},
+		{Title: "p2 next month", Priority: 2, DueDate: at(30), CreatedAt: created},
+		{Title: "unset due tomorrow", Priority: PriorityUnset, DueDate: at(1), CreatedAt: created},
+		{Title: "undated", Priority: PriorityUnset, CreatedAt: created},
+		{Title: "flagged", Priority: 5, Important: &yes, Urgent: &yes, CreatedAt: created},
+		{Title: "p1 not important", Priority: 1, Important: &no, DueDate: at(60), CreatedAt: created},
+	}
+	m := buildTasksMatrix(tasks, clock, 10)
+	titles := func(q []MatrixTask) []string {
+		var out []string
+		for _, mt := range q {
+			out = append(out, mt.Task.Title)
+		}
+		return out
+	}
+	check := func(name string, q []MatrixTask, want ...string) {
+		got := titles(q)
+		if len(got) != len(want) {
+			t.Errorf("%s = %q, want %q", name, got, want)
+			return
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s = %q, want %q", name, got, want)
+				return
+			}
+		}
+	}
+	check("doFirst", m.DoFirst, "overdue p1", "flagged")
+	check("schedule", m.Schedule, "p2 next month")
+	check("delegate", m.Delegate, "unset due tomorrow")
+	check("eliminate", m.Eliminate, "p1 not important", "undated")
+
+	if got := buildTasksMatrix(tasks, clock, 1); len(got.DoFirst) != 1 || len(got.Eliminate) != 1 {
+		t.Errorf("limit not applied: %d, %d", len(got.DoFirst), len(got.Eliminate))
+	}
+}
+
+func TestTaskScoreAgeIsCapped(t *testing.T) {
+	clock := userClock{Now: time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)}
+	fresh := Task{Priority: 3, CreatedAt: clock.Now}
+	old := Task{Priority: 3, CreatedAt: clock.Now.AddDate(0, -6, 0)}
+	if got := taskScore(fresh, clock); got != 27 {
+		t.Errorf("fresh score = %d, want 27", got)
+	}
+	if got := taskScore(old, clock); got != 37 {
+		t.Errorf("old score = %d, want 37", got)
+	}
+	if normalizePriority(0) != PriorityUnset || normalizePriority(7) != PriorityUnset || normalizePriority(4) != 4 {
+		t.Error("normalizePriority")
+	}
+}
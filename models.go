@@ -2,18 +2,31 @@ package encoreapp
 
 import (
 	"time"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // User represents a user in the system.
 type User struct {
-	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	FirebaseUID  string             `bson:"firebaseUid" json:"firebaseUid"`
-	Email        string             `bson:"email" json:"email"`
-	Name         string             `bson:"name" json:"name"`
-	Picture      string             `bson:"picture,omitempty" json:"picture,omitempty"`
-	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ID                  primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	FirebaseUID         string             `bson:"firebaseUid" json:"firebaseUid"`
+	Email               string             `bson:"email" json:"email"`
+	Name                string             `bson:"name" json:"name"`
+	Picture             string             `bson:"picture,omitempty" json:"picture,omitempty"`
+	TimeZone            string             `bson:"timeZone,omitempty" json:"timeZone,omitempty"` // IANA name, UTC if empty
+	Locale              string             `bson:"locale,omitempty" json:"locale,omitempty"`
+	Plan                string             `bson:"plan,omitempty" json:"plan,omitempty"`                       // AI quota plan, "free" if empty
+	AIGroundingDisabled bool               `bson:"aiGroundingDisabled,omitempty" json:"aiGroundingDisabled"`   // don't share task data with chat
+	PushDueDisabled     bool               `bson:"pushDueDisabled,omitempty" json:"pushDueDisabled"`           // no push when a task falls due
+	PushDigestDisabled  bool               `bson:"pushDigestDisabled,omitempty" json:"pushDigestDisabled"`     // no morning summary push
+	LastPushDigestOn    string             `bson:"lastPushDigestOn,omitempty" json:"-"`                        // YYYY-MM-DD of the last digest push
+	DigestFrequency     string             `bson:"digestFrequency,omitempty" json:"digestFrequency,omitempty"` // email digest: "daily", "weekly" (Mondays) or none
+	DigestTime          string             `bson:"digestTime,omitempty" json:"digestTime,omitempty"`           // HH:MM local send time, 07:00 if empty
+	LastEmailDigestOn   string             `bson:"lastEmailDigestOn,omitempty" json:"-"`                       // YYYY-MM-DD of the last digest email
+	CaptureToken        string             `bson:"captureToken,omitempty" json:"-"`                            // local part of the capture address
+	CaptureUseAI        bool               `bson:"captureUseAI,omitempty" json:"captureUseAI"`                 // extract due date and project from captured email
+	CreatedAt           time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt           time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
 
 // Project represents a project owned by a user.
@@ -27,21 +40,33 @@ type Project struct {
 	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
 
+// PriorityUnset is stored for tasks without a 1-5 priority, so they sort after prioritised ones.
+const PriorityUnset = 99
+
 // Task represents a task in the system.
+// Important and Urgent are explicit Eisenhower flags; when nil they are derived from the
+// priority and due date (see taskImportant and taskUrgent).
 type Task struct {
-	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
-	UserID        primitive.ObjectID  `bson:"userId" json:"userId"`
-	ProjectID     *primitive.ObjectID `bson:"projectId,omitempty" json:"projectId,omitempty"`
-	NextActionID  *primitive.ObjectID `bson:"nextActionId,omitempty" json:"nextActionId,omitempty"`
-	Title         string              `bson:"title" json:"title"`
-	Description   string              `bson:"description" json:"description"`
-	DueDate       *time.Time          `bson:"dueDate,omitempty" json:"dueDate,omitempty"`
-	Priority      int                 `bson:"priority" json:"priority"`
-	Completed     bool                `bson:"completed" json:"completed"`
-	Trashed       bool                `bson:"trashed" json:"trashed"`
-	Category      string              `bson:"category" json:"category"`
-	CreatedAt     time.Time           `bson:"createdAt" json:"createdAt"`
-	UpdatedAt     time.Time           `bson:"updatedAt" json:"updatedAt"`
+	ID               primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	UserID           primitive.ObjectID  `bson:"userId" json:"userId"`
+	ProjectID        *primitive.ObjectID `bson:"projectId,omitempty" json:"projectId,omitempty"`
+	NextActionID     *primitive.ObjectID `bson:"nextActionId,omitempty" json:"nextActionId,omitempty"`
+	Title            string              `bson:"title" json:"title"`
+	Description      string              `bson:"description" json:"description"`
+	DueDate          *time.Time          `bson:"dueDate,omitempty" json:"dueDate,omitempty"`
+	DeferUntil       *time.Time          `bson:"deferUntil,omitempty" json:"deferUntil,omitempty"` // hidden from default lists until then
+	Priority         int                 `bson:"priority" json:"priority"`
+	Completed        bool                `bson:"completed" json:"completed"`
+	CompletedAt      *time.Time          `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	Trashed          bool                `bson:"trashed" json:"trashed"`
+	Category         string              `bson:"category" json:"category"`
+	EstimatedMinutes int                 `bson:"estimatedMinutes,omitempty" json:"estimatedMinutes,omitempty"`
+	DelegatedTo      string              `bson:"delegatedTo,omitempty" json:"delegatedTo,omitempty"` // set for "waiting" tasks
+	Important        *bool               `bson:"important,omitempty" json:"important,omitempty"`
+	Urgent           *bool               `bson:"urgent,omitempty" json:"urgent,omitempty"`
+	DueNotifiedFor   *time.Time          `bson:"dueNotifiedFor,omitempty" json:"-"` // due date a push was sent for
+	CreatedAt        time.Time           `bson:"createdAt" json:"createdAt"`
+	UpdatedAt        time.Time           `bson:"updatedAt" json:"updatedAt"`
 }
 
 // NextAction represents a next action in the system.
@@ -53,3 +78,137 @@ type NextAction struct {
 	CreatedAt   time.Time           `bson:"createdAt" json:"createdAt"`
 	UpdatedAt   time.Time           `bson:"updatedAt" json:"updatedAt"`
 }
+
+// AIAction records the changes made by a single assistant request so it can be reverted.
+type AIAction struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"userId" json:"userId"`
+	Intent     string             `bson:"intent" json:"intent"`
+	Prompt     string             `bson:"prompt" json:"prompt"`
+	Changes    []AIActionChange   `bson:"changes" json:"changes"`
+	Reverted   bool               `bson:"reverted" json:"reverted"`
+	RevertedAt *time.Time         `bson:"revertedAt,omitempty" json:"revertedAt,omitempty"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// AIActionChange is a single document mutation within an AIAction.
+// Before is empty for documents the action created.
+type AIActionChange struct {
+	Collection string             `bson:"collection" json:"collection"`
+	EntityID   primitive.ObjectID `bson:"entityId" json:"entityId"`
+	Op         string             `bson:"op" json:"op"` // "create" or "update"
+	Before     bson.M             `bson:"before,omitempty" json:"-"`
+	After      bson.M             `bson:"after,omitempty" json:"-"`
+}
+
+// AIPendingIntent holds an assistant operation that is waiting for the user to pick
+// one of several matching tasks, or to confirm a bulk change.
+type AIPendingIntent struct {
+	ID           primitive.ObjectID   `bson:"_id,omitempty" json:"id"`
+	Token        string               `bson:"token" json:"token"`
+	UserID       primitive.ObjectID   `bson:"userId" json:"userId"`
+	Operation    string               `bson:"operation" json:"operation"` // "completeTask", "updateTask" or "bulk"
+	Prompt       string               `bson:"prompt" json:"prompt"`
+	Update       *aiEntityUpdate      `bson:"update,omitempty" json:"-"`
+	Bulk         *aiBulkOperation     `bson:"bulk,omitempty" json:"-"`
+	CandidateIDs []primitive.ObjectID `bson:"candidateIds" json:"candidateIds"`
+	ExpiresAt    time.Time            `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt    time.Time            `bson:"createdAt" json:"createdAt"`
+}
+
+// Embedding is the vector of a task's or project's text, used for semantic search.
+type Embedding struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"userId" json:"userId"`
+	EntityType string             `bson:"entityType" json:"entityType"` // "task" or "project"
+	EntityID   primitive.ObjectID `bson:"entityId" json:"entityId"`
+	Model      string             `bson:"model" json:"model"`
+	TextHash   string             `bson:"textHash" json:"textHash"` // detects edits since the vector was computed
+	Vector     []float64          `bson:"vector" json:"-"`
+	UpdatedAt  time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Perspective is a named, saved task query in the search syntax, e.g.
+// "priority:1 context:office due:week -is:waiting".
+type Perspective struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"userId" json:"userId"`
+	Name      string             `bson:"name" json:"name"`
+	Query     string             `bson:"query" json:"query"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Reminder is a notification scheduled for a task, either at a fixed time or a number of
+// minutes before the task's due date.
+type Reminder struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID        primitive.ObjectID `bson:"userId" json:"userId"`
+	TaskID        primitive.ObjectID `bson:"taskId" json:"taskId"`
+	RemindAt      time.Time          `bson:"remindAt" json:"remindAt"`
+	OffsetMinutes *int               `bson:"offsetMinutes,omitempty" json:"offsetMinutes,omitempty"` // relative to the due date, follows it when it changes
+	Status        string             `bson:"status" json:"status"`                                   // "pending", "sent", "dismissed", "cancelled" or "failed"
+	Attempts      int                `bson:"attempts" json:"attempts"`
+	LastError     string             `bson:"lastError,omitempty" json:"lastError,omitempty"`
+	ClaimedUntil  *time.Time         `bson:"claimedUntil,omitempty" json:"-"` // lease held by the worker sending it
+	SentAt        *time.Time         `bson:"sentAt,omitempty" json:"sentAt,omitempty"`
+	DismissedAt   *time.Time         `bson:"dismissedAt,omitempty" json:"dismissedAt,omitempty"`
+	CreatedAt     time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt     time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Device is a push notification target: an FCM registration token of one app install.
+type Device struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID     primitive.ObjectID `bson:"userId" json:"userId"`
+	Token      string             `bson:"token" json:"-"`
+	Platform   string             `bson:"platform" json:"platform"` // "ios", "android" or "web"
+	Name       string             `bson:"name,omitempty" json:"name,omitempty"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	LastSeenAt time.Time          `bson:"lastSeenAt" json:"lastSeenAt"`
+}
+
+// CapturedEmail records an email that was turned into a task through the user's
+// capture address. Attachment contents are not stored.
+type CapturedEmail struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      primitive.ObjectID `bson:"userId" json:"userId"`
+	TaskID      primitive.ObjectID `bson:"taskId" json:"taskId"`
+	MessageID   string             `bson:"messageId,omitempty" json:"messageId,omitempty"`
+	From        string             `bson:"from" json:"from"`
+	Subject     string             `bson:"subject" json:"subject"`
+	Attachments []EmailAttachment  `bson:"attachments,omitempty" json:"attachments,omitempty"`
+	UsedAI      bool               `bson:"usedAI" json:"usedAI"`
+	ReceivedAt  time.Time          `bson:"receivedAt" json:"receivedAt"`
+}
+
+type EmailAttachment struct {
+	Filename    string `bson:"filename" json:"filename"`
+	ContentType string `bson:"contentType" json:"contentType"`
+	Size        int64  `bson:"size" json:"size"` // decoded bytes
+}
+
+// PromptVersion is a stored variant of one of the named system prompts.
+type PromptVersion struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name      string             `bson:"name" json:"name"`
+	Version   int                `bson:"version" json:"version"`
+	Content   string             `bson:"content" json:"content"`
+	Weight    int                `bson:"weight" json:"weight"`
+	Active    bool               `bson:"active" json:"active"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// AIUsageDay is a user's AI consumption on one calendar day.
+type AIUsageDay struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID           primitive.ObjectID `bson:"userId" json:"userId"`
+	Day              string             `bson:"day" json:"day"` // YYYY-MM-DD in the user's time zone
+	Requests         int64              `bson:"requests" json:"requests"`
+	PromptTokens     int64              `bson:"promptTokens" json:"promptTokens"`
+	CompletionTokens int64              `bson:"completionTokens" json:"completionTokens"`
+	TotalTokens      int64              `bson:"totalTokens" json:"totalTokens"`
+	CostUSD          float64            `bson:"costUsd" json:"costUsd"`
+	UpdatedAt        time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
@@ -77,6 +77,7 @@ func CreateNextAction(ctx context.Context, req *CreateNextActionRequest) (*Creat
 	if err != nil {
 		return nil, errors.New("failed to create next action")
 	}
+	invalidateFuzzyIndex("nextactions", userID)
 	return &CreateNextActionResponse{NextAction: nextAction}, nil
 }
 
@@ -118,14 +119,17 @@ func UpdateNextAction(ctx context.Context, id string, req *CreateNextActionReque
 	if err != nil {
 		return nil, errors.New("invalid next action id")
 	}
+	before := snapshotForAction(ctx, col, objID)
 	update := bson.M{"updatedAt": time.Now()}
 	if req.ContextName != "" {
 		update["context_name"] = req.ContextName
+		defer invalidateFuzzyIndex("nextactions", userID)
 	}
 	_, err = col.UpdateOne(ctx, bson.M{"_id": objID, "userId": userID}, bson.M{"$set": update})
 	if err != nil {
 		return nil, errors.New("failed to update next action")
 	}
+	recordActionUpdate(ctx, col, objID, before)
 	var updated NextAction
 	err = col.FindOne(ctx, bson.M{"_id": objID, "userId": userID}).Decode(&updated)
 	if err != nil {
@@ -0,0 +1,168 @@
+package encoreapp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification is a message for one user, e.g. a due reminder.
+type Notification struct {
+	UserID primitive.ObjectID  `json:"userId"`
+	Kind   string              `json:"kind"` // "reminder"
+	Title  string              `json:"title"`
+	Body   string              `json:"body"`
+	TaskID *primitive.ObjectID `json:"taskId,omitempty"`
+	At     time.Time           `json:"at"`
+}
+
+// Notifier delivers notifications over one channel.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// newNotifiers returns the notifiers named in REMINDER_NOTIFIERS, or the log notifier.
+func newNotifiers() []Notifier {
+	var notifiers []Notifier
+	for _, name := range strings.Split(secrets.REMINDER_NOTIFIERS, ",") {
+		switch strings.TrimSpace(strings.ToLower(name)) {
+		case "":
+		case "log":
+			notifiers = append(notifiers, logNotifier{})
+		case "fcm":
+			notifiers = append(notifiers, fcmNotifier{})
+		case "email":
+			notifiers = append(notifiers, emailNotifier{sender: newMailSender(), lookup: userEmailAddress})
+		case "webhook":
+			notifiers = append(notifiers, &webhookNotifier{
+				url:    secrets.REMINDER_WEBHOOK_URL,
+				secret: secrets.REMINDER_WEBHOOK_SECRET,
+				http:   &http.Client{Timeout: 10 * time.Second},
+			})
+		default:
+			log.Printf("Unknown notifier %q ignored", name)
+		}
+	}
+	if len(notifiers) == 0 {
+		notifiers = append(notifiers, logNotifier{})
+	}
+	return notifiers
+}
+
+// logNotifier only logs, for local development.
+type logNotifier struct{}
+
+func (logNotifier) Name() string { return "log" }
+
+func (logNotifier) Notify(ctx context.Context, n Notification) error {
+	details := map[string]interface{}{"kind": n.Kind, "title": n.Title, "body": n.Body}
+	if n.TaskID != nil {
+		details["taskId"] = n.TaskID.Hex()
+	}
+	LogEvent("notification", n.UserID.Hex(), details)
+	return nil
+}
+
+// webhookNotifier POSTs the notification as JSON. With a secret, the body's HMAC-SHA256
+// is sent in X-Signature so receivers can verify it.
+type webhookNotifier struct {
+	url    string
+	secret string
+	http   *http.Client
+}
+
+func (w *webhookNotifier) Name() string { return "webhook" }
+
+func (w *webhookNotifier) Notify(ctx context.Context, n Notification) error {
+	if w.url == "" {
+		return errors.New("REMINDER_WEBHOOK_URL not set")
+	}
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != "" {
+		req.Header.Set("X-Signature", "sha256="+webhookSignature(w.secret, body))
+	}
+	resp, err := w.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// emailNotifier mails the notification to the user's address.
+type emailNotifier struct {
+	sender MailSender
+	lookup func(ctx context.Context, userID primitive.ObjectID) (string, error)
+}
+
+func (emailNotifier) Name() string { return "email" }
+
+func (e emailNotifier) Notify(ctx context.Context, n Notification) error {
+	to, err := e.lookup(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+	return e.sender.Send(ctx, Mail{To: to, Subject: n.Title, Text: n.Body})
+}
+
+func userEmailAddress(ctx context.Context, userID primitive.ObjectID) (string, error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return "", err
+	}
+	var user User
+	if err := client.Database("gtd").Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return "", err
+	}
+	if user.Email == "" {
+		return "", errors.New("user has no email address")
+	}
+	return user.Email, nil
+}
+
+// fcmNotifier pushes through Firebase Cloud Messaging to the user's registered devices.
+type fcmNotifier struct{}
+
+func (fcmNotifier) Name() string { return "fcm" }
+
+func (fcmNotifier) Notify(ctx context.Context, n Notification) error {
+	client, err := GetMongoClient()
+	if err != nil {
+		return err
+	}
+	data := map[string]string{"kind": n.Kind}
+	if n.TaskID != nil {
+		data["taskId"] = n.TaskID.Hex()
+	}
+	return sendPushToUser(ctx, client.Database("gtd"), n.UserID, PushMessage{Title: n.Title, Body: n.Body, Data: data})
+}
@@ -0,0 +1,318 @@
+package encoreapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	fuzzy "github.com/paul-mannino/go-fuzzywuzzy"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Perspectives are saved task queries in the search syntax (see search.go), evaluated on
+// demand so they always reflect the current tasks.
+
+type GetPerspectivesRequest struct {
+	Authorization string `header:"Authorization"`
+}
+
+type GetPerspectivesResponse struct {
+	Perspectives []Perspective `json:"perspectives"`
+}
+
+type CreatePerspectiveRequest struct {
+	Authorization string `header:"Authorization"`
+	Name          string `json:"name"`
+	Query         string `json:"query"`
+}
+
+type PerspectiveResponse struct {
+	Perspective Perspective `json:"perspective"`
+}
+
+type PerspectiveTasksRequest struct {
+	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
+	Limit         int    `query:"limit"` // default 100, max 500
+}
+
+type PerspectiveTasksResponse struct {
+	Perspective Perspective `json:"perspective"`
+	Tasks       []Task      `json:"tasks"`
+	Message     string      `json:"message,omitempty"`
+}
+
+// encore:api public method=GET path=/api/perspectives
+func GetPerspectives(ctx context.Context, req *GetPerspectivesRequest) (*GetPerspectivesResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("perspectives")
+	cur, err := col.Find(ctx, bson.M{"userId": userID}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	perspectives := []Perspective{}
+	for cur.Next(ctx) {
+		var p Perspective
+		if err := cur.Decode(&p); err == nil {
+			perspectives = append(perspectives, p)
+		}
+	}
+	return &GetPerspectivesResponse{Perspectives: perspectives}, nil
+}
+
+// encore:api public method=POST path=/api/perspectives
+func CreatePerspective(ctx context.Context, req *CreatePerspectiveRequest) (*PerspectiveResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	name, query := strings.TrimSpace(req.Name), strings.TrimSpace(req.Query)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	if err := validatePerspectiveQuery(query); err != nil {
+		return nil, err
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("perspectives")
+	if perspectiveNameTaken(ctx, col, userID, name, primitive.NilObjectID) {
+		return nil, fmt.Errorf("a perspective named \"%s\" already exists", name)
+	}
+	perspective := Perspective{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      name,
+		Query:     query,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if _, err := col.InsertOne(ctx, perspective); err != nil {
+		return nil, errors.New("failed to create perspective")
+	}
+	return &PerspectiveResponse{Perspective: perspective}, nil
+}
+
+// encore:api public method=GET path=/api/perspectives/:id
+func GetPerspective(ctx context.Context, id string, req *GetPerspectivesRequest) (*PerspectiveResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid perspective id")
+	}
+	var perspective Perspective
+	err = client.Database("gtd").Collection("perspectives").FindOne(ctx, bson.M{"_id": objID, "userId": userID}).Decode(&perspective)
+	if err != nil {
+		return nil, errors.New("perspective not found")
+	}
+	return &PerspectiveResponse{Perspective: perspective}, nil
+}
+
+// encore:api public method=PUT path=/api/perspectives/:id
+func UpdatePerspective(ctx context.Context, id string, req *CreatePerspectiveRequest) (*PerspectiveResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("perspectives")
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid perspective id")
+	}
+	update := bson.M{"updatedAt": time.Now()}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		if perspectiveNameTaken(ctx, col, userID, name, objID) {
+			return nil, fmt.Errorf("a perspective named \"%s\" already exists", name)
+		}
+		update["name"] = name
+	}
+	if query := strings.TrimSpace(req.Query); query != "" {
+		if err := validatePerspectiveQuery(query); err != nil {
+			return nil, err
+		}
+		update["query"] = query
+	}
+	res, err := col.UpdateOne(ctx, bson.M{"_id": objID, "userId": userID}, bson.M{"$set": update})
+	if err != nil {
+		return nil, errors.New("failed to update perspective")
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("perspective not found")
+	}
+	var updated Perspective
+	if err := col.FindOne(ctx, bson.M{"_id": objID}).Decode(&updated); err != nil {
+		return nil, errors.New("failed to fetch updated perspective")
+	}
+	return &PerspectiveResponse{Perspective: updated}, nil
+}
+
+// encore:api public method=DELETE path=/api/perspectives/:id
+func DeletePerspective(ctx context.Context, id string, req *GetPerspectivesRequest) (*DeleteTaskResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid perspective id")
+	}
+	res, err := client.Database("gtd").Collection("perspectives").DeleteOne(ctx, bson.M{"_id": objID, "userId": userID})
+	if err != nil || res.DeletedCount == 0 {
+		return nil, errors.New("perspective not found or not authorized")
+	}
+	return &DeleteTaskResponse{Success: true}, nil
+}
+
+// encore:api public method=GET path=/api/perspectives/:id/tasks
+func GetPerspectiveTasks(ctx context.Context, id string, req *PerspectiveTasksRequest) (*PerspectiveTasksResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	db := client.Database("gtd")
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid perspective id")
+	}
+	var perspective Perspective
+	if err := db.Collection("perspectives").FindOne(ctx, bson.M{"_id": objID, "userId": userID}).Decode(&perspective); err != nil {
+		return nil, errors.New("perspective not found")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 100
+	} else if limit > 500 {
+		limit = 500
+	}
+	tasks, message, err := perspectiveTasks(ctx, db, perspective, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &PerspectiveTasksResponse{Perspective: perspective, Tasks: tasks, Message: message}, nil
+}
+
+// validatePerspectiveQuery checks that query parses and selects tasks.
+func validatePerspectiveQuery(query string) error {
+	if query == "" {
+		return errors.New("query is required")
+	}
+	sq, err := parseSearchQuery(query)
+	if err != nil {
+		return err
+	}
+	if sq.Type != "" && sq.Type != "task" {
+		return errors.New("perspectives can only list tasks")
+	}
+	// Build the filter once so bad is: and due: values are caught now rather than on
+	// every evaluation. Projects and contexts are looked up when the perspective is
+	// opened, as they can be created or renamed later.
+	sq.Project, sq.Context = "", ""
+	_, _, err = sq.taskFilter(context.Background(), primitive.NilObjectID, userClock{Now: time.Now()})
+	return err
+}
+
+func perspectiveNameTaken(ctx context.Context, col *mongo.Collection, userID primitive.ObjectID, name string, except primitive.ObjectID) bool {
+	n, err := col.CountDocuments(ctx, bson.M{
+		"userId": userID,
+		"_id":    bson.M{"$ne": except},
+		"name":   bson.M{"$regex": "^" + regexp.QuoteMeta(name) + "$", "$options": "i"},
+	})
+	return err == nil && n > 0
+}
+
+// perspectiveTasks evaluates p. The message is set when the query names a project or
+// context that doesn't exist.
+func perspectiveTasks(ctx context.Context, db *mongo.Database, p Perspective, limit int) ([]Task, string, error) {
+	sq, err := parseSearchQuery(p.Query)
+	if err != nil {
+		return nil, "", err
+	}
+	filter, notFound, err := sq.taskFilter(ctx, p.UserID, clockFromContext(ctx))
+	if err != nil {
+		return nil, "", err
+	}
+	tasks := []Task{}
+	if notFound != "" {
+		return tasks, notFound, nil
+	}
+	if sq.Text != "" {
+		ensureSearchIndexes(ctx, db)
+	}
+	cur, err := db.Collection("tasks").Find(ctx, withTextSearch(filter, sq), textFindOptions(sq, limit))
+	if err != nil {
+		return nil, "", err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var t Task
+		if err := cur.Decode(&t); err == nil {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks, "", nil
+}
+
+// findPerspectiveByName returns the user's perspective best matching name, e.g.
+// "focus list" for a perspective named "Focus".
+func findPerspectiveByName(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, name string) *Perspective {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil
+	}
+	cur, err := db.Collection("perspectives").Find(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return nil
+	}
+	defer cur.Close(ctx)
+	var best *Perspective
+	bestScore := 0
+	for cur.Next(ctx) {
+		var p Perspective
+		if err := cur.Decode(&p); err != nil {
+			continue
+		}
+		if strings.EqualFold(p.Name, name) {
+			return &p
+		}
+		if score := fuzzy.TokenSetRatio(strings.ToLower(name), strings.ToLower(p.Name)); score >= 80 && score > bestScore {
+			best, bestScore = &p, score
+		}
+	}
+	return best
+}
@@ -82,6 +82,9 @@ func CreateProject(ctx context.Context, req *CreateProjectRequest) (*CreateProje
 	if err != nil {
 		return nil, errors.New("failed to create project")
 	}
+	recordActionCreate(ctx, col, project.ID)
+	invalidateFuzzyIndex("projects", userID)
+	refreshEmbedding(userID, "project", project.ID, projectEmbeddingText(project))
 	return &CreateProjectResponse{Project: project}, nil
 }
 
@@ -123,9 +126,11 @@ func UpdateProject(ctx context.Context, id string, req *CreateProjectRequest) (*
 	if err != nil {
 		return nil, errors.New("invalid project id")
 	}
+	before := snapshotForAction(ctx, col, objID)
 	update := bson.M{"updatedAt": time.Now()}
 	if req.Name != "" {
 		update["name"] = req.Name
+		defer invalidateFuzzyIndex("projects", userID)
 	}
 	if req.Description != "" {
 		update["description"] = req.Description
@@ -134,11 +139,13 @@ func UpdateProject(ctx context.Context, id string, req *CreateProjectRequest) (*
 	if err != nil {
 		return nil, errors.New("failed to update project")
 	}
+	recordActionUpdate(ctx, col, objID, before)
 	var updated Project
 	err = col.FindOne(ctx, bson.M{"_id": objID, "userId": userID}).Decode(&updated)
 	if err != nil {
 		return nil, errors.New("failed to fetch updated project")
 	}
+	refreshEmbedding(userID, "project", updated.ID, projectEmbeddingText(updated))
 	return &CreateProjectResponse{Project: updated}, nil
 }
 
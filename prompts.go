@@ -0,0 +1,304 @@
+package encoreapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Prompt registry: system prompts can be overridden per name from the "prompts"
+// collection without a deploy. Several active versions of one prompt split users by
+// weight; the constants in ai_utils.go are used when no version is active.
+
+const (
+	promptParseIntent   = "parseIntent"
+	promptChat          = "chat"
+	promptSummarizer    = "summarizer"
+	promptCreateTask    = "createTask"
+	promptCreateProject = "createProject"
+	promptCompleteTask  = "completeTask"
+	promptUpdateEntity  = "updateEntity"
+	promptListEntities  = "listEntities"
+	promptBulkOperation = "bulkOperation"
+	promptPlanDay       = "planDay"
+	promptProcessInbox  = "processInbox"
+	promptBreakdown     = "projectBreakdown"
+)
+
+var defaultPrompts = map[string]string{
+	promptParseIntent:   SystemPromptParseIntent,
+	promptChat:          SystemPromptChat,
+	promptSummarizer:    SystemPromptSummarizer,
+	promptCreateTask:    SystemPromptCreateTask,
+	promptCreateProject: SystemPromptCreateProject,
+	promptCompleteTask:  SystemPromptCompleteTask,
+	promptUpdateEntity:  SystemPromptUpdateEntity,
+	promptListEntities:  SystemPromptListEntities,
+	promptBulkOperation: SystemPromptBulkOperation,
+	promptPlanDay:       SystemPromptPlanDay,
+	promptProcessInbox:  SystemPromptProcessInbox,
+	promptBreakdown:     SystemPromptProjectBreakdown,
+}
+
+const (
+	// How long loaded prompt versions are reused before reading the collection again.
+	promptCacheTTL = time.Minute
+	// How many version numbers CreatePromptVersion tries when concurrent creates collide.
+	promptCreateAttempts = 5
+)
+
+// activePrompt is the system prompt chosen for one call.
+type activePrompt struct {
+	Name    string
+	Version int // 0 is the built-in default
+	Text    string
+}
+
+// Label identifies the prompt version in logs, e.g. "parseIntent@v3".
+func (p activePrompt) Label() string {
+	if p.Version == 0 {
+		return p.Name + "@default"
+	}
+	return fmt.Sprintf("%s@v%d", p.Name, p.Version)
+}
+
+type promptCacheEntry struct {
+	versions []PromptVersion
+	loadedAt time.Time
+}
+
+var (
+	promptCacheMu sync.Mutex
+	promptCache   = map[string]promptCacheEntry{}
+)
+
+// getPrompt returns the system prompt to use for name and userID. Assignment between
+// active versions is a stable hash of the user and prompt name, so a user keeps seeing
+// the same variant as long as the weights don't change.
+func getPrompt(ctx context.Context, name string, userID primitive.ObjectID) activePrompt {
+	fallback := activePrompt{Name: name, Text: defaultPrompts[name]}
+	versions := loadPromptVersions(ctx, name)
+	total := 0
+	for _, v := range versions {
+		total += v.Weight
+	}
+	if total <= 0 {
+		return fallback
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(userID.Hex() + ":" + name))
+	bucket := int(h.Sum32() % uint32(total))
+	for _, v := range versions {
+		if bucket < v.Weight {
+			return activePrompt{Name: name, Version: v.Version, Text: v.Content}
+		}
+		bucket -= v.Weight
+	}
+	return fallback
+}
+
+// loadPromptVersions returns the active, weighted versions of a prompt ordered by version.
+// Errors are logged and treated as "no overrides" so the defaults keep working.
+func loadPromptVersions(ctx context.Context, name string) []PromptVersion {
+	promptCacheMu.Lock()
+	entry, ok := promptCache[name]
+	promptCacheMu.Unlock()
+	if ok && time.Since(entry.loadedAt) < promptCacheTTL {
+		return entry.versions
+	}
+
+	versions := []PromptVersion{}
+	client, err := GetMongoClient()
+	if err != nil {
+		return versions
+	}
+	col := client.Database("gtd").Collection("prompts")
+	opts := options.Find().SetSort(bson.M{"version": 1})
+	cur, err := col.Find(ctx, bson.M{"name": name, "active": true, "weight": bson.M{"$gt": 0}}, opts)
+	if err != nil {
+		log.Printf("Failed to load prompt versions for %s: %v", name, err)
+		return versions
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var v PromptVersion
+		if err := cur.Decode(&v); err == nil {
+			versions = append(versions, v)
+		}
+	}
+
+	promptCacheMu.Lock()
+	promptCache[name] = promptCacheEntry{versions: versions, loadedAt: time.Now()}
+	promptCacheMu.Unlock()
+	return versions
+}
+
+func invalidatePromptCache(name string) {
+	promptCacheMu.Lock()
+	delete(promptCache, name)
+	promptCacheMu.Unlock()
+}
+
+// Prompt registry admin endpoints (private)
+type CreatePromptVersionRequest struct {
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	Weight  int    `json:"weight"` // share of users relative to the other active versions
+	Active  bool   `json:"active"`
+}
+
+type PromptVersionResponse struct {
+	Prompt PromptVersion `json:"prompt"`
+}
+
+type ListPromptVersionsResponse struct {
+	Name     string          `json:"name"`
+	Default  string          `json:"default"`
+	Versions []PromptVersion `json:"versions"`
+}
+
+// encore:api private method=POST path=/api/admin/prompts
+func CreatePromptVersion(ctx context.Context, req *CreatePromptVersionRequest) (*PromptVersionResponse, error) {
+	if _, ok := defaultPrompts[req.Name]; !ok {
+		return nil, errors.New("unknown prompt name")
+	}
+	if req.Content == "" {
+		return nil, errors.New("content is required")
+	}
+	if req.Weight < 0 {
+		return nil, errors.New("weight must not be negative")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("prompts")
+	ensurePromptIndexes(ctx, col)
+
+	// Concurrent creates can pick the same next version; the unique index rejects all
+	// but one, and the others retry with a fresh number.
+	for attempt := 0; attempt < promptCreateAttempts; attempt++ {
+		var latest PromptVersion
+		opts := options.FindOne().SetSort(bson.M{"version": -1})
+		if err := col.FindOne(ctx, bson.M{"name": req.Name}, opts).Decode(&latest); err != nil {
+			latest.Version = 0
+		}
+		prompt := PromptVersion{
+			ID:        primitive.NewObjectID(),
+			Name:      req.Name,
+			Version:   latest.Version + 1,
+			Content:   req.Content,
+			Weight:    req.Weight,
+			Active:    req.Active,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		_, err := col.InsertOne(ctx, prompt)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.New("failed to create prompt version")
+		}
+		invalidatePromptCache(req.Name)
+		return &PromptVersionResponse{Prompt: prompt}, nil
+	}
+	return nil, errors.New("failed to create prompt version, please retry")
+}
+
+var (
+	promptIndexMu   sync.Mutex
+	promptIndexDone bool
+)
+
+// ensurePromptIndexes creates the unique (name, version) index the create retry relies
+// on. It is only marked done once creation succeeds, so a failure is retried next call.
+func ensurePromptIndexes(ctx context.Context, col *mongo.Collection) {
+	promptIndexMu.Lock()
+	defer promptIndexMu.Unlock()
+	if promptIndexDone {
+		return
+	}
+	_, err := col.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "name", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Failed to create prompts index: %v", err)
+		return
+	}
+	promptIndexDone = true
+}
+
+// encore:api private method=GET path=/api/admin/prompts/:name
+func ListPromptVersions(ctx context.Context, name string) (*ListPromptVersionsResponse, error) {
+	def, ok := defaultPrompts[name]
+	if !ok {
+		return nil, errors.New("unknown prompt name")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("prompts")
+	cur, err := col.Find(ctx, bson.M{"name": name}, options.Find().SetSort(bson.M{"version": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	versions := []PromptVersion{}
+	for cur.Next(ctx) {
+		var v PromptVersion
+		if err := cur.Decode(&v); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	return &ListPromptVersionsResponse{Name: name, Default: def, Versions: versions}, nil
+}
+
+type UpdatePromptVersionRequest struct {
+	Weight *int  `json:"weight,omitempty"`
+	Active *bool `json:"active,omitempty"`
+}
+
+// UpdatePromptVersion changes the traffic weight of a version or (de)activates it.
+// Content is immutable so logged versions stay meaningful.
+// encore:api private method=PUT path=/api/admin/prompts/:name/:version
+func UpdatePromptVersion(ctx context.Context, name string, version int, req *UpdatePromptVersionRequest) (*PromptVersionResponse, error) {
+	update := bson.M{"updatedAt": time.Now()}
+	if req.Weight != nil {
+		if *req.Weight < 0 {
+			return nil, errors.New("weight must not be negative")
+		}
+		update["weight"] = *req.Weight
+	}
+	if req.Active != nil {
+		update["active"] = *req.Active
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("prompts")
+	var prompt PromptVersion
+	err = col.FindOneAndUpdate(ctx,
+		bson.M{"name": name, "version": version},
+		bson.M{"$set": update},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&prompt)
+	if err != nil {
+		return nil, errors.New("prompt version not found")
+	}
+	invalidatePromptCache(name)
+	return &PromptVersionResponse{Prompt: prompt}, nil
+}
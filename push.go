@@ -0,0 +1,431 @@
+package encoreapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"encore.dev/cron"
+	"firebase.google.com/go/v4/messaging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Push notifications to registered devices through Firebase Cloud Messaging:
+// reminders (via fcmNotifier), a push when a task falls due, and a morning digest of
+// what's due and overdue. Cron jobs run the due and digest dispatches.
+
+const (
+	fcmMulticastLimit = 500
+	duePushLookback   = time.Hour // tasks that fell due longer ago are left to the digest
+	pushDigestHour    = 8         // local time
+)
+
+// PushMessage is a notification for a user's devices.
+type PushMessage struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// PushSender delivers a message to FCM registration tokens and returns the tokens that
+// are no longer registered.
+type PushSender interface {
+	Send(ctx context.Context, tokens []string, msg PushMessage) (stale []string, err error)
+}
+
+// pushSender is the sender used by the app; tests replace it with a fake.
+var pushSender PushSender = fcmPushSender{}
+
+type fcmPushSender struct{}
+
+func (fcmPushSender) Send(ctx context.Context, tokens []string, msg PushMessage) ([]string, error) {
+	client, err := getFirebaseMessaging(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var stale []string
+	delivered := 0
+	for start := 0; start < len(tokens); start += fcmMulticastLimit {
+		batch := tokens[start:min(start+fcmMulticastLimit, len(tokens))]
+		resp, err := client.SendEachForMulticast(ctx, &messaging.MulticastMessage{
+			Tokens:       batch,
+			Notification: &messaging.Notification{Title: msg.Title, Body: msg.Body},
+			Data:         msg.Data,
+		})
+		if err != nil {
+			return stale, err
+		}
+		delivered += resp.SuccessCount
+		for i, r := range resp.Responses {
+			if !r.Success && (messaging.IsUnregistered(r.Error) || messaging.IsSenderIDMismatch(r.Error)) {
+				stale = append(stale, batch[i])
+			}
+		}
+	}
+	if delivered == 0 && len(stale) < len(tokens) {
+		return stale, errors.New("push delivery failed for all devices")
+	}
+	return stale, nil
+}
+
+type RegisterDeviceRequest struct {
+	Authorization string `header:"Authorization"`
+	Token         string `json:"token"`
+	Platform      string `json:"platform"` // "ios", "android" or "web"
+	Name          string `json:"name,omitempty"`
+}
+
+type DeviceResponse struct {
+	Device Device `json:"device"`
+}
+
+type GetDevicesRequest struct {
+	Authorization string `header:"Authorization"`
+}
+
+type GetDevicesResponse struct {
+	Devices []Device `json:"devices"`
+}
+
+type DispatchPushResponse struct {
+	Sent int `json:"sent"`
+}
+
+// RegisterDevice stores the FCM token of an app install. Registering a known token again
+// updates it, and moves it to the current user if someone else signed in on the device.
+// encore:api public method=POST path=/api/devices
+func RegisterDevice(ctx context.Context, req *RegisterDeviceRequest) (*DeviceResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	token := strings.TrimSpace(req.Token)
+	if token == "" {
+		return nil, errors.New("token is required")
+	}
+	platform := strings.ToLower(req.Platform)
+	switch platform {
+	case "ios", "android", "web":
+	default:
+		return nil, errors.New("platform must be ios, android or web")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("devices")
+	ensureDeviceIndexes(ctx, col)
+	now := time.Now()
+	var device Device
+	err = col.FindOneAndUpdate(ctx,
+		bson.M{"token": token},
+		bson.M{
+			"$set":         bson.M{"userId": userID, "platform": platform, "name": req.Name, "lastSeenAt": now},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&device)
+	if err != nil {
+		return nil, errors.New("failed to register device")
+	}
+	return &DeviceResponse{Device: device}, nil
+}
+
+// encore:api public method=GET path=/api/devices
+func GetDevices(ctx context.Context, req *GetDevicesRequest) (*GetDevicesResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	devices, err := userDevices(ctx, client.Database("gtd"), userID)
+	if err != nil {
+		return nil, err
+	}
+	return &GetDevicesResponse{Devices: devices}, nil
+}
+
+// encore:api public method=DELETE path=/api/devices/:id
+func DeleteDevice(ctx context.Context, id string, req *GetDevicesRequest) (*DeleteTaskResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid device id")
+	}
+	res, err := client.Database("gtd").Collection("devices").DeleteOne(ctx, bson.M{"_id": objID, "userId": userID})
+	if err != nil || res.DeletedCount == 0 {
+		return nil, errors.New("device not found or not authorized")
+	}
+	return &DeleteTaskResponse{Success: true}, nil
+}
+
+var _ = cron.NewJob("dispatch-due-pushes", cron.JobConfig{
+	Title:    "Push tasks that fell due",
+	Every:    1 * cron.Minute,
+	Endpoint: DispatchPush,
+})
+
+var _ = cron.NewJob("dispatch-push-digests", cron.JobConfig{
+	Title:    "Send morning push digests",
+	Every:    5 * cron.Minute,
+	Endpoint: DispatchPushDigests,
+})
+
+// DispatchPush sends pushes for tasks that fell due.
+// encore:api private method=POST path=/api/internal/push/dispatch
+func DispatchPush(ctx context.Context) (*DispatchPushResponse, error) {
+	ensureServices()
+	sent, err := dispatchDuePushes(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &DispatchPushResponse{Sent: sent}, nil
+}
+
+// DispatchPushDigests sends the morning digest to users who are due one.
+// encore:api private method=POST path=/api/internal/push/digests
+func DispatchPushDigests(ctx context.Context) (*DispatchPushResponse, error) {
+	ensureServices()
+	sent, err := dispatchPushDigests(ctx, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &DispatchPushResponse{Sent: sent}, nil
+}
+
+var deviceIndexesOnce sync.Once
+
+func ensureDeviceIndexes(ctx context.Context, col *mongo.Collection) {
+	deviceIndexesOnce.Do(func() {
+		_, err := col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "userId", Value: 1}}},
+		})
+		if err != nil {
+			log.Printf("Failed to create device indexes: %v", err)
+		}
+	})
+}
+
+func userDevices(ctx context.Context, db *mongo.Database, userID primitive.ObjectID) ([]Device, error) {
+	cur, err := db.Collection("devices").Find(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	devices := []Device{}
+	for cur.Next(ctx) {
+		var d Device
+		if err := cur.Decode(&d); err == nil {
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+var errNoDevices = errors.New("no registered devices")
+
+// sendPushToUser sends msg to all of the user's devices and forgets stale tokens.
+func sendPushToUser(ctx context.Context, db *mongo.Database, userID primitive.ObjectID, msg PushMessage) error {
+	devices, err := userDevices(ctx, db, userID)
+	if err != nil {
+		return err
+	}
+	if len(devices) == 0 {
+		return errNoDevices
+	}
+	stale, err := deliverPush(ctx, pushSender, devices, msg)
+	if len(stale) > 0 {
+		if _, err := db.Collection("devices").DeleteMany(ctx, bson.M{"_id": bson.M{"$in": stale}}); err != nil {
+			log.Printf("Failed to remove stale devices: %v", err)
+		}
+	}
+	return err
+}
+
+// deliverPush sends msg to devices and returns the IDs of devices whose token is stale.
+func deliverPush(ctx context.Context, sender PushSender, devices []Device, msg PushMessage) ([]primitive.ObjectID, error) {
+	if len(devices) == 0 {
+		return nil, nil
+	}
+	tokens := make([]string, len(devices))
+	byToken := map[string]primitive.ObjectID{}
+	for i, d := range devices {
+		tokens[i] = d.Token
+		byToken[d.Token] = d.ID
+	}
+	staleTokens, err := sender.Send(ctx, tokens, msg)
+	var stale []primitive.ObjectID
+	for _, t := range staleTokens {
+		if id, ok := byToken[t]; ok {
+			stale = append(stale, id)
+		}
+	}
+	return stale, err
+}
+
+// dispatchDuePushes notifies users of tasks that fell due since duePushLookback. Each
+// task is claimed by recording the due date it was notified for, so a due date moved
+// later triggers a new push.
+func dispatchDuePushes(ctx context.Context, now time.Time) (int, error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return 0, err
+	}
+	db := client.Database("gtd")
+	tasksCol := db.Collection("tasks")
+	// Already notified due dates are left out in the query, so they can't fill the batch
+	// and starve new ones.
+	cur, err := tasksCol.Find(ctx, bson.M{
+		"completed":  false,
+		"trashed":    false,
+		"dueDate":    bson.M{"$gt": now.Add(-duePushLookback), "$lte": now},
+		"deferUntil": notDeferred(now),
+		"$expr":      bson.M{"$ne": bson.A{"$dueNotifiedFor", "$dueDate"}},
+	}, options.Find().SetSort(bson.D{{Key: "dueDate", Value: 1}}).SetLimit(500))
+	if err != nil {
+		return 0, err
+	}
+	var tasks []Task
+	if err := cur.All(ctx, &tasks); err != nil {
+		return 0, err
+	}
+
+	disabled := map[primitive.ObjectID]bool{}
+	sent := 0
+	for _, t := range tasks {
+		if t.DueNotifiedFor != nil && t.DueNotifiedFor.Equal(*t.DueDate) {
+			continue
+		}
+		off, seen := disabled[t.UserID]
+		if !seen {
+			var user User
+			_ = db.Collection("users").FindOne(ctx, bson.M{"_id": t.UserID}).Decode(&user)
+			off = user.PushDueDisabled
+			disabled[t.UserID] = off
+		}
+		if off {
+			continue
+		}
+		res, err := tasksCol.UpdateOne(ctx,
+			bson.M{"_id": t.ID, "dueNotifiedFor": bson.M{"$ne": *t.DueDate}},
+			bson.M{"$set": bson.M{"dueNotifiedFor": *t.DueDate}},
+		)
+		if err != nil || res.ModifiedCount == 0 {
+			continue // another instance got it
+		}
+		if err := sendPushToUser(ctx, db, t.UserID, duePushMessage(t)); err != nil {
+			if errors.Is(err, errNoDevices) {
+				continue
+			}
+			LogEvent("push_failed", t.UserID.Hex(), map[string]interface{}{"kind": "due", "taskId": t.ID.Hex(), "error": err.Error()})
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// dispatchPushDigests sends the morning digest to users with devices whose local time
+// is past pushDigestHour and who haven't had one today.
+func dispatchPushDigests(ctx context.Context, now time.Time) (int, error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return 0, err
+	}
+	db := client.Database("gtd")
+	userIDs, err := db.Collection("devices").Distinct(ctx, "userId", bson.M{})
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, v := range userIDs {
+		userID, ok := v.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		var user User
+		if err := db.Collection("users").FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil || user.PushDigestDisabled {
+			continue
+		}
+		loc, ok := loadTimeZone(user.TimeZone)
+		if !ok {
+			loc = time.UTC
+		}
+		clock := userClock{Now: now.In(loc), Locale: user.Locale}
+		today := clock.Today().Format("2006-01-02")
+		if clock.Now.Hour() < pushDigestHour || user.LastPushDigestOn == today {
+			continue
+		}
+		res, err := db.Collection("users").UpdateOne(ctx,
+			bson.M{"_id": userID, "lastPushDigestOn": bson.M{"$ne": today}},
+			bson.M{"$set": bson.M{"lastPushDigestOn": today}},
+		)
+		if err != nil || res.ModifiedCount == 0 {
+			continue
+		}
+		dueToday, _ := db.Collection("tasks").CountDocuments(ctx, digestDueFilter(userID, "today", clock))
+		overdue, _ := db.Collection("tasks").CountDocuments(ctx, digestDueFilter(userID, "overdue", clock))
+		msg, ok := digestPushMessage(int(dueToday), int(overdue))
+		if !ok {
+			continue
+		}
+		if err := sendPushToUser(ctx, db, userID, msg); err != nil {
+			LogEvent("push_failed", userID.Hex(), map[string]interface{}{"kind": "digest", "error": err.Error()})
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func duePushMessage(t Task) PushMessage {
+	return PushMessage{
+		Title: "Due now",
+		Body:  t.Title,
+		Data:  map[string]string{"kind": "due", "taskId": t.ID.Hex()},
+	}
+}
+
+// digestPushMessage summarises the day; ok is false when there is nothing to report.
+func digestPushMessage(dueToday, overdue int) (PushMessage, bool) {
+	var parts []string
+	if dueToday > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s due today", dueToday, pluralTasks(dueToday)))
+	}
+	if overdue > 0 {
+		parts = append(parts, fmt.Sprintf("%d overdue", overdue))
+	}
+	if len(parts) == 0 {
+		return PushMessage{}, false
+	}
+	return PushMessage{
+		Title: "Your day",
+		Body:  strings.Join(parts, ", "),
+		Data:  map[string]string{"kind": "digest"},
+	}, true
+}
+
+func pluralTasks(n int) string {
+	if n == 1 {
+		return "task"
+	}
+	return "tasks"
+}
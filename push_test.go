@@ -0,0 +1,65 @@
+package encoreapp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type fakePushSender struct {
+	stale []string
+	err   error
+	calls [][]string
+	msgs  []PushMessage
+}
+
+func (f *fakePushSender) Send(ctx context.Context, tokens []string, msg PushMessage) ([]string, error) {
+	f.calls = append(f.calls, tokens)
+	f.msgs = append(f.msgs, msg)
+	return f.stale, f.err
+}
+
+func TestDeliverPushMapsStaleTokensToDevices(t *testing.T) {
+	sender := &fakePushSender{}
+	if stale, err := deliverPush(context.Background(), sender, nil, PushMessage{Title: "x"}); stale != nil || err != nil || len(sender.calls) != 0 {
+		t.Fatalf("no devices: stale %v, err %v, %d calls", stale, err, len(sender.calls))
+	}
+
+	phone := Device{ID: primitive.NewObjectID(), Token: "tok-phone"}
+	laptop := Device{ID: primitive.NewObjectID(), Token: "tok-laptop"}
+	sender.stale = []string{"tok-laptop", "tok-unknown"}
+	sender.err = errors.New("partial failure")
+	msg := PushMessage{Title: "Due now", Body: "Pay rent", Data: map[string]string{"kind": "due"}}
+	stale, err := deliverPush(context.Background(), sender, []Device{phone, laptop}, msg)
+	if err == nil {
+		t.Error("expected the sender's error")
+	}
+	if len(stale) != 1 || stale[0] != laptop.ID {
+		t.Errorf("stale = %v, want [%v]", stale, laptop.ID)
+	}
+	if len(sender.calls) != 1 || len(sender.calls[0]) != 2 || sender.msgs[0].Body != "Pay rent" {
+		t.Errorf("calls = %v, msgs = %v", sender.calls, sender.msgs)
+	}
+}
+
+func TestDigestPushMessage(t *testing.T) {
+	cases := []struct {
+		dueToday, overdue int
+		want              string
+	}{
+		{1, 0, "1 task due today"},
+		{3, 2, "3 tasks due today, 2 overdue"},
+		{0, 4, "4 overdue"},
+	}
+	for _, c := range cases {
+		msg, ok := digestPushMessage(c.dueToday, c.overdue)
+		if !ok || msg.Body != c.want || msg.Data["kind"] != "digest" {
+			t.Errorf("(%d, %d): got %q, %v", c.dueToday, c.overdue, msg.Body, ok)
+		}
+	}
+	if _, ok := digestPushMessage(0, 0); ok {
+		t.Error("expected no digest when nothing is due")
+	}
+}
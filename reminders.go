@@ -0,0 +1,411 @@
+package encoreapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"encore.dev/cron"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Task reminders. A cron job calls DispatchReminders every minute; each due reminder is
+// claimed with a lease (claimedUntil) so overlapping runs never send it twice. Failed
+// deliveries are retried with backoff up to reminderMaxAttempts.
+
+const (
+	reminderLease        = 2 * time.Minute
+	reminderMaxAttempts  = 5
+	reminderBatchSize    = 100
+	defaultSnoozeMinutes = 10
+)
+
+type CreateReminderRequest struct {
+	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
+	RemindAt      string `json:"remindAt"`      // ISO 8601 or natural language, e.g. "tomorrow 9am"
+	OffsetMinutes *int   `json:"offsetMinutes"` // minutes before the due date, instead of remindAt
+}
+
+type ReminderResponse struct {
+	Reminder Reminder `json:"reminder"`
+}
+
+type GetRemindersRequest struct {
+	Authorization string `header:"Authorization"`
+	TaskID        string `query:"taskId"`
+	Status        string `query:"status"` // default "pending", "all" for every status
+}
+
+type GetRemindersResponse struct {
+	Reminders []Reminder `json:"reminders"`
+}
+
+type SnoozeReminderRequest struct {
+	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
+	Minutes       int    `json:"minutes"` // default 10
+	Until         string `json:"until"`   // instead of minutes
+}
+
+type DispatchRemindersResponse struct {
+	Sent   int `json:"sent"`
+	Failed int `json:"failed"`
+}
+
+// encore:api public method=POST path=/api/tasks/:id/reminders
+func CreateReminder(ctx context.Context, id string, req *CreateReminderRequest) (*ReminderResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	clock := clockFromContext(withUserClock(ctx, userID, req.TimeZone))
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	db := client.Database("gtd")
+	taskID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid task id")
+	}
+	var task Task
+	if err := db.Collection("tasks").FindOne(ctx, bson.M{"_id": taskID, "userId": userID, "trashed": false}).Decode(&task); err != nil {
+		return nil, errors.New("task not found")
+	}
+
+	remindAt, err := reminderTime(req, task, clock)
+	if err != nil {
+		return nil, err
+	}
+	reminder := Reminder{
+		ID:            primitive.NewObjectID(),
+		UserID:        userID,
+		TaskID:        taskID,
+		RemindAt:      remindAt,
+		OffsetMinutes: req.OffsetMinutes,
+		Status:        "pending",
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if _, err := db.Collection("reminders").InsertOne(ctx, reminder); err != nil {
+		return nil, errors.New("failed to create reminder")
+	}
+	return &ReminderResponse{Reminder: reminder}, nil
+}
+
+// reminderTime is when a reminder requested for task fires: an absolute time, or an
+// offset before the task's due date.
+func reminderTime(req *CreateReminderRequest, task Task, clock userClock) (time.Time, error) {
+	var at time.Time
+	switch {
+	case req.OffsetMinutes != nil && req.RemindAt != "":
+		return at, errors.New("set either remindAt or offsetMinutes")
+	case req.OffsetMinutes != nil:
+		if *req.OffsetMinutes < 0 {
+			return at, errors.New("offsetMinutes must not be negative")
+		}
+		if !taskHasDeadline(task) {
+			return at, errors.New("task has no due date")
+		}
+		at = task.DueDate.Add(-time.Duration(*req.OffsetMinutes) * time.Minute)
+	case req.RemindAt != "":
+		var err error
+		if at, err = parseTaskDate(req.RemindAt, clock); err != nil {
+			return at, errors.New("invalid reminder time")
+		}
+	default:
+		return at, errors.New("remindAt or offsetMinutes is required")
+	}
+	if !at.After(clock.Now) {
+		return at, errors.New("reminder time is in the past")
+	}
+	return at, nil
+}
+
+// encore:api public method=GET path=/api/reminders
+func GetReminders(ctx context.Context, req *GetRemindersRequest) (*GetRemindersResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	filter := bson.M{"userId": userID}
+	switch req.Status {
+	case "":
+		filter["status"] = "pending"
+	case "all":
+	default:
+		filter["status"] = req.Status
+	}
+	if req.TaskID != "" {
+		taskID, err := primitive.ObjectIDFromHex(req.TaskID)
+		if err != nil {
+			return nil, errors.New("invalid task id")
+		}
+		filter["taskId"] = taskID
+	}
+	cur, err := client.Database("gtd").Collection("reminders").Find(ctx, filter, options.Find().SetSort(bson.M{"remindAt": 1}).SetLimit(500))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	reminders := []Reminder{}
+	for cur.Next(ctx) {
+		var r Reminder
+		if err := cur.Decode(&r); err == nil {
+			reminders = append(reminders, r)
+		}
+	}
+	return &GetRemindersResponse{Reminders: reminders}, nil
+}
+
+// encore:api public method=POST path=/api/reminders/:id/snooze
+func SnoozeReminder(ctx context.Context, id string, req *SnoozeReminderRequest) (*ReminderResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	clock := clockFromContext(withUserClock(ctx, userID, req.TimeZone))
+	until := clock.Now.Add(defaultSnoozeMinutes * time.Minute)
+	switch {
+	case req.Until != "":
+		until, err = parseTaskDate(req.Until, clock)
+		if err != nil {
+			return nil, errors.New("invalid snooze time")
+		}
+		if !until.After(clock.Now) {
+			return nil, errors.New("snooze time is in the past")
+		}
+	case req.Minutes < 0:
+		return nil, errors.New("minutes must not be negative")
+	case req.Minutes > 0:
+		until = clock.Now.Add(time.Duration(req.Minutes) * time.Minute)
+	}
+	// A snoozed reminder keeps its time even if the due date moves
+	return updateReminder(ctx, id, userID, bson.M{
+		"$set":   bson.M{"status": "pending", "remindAt": until, "attempts": 0, "updatedAt": time.Now()},
+		"$unset": bson.M{"offsetMinutes": "", "claimedUntil": "", "lastError": ""},
+	})
+}
+
+// encore:api public method=POST path=/api/reminders/:id/dismiss
+func DismissReminder(ctx context.Context, id string, req *GetRemindersRequest) (*ReminderResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	now := time.Now()
+	return updateReminder(ctx, id, userID, bson.M{
+		"$set": bson.M{"status": "dismissed", "dismissedAt": now, "updatedAt": now},
+	})
+}
+
+// encore:api public method=DELETE path=/api/reminders/:id
+func DeleteReminder(ctx context.Context, id string, req *GetRemindersRequest) (*DeleteTaskResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid reminder id")
+	}
+	res, err := client.Database("gtd").Collection("reminders").DeleteOne(ctx, bson.M{"_id": objID, "userId": userID})
+	if err != nil || res.DeletedCount == 0 {
+		return nil, errors.New("reminder not found or not authorized")
+	}
+	return &DeleteTaskResponse{Success: true}, nil
+}
+
+var _ = cron.NewJob("dispatch-reminders", cron.JobConfig{
+	Title:    "Send due task reminders",
+	Every:    1 * cron.Minute,
+	Endpoint: DispatchReminders,
+})
+
+// DispatchReminders sends the reminders that are due now.
+//
+// encore:api private method=POST path=/api/internal/reminders/dispatch
+func DispatchReminders(ctx context.Context) (*DispatchRemindersResponse, error) {
+	ensureServices()
+	sent, failed, err := dispatchDueReminders(ctx, newNotifiers(), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &DispatchRemindersResponse{Sent: sent, Failed: failed}, nil
+}
+
+func updateReminder(ctx context.Context, id string, userID primitive.ObjectID, update bson.M) (*ReminderResponse, error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid reminder id")
+	}
+	var reminder Reminder
+	err = client.Database("gtd").Collection("reminders").FindOneAndUpdate(ctx,
+		bson.M{"_id": objID, "userId": userID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&reminder)
+	if err != nil {
+		return nil, errors.New("reminder not found")
+	}
+	return &ReminderResponse{Reminder: reminder}, nil
+}
+
+// rescheduleTaskReminders moves the pending relative reminders of a task after its due
+// date changed.
+func rescheduleTaskReminders(ctx context.Context, db *mongo.Database, taskID primitive.ObjectID, due time.Time) {
+	col := db.Collection("reminders")
+	cur, err := col.Find(ctx, bson.M{"taskId": taskID, "status": "pending", "offsetMinutes": bson.M{"$exists": true}})
+	if err != nil {
+		return
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		var r Reminder
+		if err := cur.Decode(&r); err != nil || r.OffsetMinutes == nil {
+			continue
+		}
+		at := due.Add(-time.Duration(*r.OffsetMinutes) * time.Minute)
+		if _, err := col.UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{"$set": bson.M{"remindAt": at, "updatedAt": time.Now()}}); err != nil {
+			log.Printf("Failed to reschedule reminder %s: %v", r.ID.Hex(), err)
+		}
+	}
+}
+
+var reminderIndexOnce sync.Once
+
+func ensureReminderIndexes(ctx context.Context, col *mongo.Collection) {
+	reminderIndexOnce.Do(func() {
+		_, err := col.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "remindAt", Value: 1}},
+		})
+		if err != nil {
+			log.Printf("Failed to create reminders index: %v", err)
+		}
+	})
+}
+
+// dispatchDueReminders claims and sends up to reminderBatchSize due reminders.
+func dispatchDueReminders(ctx context.Context, notifiers []Notifier, now time.Time) (sent, failed int, err error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return 0, 0, err
+	}
+	db := client.Database("gtd")
+	col := db.Collection("reminders")
+	ensureReminderIndexes(ctx, col)
+	for i := 0; i < reminderBatchSize; i++ {
+		var r Reminder
+		err := col.FindOneAndUpdate(ctx,
+			bson.M{
+				"status":   "pending",
+				"remindAt": bson.M{"$lte": now},
+				"$or":      bson.A{bson.M{"claimedUntil": nil}, bson.M{"claimedUntil": bson.M{"$lt": now}}},
+			},
+			bson.M{"$set": bson.M{"claimedUntil": now.Add(reminderLease)}},
+			options.FindOneAndUpdate().SetSort(bson.M{"remindAt": 1}).SetReturnDocument(options.After),
+		).Decode(&r)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			break
+		}
+		if err != nil {
+			return sent, failed, err
+		}
+
+		var task Task
+		if err := db.Collection("tasks").FindOne(ctx, bson.M{"_id": r.TaskID}).Decode(&task); err != nil || task.Completed || task.Trashed {
+			col.UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{
+				"$set":   bson.M{"status": "cancelled", "updatedAt": now},
+				"$unset": bson.M{"claimedUntil": ""},
+			})
+			continue
+		}
+
+		if deliverErr := deliverNotification(ctx, notifiers, reminderNotification(r, task, now)); deliverErr != nil {
+			failed++
+			update := bson.M{"attempts": r.Attempts + 1, "lastError": deliverErr.Error(), "updatedAt": now}
+			if r.Attempts+1 >= reminderMaxAttempts {
+				update["status"] = "failed"
+			} else {
+				update["remindAt"] = now.Add(reminderRetryDelay(r.Attempts + 1))
+			}
+			col.UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{"$set": update, "$unset": bson.M{"claimedUntil": ""}})
+			LogEvent("reminder_failed", r.UserID.Hex(), map[string]interface{}{"reminderId": r.ID.Hex(), "error": deliverErr.Error()})
+			continue
+		}
+		sent++
+		col.UpdateOne(ctx, bson.M{"_id": r.ID}, bson.M{
+			"$set":   bson.M{"status": "sent", "sentAt": now, "updatedAt": now},
+			"$unset": bson.M{"claimedUntil": "", "lastError": ""},
+		})
+	}
+	return sent, failed, nil
+}
+
+// deliverNotification sends n through every notifier and succeeds if any of them did.
+func deliverNotification(ctx context.Context, notifiers []Notifier, n Notification) error {
+	var errs []string
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, notifier.Name()+": "+err.Error())
+		}
+	}
+	if len(errs) == len(notifiers) && len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	if len(errs) > 0 {
+		log.Printf("Notification partially delivered: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// reminderRetryDelay is 1, 4, 9, 16... minutes after the nth failed attempt.
+func reminderRetryDelay(attempt int) time.Duration {
+	return time.Duration(attempt*attempt) * time.Minute
+}
+
+func reminderNotification(r Reminder, task Task, now time.Time) Notification {
+	body := "Reminder"
+	if taskHasDeadline(task) {
+		switch until := task.DueDate.Sub(now).Round(time.Minute); {
+		case until < -48*time.Hour:
+			body = fmt.Sprintf("Overdue by %d days", int(-until.Hours()/24))
+		case until < 0:
+			body = "Overdue by " + formatPlanMinutes(int(-until.Minutes()))
+		case until == 0:
+			body = "Due now"
+		case until >= 48*time.Hour:
+			body = fmt.Sprintf("Due in %d days", int(until.Hours()/24))
+		default:
+			body = "Due in " + formatPlanMinutes(int(until.Minutes()))
+		}
+	}
+	return Notification{
+		UserID: r.UserID,
+		Kind:   "reminder",
+		Title:  task.Title,
+		Body:   body,
+		TaskID: &task.ID,
+		At:     now,
+	}
+}
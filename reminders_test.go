@@ -0,0 +1,162 @@
+package encoreapp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type stubNotifier struct {
+	name string
+	err  error
+	got  []Notification
+}
+
+func (s *stubNotifier) Name() string { return s.name }
+
+func (s *stubNotifier) Notify(ctx context.Context, n Notification) error {
+	s.got = append(s.got, n)
+	return s.err
+}
+
+func TestWebhookNotifierSignsBody(t *testing.T) {
+	var signature string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get("X-Signature")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	w := &webhookNotifier{url: server.URL, secret: "s3cret", http: server.Client()}
+	if err := w.Notify(context.Background(), Notification{UserID: primitive.NewObjectID(), Kind: "reminder", Title: "Call mom"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "sha256=" + webhookSignature("s3cret", body); signature != want || len(body) == 0 {
+		t.Errorf("signature %q, want %q", signature, want)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	w.url = failing.URL
+	if err := w.Notify(context.Background(), Notification{}); err == nil {
+		t.Error("expected an error for a 502 response")
+	}
+}
+
+func TestDeliverNotificationSucceedsIfAnyNotifierDoes(t *testing.T) {
+	ok := &stubNotifier{name: "ok"}
+	broken := &stubNotifier{name: "broken", err: errors.New("down")}
+	if err := deliverNotification(context.Background(), []Notifier{broken, ok}, Notification{Title: "x"}); err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+	if len(ok.got) != 1 || len(broken.got) != 1 {
+		t.Errorf("notifiers called %d and %d times", len(ok.got), len(broken.got))
+	}
+	err := deliverNotification(context.Background(), []Notifier{broken}, Notification{})
+	if err == nil || err.Error() != "broken: down" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestReminderNotificationBody(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time { t := now.Add(d); return &t }
+	cases := []struct {
+		due  *time.Time
+		want string
+	}{
+		{nil, "Reminder"},
+		{at(0), "Due now"},
+		{at(30 * time.Minute), "Due in 30 min"},
+		{at(26 * time.Hour), "Due in 26h"},
+		{at(72 * time.Hour), "Due in 3 days"},
+		{at(-90 * time.Minute), "Overdue by 1h 30min"},
+		{at(-5 * 24 * time.Hour), "Overdue by 5 days"},
+	}
+	for _, c := range cases {
+		n := reminderNotification(Reminder{UserID: primitive.NewObjectID()}, Task{Title: "Pay rent", DueDate: c.due}, now)
+		if n.Body != c.want || n.Title != "Pay rent" || n.Kind != "reminder" {
+			t.Errorf("due %v: got %q, want %q", c.due, n.Body, c.want)
+		}
+	}
+	if reminderRetryDelay(3) != 9*time.Minute {
+		t.Errorf("retry delay = %v", reminderRetryDelay(3))
+	}
+}
+
+func TestReminderTime(t *testing.T) {
+	clock := userClock{Now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	due := time.Date(2026, 3, 3, 15, 0, 0, 0, time.UTC)
+	dated := Task{DueDate: &due, CreatedAt: clock.Now.AddDate(0, 0, -1)}
+	undated := Task{CreatedAt: clock.Now.AddDate(0, 0, -1)}
+	minutes := func(m int) *int { return &m }
+	cases := []struct {
+		name string
+		req  CreateReminderRequest
+		task Task
+		want string // RFC 3339, or the error
+	}{
+		{"offset before the due date", CreateReminderRequest{OffsetMinutes: minutes(30)}, dated, "2026-03-03T14:30:00Z"},
+		{"offset on an undated task", CreateReminderRequest{OffsetMinutes: minutes(30)}, undated, "task has no due date"},
+		{"negative offset", CreateReminderRequest{OffsetMinutes: minutes(-5)}, dated, "offsetMinutes must not be negative"},
+		{"offset in the past", CreateReminderRequest{OffsetMinutes: minutes(2 * 24 * 60)}, dated, "reminder time is in the past"},
+		{"absolute on an undated task", CreateReminderRequest{RemindAt: "2026-03-02T17:00:00Z"}, undated, "2026-03-02T17:00:00Z"},
+		{"absolute in the past", CreateReminderRequest{RemindAt: "2026-03-02T08:00:00Z"}, undated, "reminder time is in the past"},
+		{"unparseable", CreateReminderRequest{RemindAt: "whenever"}, dated, "invalid reminder time"},
+		{"both", CreateReminderRequest{RemindAt: "2026-03-02T17:00:00Z", OffsetMinutes: minutes(30)}, dated, "set either remindAt or offsetMinutes"},
+		{"neither", CreateReminderRequest{}, dated, "remindAt or offsetMinutes is required"},
+	}
+	for _, c := range cases {
+		at, err := reminderTime(&c.req, c.task, clock)
+		got := at.Format(time.RFC3339)
+		if err != nil {
+			got = err.Error()
+		}
+		if got != c.want {
+			t.Errorf("%s: got %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+type fakeMailSender struct {
+	sent []Mail
+}
+
+func (f *fakeMailSender) Send(ctx context.Context, m Mail) error {
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+func TestNewNotifiersEmail(t *testing.T) {
+	saved := secrets.REMINDER_NOTIFIERS
+	defer func() { secrets.REMINDER_NOTIFIERS = saved }()
+	secrets.REMINDER_NOTIFIERS = "email"
+
+	notifiers := newNotifiers()
+	if len(notifiers) != 1 {
+		t.Fatalf("got %d notifiers", len(notifiers))
+	}
+	email, ok := notifiers[0].(emailNotifier)
+	if !ok || email.sender == nil || email.lookup == nil {
+		t.Fatalf("email notifier not wired: %#v", notifiers[0])
+	}
+
+	fake := &fakeMailSender{}
+	email.sender = fake
+	email.lookup = func(ctx context.Context, userID primitive.ObjectID) (string, error) { return "ada@example.com", nil }
+	if err := email.Notify(context.Background(), Notification{UserID: primitive.NewObjectID(), Title: "Pay rent", Body: "Due now"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.sent) != 1 || fake.sent[0] != (Mail{To: "ada@example.com", Subject: "Pay rent", Text: "Due now"}) {
+		t.Errorf("sent = %+v", fake.sent)
+	}
+}
@@ -0,0 +1,512 @@
+package encoreapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Full-text search over tasks, projects and contexts. Free text goes to the Mongo text
+// indexes created by ensureSearchIndexes; qualifiers narrow the task results:
+//
+//	project:"Home reno"  context:calls  due:today|tomorrow|overdue|week|none|2026-03-05
+//	is:open|completed|inbox|someday|waiting|deferred  -is:waiting  priority:1  type:task|project|context
+//
+// Task qualifiers restrict the results to tasks. Open tasks deferred to a later date are
+// left out unless is:deferred is given. The same syntax defines perspectives.
+
+// Characters of context shown around the first match of a long field.
+const searchSnippetRadius = 60
+
+var searchIndexesOnce sync.Once
+
+// ensureSearchIndexes creates the text indexes the first time search is used.
+func ensureSearchIndexes(ctx context.Context, db *mongo.Database) {
+	searchIndexesOnce.Do(func() {
+		indexes := map[string]mongo.IndexModel{
+			"tasks": {
+				Keys:    bson.D{{Key: "title", Value: "text"}, {Key: "description", Value: "text"}},
+				Options: options.Index().SetName("search_text").SetWeights(bson.M{"title": 10, "description": 2}),
+			},
+			"projects": {
+				Keys:    bson.D{{Key: "name", Value: "text"}, {Key: "description", Value: "text"}},
+				Options: options.Index().SetName("search_text").SetWeights(bson.M{"name": 10, "description": 2}),
+			},
+			"nextactions": {
+				Keys:    bson.D{{Key: "context_name", Value: "text"}},
+				Options: options.Index().SetName("search_text").SetWeights(bson.M{"context_name": 10}),
+			},
+		}
+		for col, index := range indexes {
+			if _, err := db.Collection(col).Indexes().CreateOne(ctx, index); err != nil {
+				log.Printf("Failed to create text index on %s: %v", col, err)
+			}
+		}
+	})
+}
+
+// searchQuery is a parsed search string.
+type searchQuery struct {
+	Text     string   // free text for $text, phrases keep their quotes
+	Terms    []string // lower-cased words of Text, used for highlighting
+	Type     string   // "task", "project", "context" or "" for all
+	Project  string
+	Context  string
+	Due      string
+	Is       []string
+	NotIs    []string // from -is: qualifiers
+	Priority int
+	taskOnly bool
+}
+
+// parseSearchQuery splits q into free text and qualifiers. Unknown qualifiers are kept
+// as text.
+func parseSearchQuery(q string) (searchQuery, error) {
+	var sq searchQuery
+	var text []string
+	for _, tok := range splitSearchTokens(q) {
+		key, value, ok := strings.Cut(tok, ":")
+		value = strings.Trim(value, `"`)
+		if !ok || value == "" {
+			text = append(text, tok)
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "project":
+			sq.Project, sq.taskOnly = value, true
+		case "context":
+			sq.Context, sq.taskOnly = strings.TrimPrefix(value, "@"), true
+		case "due":
+			sq.Due, sq.taskOnly = strings.ToLower(value), true
+		case "is":
+			sq.Is, sq.taskOnly = append(sq.Is, strings.ToLower(value)), true
+		case "-is":
+			sq.NotIs, sq.taskOnly = append(sq.NotIs, strings.ToLower(value)), true
+		case "priority", "p":
+			p, err := strconv.Atoi(value)
+			if err != nil || p < 1 || p > 5 {
+				return sq, errors.New("priority must be between 1 and 5")
+			}
+			sq.Priority, sq.taskOnly = p, true
+		case "type":
+			switch value = strings.ToLower(value); value {
+			case "task", "project", "context":
+				sq.Type = value
+			default:
+				return sq, errors.New("type must be task, project or context")
+			}
+		default:
+			text = append(text, tok)
+		}
+	}
+	sq.Text = strings.Join(text, " ")
+	for _, tok := range text {
+		if strings.HasPrefix(tok, "-") {
+			continue // negated in $text, nothing to highlight
+		}
+		sq.Terms = append(sq.Terms, strings.FieldsFunc(strings.ToLower(tok), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+	if sq.taskOnly {
+		if sq.Type != "" && sq.Type != "task" {
+			return sq, errors.New("task qualifiers can only be used with type:task")
+		}
+		sq.Type = "task"
+	}
+	return sq, nil
+}
+
+// splitSearchTokens splits on spaces outside double quotes.
+func splitSearchTokens(q string) []string {
+	var tokens []string
+	var cur strings.Builder
+	quoted := false
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			cur.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+// taskFilter returns the Mongo filter for the task qualifiers, without the free text.
+// notFound is set when a referenced project or context doesn't exist.
+func (sq searchQuery) taskFilter(ctx context.Context, userID primitive.ObjectID, clock userClock) (filter bson.M, notFound string, err error) {
+	filter = bson.M{"userId": userID, "trashed": false, "completed": false}
+	if sq.Project != "" {
+		id := lookupProjectID(ctx, sq.Project, userID)
+		if id == nil {
+			return nil, fmt.Sprintf("No project found matching \"%s\".", sq.Project), nil
+		}
+		filter["projectId"] = *id
+	}
+	if sq.Context != "" {
+		id := lookupNextActionID(ctx, sq.Context, userID)
+		if id == nil {
+			return nil, fmt.Sprintf("No context found matching \"%s\".", sq.Context), nil
+		}
+		filter["nextActionId"] = *id
+	}
+	// Undated tasks are stored without a dueDate: "none" matches exactly those, and the
+	// date ranges never do.
+	switch sq.Due {
+	case "":
+	case "none":
+		filter["dueDate"] = nil
+	case "week", "thisweek":
+		filter["dueDate"] = bulkDueFilter("thisWeek", clock)
+	case "today", "tomorrow", "overdue":
+		filter["dueDate"] = bulkDueFilter(sq.Due, clock)
+	default:
+		day, err := time.ParseInLocation("2006-01-02", sq.Due, clock.Location())
+		if err != nil {
+			return nil, "", errors.New("due must be today, tomorrow, overdue, week, none or a YYYY-MM-DD date")
+		}
+		filter["dueDate"] = bson.M{"$gte": day, "$lt": day.AddDate(0, 0, 1)}
+	}
+	deferred := false
+	for _, is := range sq.Is {
+		switch is {
+		case "open":
+			filter["completed"] = false
+		case "completed", "done":
+			filter["completed"] = true
+		case "inbox", "someday", "waiting":
+			filter["category"] = is
+		case "deferred":
+			deferred = true
+			filter["deferUntil"] = bson.M{"$gt": clock.Now}
+		default:
+			return nil, "", errors.New("is must be open, completed, inbox, someday, waiting or deferred")
+		}
+	}
+	var notCategories []string
+	for _, is := range sq.NotIs {
+		switch is {
+		case "open":
+			filter["completed"] = true
+		case "completed", "done":
+			filter["completed"] = false
+		case "inbox", "someday", "waiting":
+			notCategories = append(notCategories, is)
+		case "deferred": // the default for open tasks
+		default:
+			return nil, "", errors.New("-is must be open, completed, inbox, someday, waiting or deferred")
+		}
+	}
+	if _, ok := filter["category"]; !ok && len(notCategories) > 0 {
+		filter["category"] = bson.M{"$nin": notCategories}
+	}
+	if !deferred && filter["completed"] == false {
+		filter["deferUntil"] = notDeferred(clock.Now)
+	}
+	if sq.Priority != 0 {
+		filter["priority"] = sq.Priority
+	}
+	return filter, "", nil
+}
+
+type SearchRequest struct {
+	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
+	Query         string `query:"q"`
+	Limit         int    `query:"limit"` // default 20, max 50
+}
+
+// SearchHighlight is a field of a result with the matched words wrapped in <mark>.
+// The rest of the text is HTML-escaped.
+type SearchHighlight struct {
+	Field   string `json:"field"`
+	Snippet string `json:"snippet"`
+}
+
+type SearchResult struct {
+	Type       string            `json:"type"` // "task", "project" or "context"
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Score      float64           `json:"score"`
+	Highlights []SearchHighlight `json:"highlights,omitempty"`
+	Task       *Task             `json:"task,omitempty"`
+	Project    *Project          `json:"project,omitempty"`
+	NextAction *NextAction       `json:"nextAction,omitempty"`
+}
+
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	Message string         `json:"message,omitempty"`
+}
+
+// encore:api public method=GET path=/api/search
+func Search(ctx context.Context, req *SearchRequest) (*SearchResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	sq, err := parseSearchQuery(req.Query)
+	if err != nil {
+		return nil, err
+	}
+	if sq.Text == "" && !sq.taskOnly {
+		return nil, errors.New("q is required")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = 20
+	} else if limit > 50 {
+		limit = 50
+	}
+
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	db := client.Database("gtd")
+	ensureSearchIndexes(ctx, db)
+
+	results := []SearchResult{}
+	if sq.Type == "" || sq.Type == "task" {
+		filter, notFound, err := sq.taskFilter(ctx, userID, clockFromContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if notFound != "" {
+			return &SearchResponse{Results: results, Message: notFound}, nil
+		}
+		tasks, err := searchTasks(ctx, db, sq, filter, limit)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, tasks...)
+	}
+	if sq.Text != "" && (sq.Type == "" || sq.Type == "project") {
+		projects, err := searchProjects(ctx, db, sq, userID, limit)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, projects...)
+	}
+	if sq.Text != "" && (sq.Type == "" || sq.Type == "context") {
+		contexts, err := searchContexts(ctx, db, sq, userID, limit)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, contexts...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return &SearchResponse{Results: results}, nil
+}
+
+// textFindOptions sorts by text score when there is free text.
+func textFindOptions(sq searchQuery, limit int) *options.FindOptions {
+	opts := options.Find().SetLimit(int64(limit))
+	if sq.Text != "" {
+		score := bson.M{"score": bson.M{"$meta": "textScore"}}
+		opts.SetProjection(score).SetSort(score)
+	} else {
+		opts.SetSort(bson.D{{Key: "dueDate", Value: 1}, {Key: "priority", Value: 1}})
+	}
+	return opts
+}
+
+func withTextSearch(filter bson.M, sq searchQuery) bson.M {
+	if sq.Text != "" {
+		filter["$text"] = bson.M{"$search": sq.Text}
+	}
+	return filter
+}
+
+func searchTasks(ctx context.Context, db *mongo.Database, sq searchQuery, filter bson.M, limit int) ([]SearchResult, error) {
+	cur, err := db.Collection("tasks").Find(ctx, withTextSearch(filter, sq), textFindOptions(sq, limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var results []SearchResult
+	for cur.Next(ctx) {
+		var doc struct {
+			Task  `bson:",inline"`
+			Score float64 `bson:"score"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			continue
+		}
+		t := doc.Task
+		results = append(results, SearchResult{
+			Type:       "task",
+			ID:         t.ID.Hex(),
+			Title:      t.Title,
+			Score:      doc.Score,
+			Highlights: searchHighlights(sq.Terms, "title", t.Title, "description", t.Description),
+			Task:       &t,
+		})
+	}
+	return results, nil
+}
+
+func searchProjects(ctx context.Context, db *mongo.Database, sq searchQuery, userID primitive.ObjectID, limit int) ([]SearchResult, error) {
+	cur, err := db.Collection("projects").Find(ctx, withTextSearch(bson.M{"userId": userID}, sq), textFindOptions(sq, limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var results []SearchResult
+	for cur.Next(ctx) {
+		var doc struct {
+			Project `bson:",inline"`
+			Score   float64 `bson:"score"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			continue
+		}
+		p := doc.Project
+		description := ""
+		if p.Description != nil {
+			description = *p.Description
+		}
+		results = append(results, SearchResult{
+			Type:       "project",
+			ID:         p.ID.Hex(),
+			Title:      p.Name,
+			Score:      doc.Score,
+			Highlights: searchHighlights(sq.Terms, "name", p.Name, "description", description),
+			Project:    &p,
+		})
+	}
+	return results, nil
+}
+
+func searchContexts(ctx context.Context, db *mongo.Database, sq searchQuery, userID primitive.ObjectID, limit int) ([]SearchResult, error) {
+	cur, err := db.Collection("nextactions").Find(ctx, withTextSearch(bson.M{"userId": userID}, sq), textFindOptions(sq, limit))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var results []SearchResult
+	for cur.Next(ctx) {
+		var doc struct {
+			NextAction `bson:",inline"`
+			Score      float64 `bson:"score"`
+		}
+		if err := cur.Decode(&doc); err != nil {
+			continue
+		}
+		na := doc.NextAction
+		results = append(results, SearchResult{
+			Type:       "context",
+			ID:         na.ID.Hex(),
+			Title:      na.ContextName,
+			Score:      doc.Score,
+			Highlights: searchHighlights(sq.Terms, "context_name", na.ContextName),
+			NextAction: &na,
+		})
+	}
+	return results, nil
+}
+
+// searchHighlights returns a snippet for each (field, text) pair that contains a term.
+func searchHighlights(terms []string, fieldsAndTexts ...string) []SearchHighlight {
+	var out []SearchHighlight
+	for i := 0; i+1 < len(fieldsAndTexts); i += 2 {
+		if snippet, ok := highlightSnippet(fieldsAndTexts[i+1], terms); ok {
+			out = append(out, SearchHighlight{Field: fieldsAndTexts[i], Snippet: snippet})
+		}
+	}
+	return out
+}
+
+// highlightSnippet marks the words of text that start with one of the terms (or their
+// singular form, roughly matching the text index's stemming) and trims long text to the
+// area around the first match.
+func highlightSnippet(text string, terms []string) (string, bool) {
+	runes := []rune(text)
+	type span struct{ start, end int }
+	var spans []span
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			j++
+		}
+		word := strings.ToLower(string(runes[i:j]))
+		for _, term := range terms {
+			stem := strings.TrimSuffix(term, "s")
+			if len(stem) < 2 {
+				stem = term
+			}
+			if strings.HasPrefix(word, stem) {
+				spans = append(spans, span{i, j})
+				break
+			}
+		}
+		i = j
+	}
+	if len(spans) == 0 {
+		return "", false
+	}
+
+	from, to := 0, len(runes)
+	if len(runes) > 2*searchSnippetRadius {
+		from = spans[0].start - searchSnippetRadius
+		if from < 0 {
+			from = 0
+		}
+		to = from + 2*searchSnippetRadius
+		if to > len(runes) {
+			to = len(runes)
+		}
+	}
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, s := range spans {
+		if s.start < from || s.end > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(string(runes[pos:s.start])))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(string(runes[s.start:s.end])))
+		b.WriteString("</mark>")
+		pos = s.end
+	}
+	b.WriteString(html.EscapeString(string(runes[pos:to])))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
@@ -0,0 +1,173 @@
+package encoreapp
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	sq, err := parseSearchQuery(`dentist project:"Home reno" due:Today is:completed p:2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := searchQuery{
+		Text:     "dentist",
+		Terms:    []string{"dentist"},
+		Type:     "task",
+		Project:  "Home reno",
+		Due:      "today",
+		Is:       []string{"completed"},
+		Priority: 2,
+		taskOnly: true,
+	}
+	if !reflect.DeepEqual(sq, want) {
+		t.Errorf("got %+v, want %+v", sq, want)
+	}
+
+	sq, err = parseSearchQuery(`"quarterly report" -draft url:example type:project`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sq.Text != `"quarterly report" -draft url:example` || sq.Type != "project" {
+		t.Errorf("got text %q, type %q", sq.Text, sq.Type)
+	}
+	if !reflect.DeepEqual(sq.Terms, []string{"quarterly", "report", "url", "example"}) {
+		t.Errorf("terms = %q", sq.Terms)
+	}
+
+	for _, q := range []string{"type:context due:today", "p:9", "type:note"} {
+		if _, err := parseSearchQuery(q); err == nil {
+			t.Errorf("%q: expected an error", q)
+		}
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	got, ok := highlightSnippet("Call the dentist about <teeth> & book appointments", []string{"dentists", "appointment"})
+	want := "Call the <mark>dentist</mark> about &lt;teeth&gt; &amp; book <mark>appointments</mark>"
+	if !ok || got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, ok := highlightSnippet("Renew insurance", []string{"dentist"}); ok {
+		t.Error("expected no highlight")
+	}
+
+	long := "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris."
+	got, _ = highlightSnippet(long, []string{"minim"})
+	if len([]rune(got)) > 2*searchSnippetRadius+len("<mark></mark>")+2 || got[:3] != "…" {
+		t.Errorf("snippet not trimmed: %q", got)
+	}
+}
+
+func TestTaskFilterNegatedIs(t *testing.T) {
+	sq, err := parseSearchQuery("p:1 -is:waiting -is:someday")
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := primitive.NewObjectID()
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	filter, _, err := sq.taskFilter(context.Background(), userID, userClock{Now: now})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.M{
+		"userId":     userID,
+		"trashed":    false,
+		"completed":  false,
+		"priority":   1,
+		"category":   bson.M{"$nin": []string{"waiting", "someday"}},
+		"deferUntil": notDeferred(now),
+	}
+	if !reflect.DeepEqual(filter, want) {
+		t.Errorf("got %v, want %v", filter, want)
+	}
+
+	// A positive category wins over exclusions
+	sq, _ = parseSearchQuery("is:inbox -is:waiting")
+	filter, _, _ = sq.taskFilter(context.Background(), userID, userClock{Now: now})
+	if filter["category"] != "inbox" {
+		t.Errorf("category = %v", filter["category"])
+	}
+
+	sq, _ = parseSearchQuery("is:deferred")
+	filter, _, _ = sq.taskFilter(context.Background(), userID, userClock{Now: now})
+	if !reflect.DeepEqual(filter["deferUntil"], bson.M{"$gt": now}) {
+		t.Errorf("deferUntil = %v", filter["deferUntil"])
+	}
+}
+
+func TestValidatePerspectiveQuery(t *testing.T) {
+	cases := []struct {
+		query string
+		ok    bool
+	}{
+		{`project:"Home reno" due:week is:waiting`, true},
+		{"context:@phone -is:someday p:1", true},
+		{"due:2026-03-02 is:deferred", true},
+		{"", false},
+		{"type:project", false},
+		{"is:urgent", false},
+		{"-is:later", false},
+		{"due:someday", false},
+		{"due:2026-02-30", false},
+	}
+	for _, c := range cases {
+		if err := validatePerspectiveQuery(c.query); (err == nil) != c.ok {
+			t.Errorf("%q: err = %v, want ok %v", c.query, err, c.ok)
+		}
+	}
+}
+
+func TestTaskFilterDue(t *testing.T) {
+	userID := primitive.NewObjectID()
+	clock := userClock{Now: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)}
+	due := func(days int) *time.Time {
+		d := clock.Today().AddDate(0, 0, days).Add(15 * time.Hour)
+		return &d
+	}
+	tasks := map[string]Task{
+		"overdue":   {UserID: userID, DueDate: due(-2)},
+		"today":     {UserID: userID, DueDate: due(0)},
+		"tomorrow":  {UserID: userID, DueDate: due(1)},
+		"next week": {UserID: userID, DueDate: due(9)},
+		"undated":   {UserID: userID, CreatedAt: clock.Now.AddDate(0, 0, -5)},
+	}
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"due:overdue", []string{"overdue"}},
+		{"due:today", []string{"today"}},
+		{"due:tomorrow", []string{"tomorrow"}},
+		{"due:week", []string{"today", "tomorrow"}},
+		{"due:2026-03-11", []string{"next week"}},
+		{"due:none", []string{"undated"}},
+		{"", []string{"next week", "overdue", "today", "tomorrow", "undated"}},
+	}
+	for _, c := range cases {
+		sq, err := parseSearchQuery(c.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filter, _, err := sq.taskFilter(context.Background(), userID, clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for name, task := range tasks {
+			if matchesFilter(t, filter, task) {
+				got = append(got, name)
+			}
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q matches %v, want %v", c.query, got, c.want)
+		}
+	}
+}
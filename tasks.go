@@ -4,22 +4,29 @@ import (
 	"context"
 	"time"
 	"errors"
+	"fmt"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// GetTasksRequest for fetching all tasks (Authorization header)
+// GetTasksRequest carries the Authorization header for the single-task endpoints
 type GetTasksRequest struct {
 	Authorization string `header:"Authorization"`
 }
 
+// ListTasksRequest for fetching all tasks
+type ListTasksRequest struct {
+	Authorization   string `header:"Authorization"`
+	IncludeDeferred bool   `query:"includeDeferred"` // also list tasks deferred to a later date
+}
+
 type GetTasksResponse struct {
 	Tasks []Task `json:"tasks"`
 }
 
 // encore:api public method=GET path=/api/tasks
-func GetTasks(ctx context.Context, req *GetTasksRequest) (*GetTasksResponse, error) {
+func GetTasks(ctx context.Context, req *ListTasksRequest) (*GetTasksResponse, error) {
 	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
 	if err != nil {
 		return nil, errors.New("unauthorized")
@@ -29,7 +36,11 @@ func GetTasks(ctx context.Context, req *GetTasksRequest) (*GetTasksResponse, err
 		return nil, errors.New("database connection failed")
 	}
 	tasksCol := client.Database("gtd").Collection("tasks")
-	cur, err := tasksCol.Find(ctx, bson.M{"userId": userID, "trashed": false})
+	filter := bson.M{"userId": userID, "trashed": false}
+	if !req.IncludeDeferred {
+		filter["deferUntil"] = notDeferred(time.Now())
+	}
+	cur, err := tasksCol.Find(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -44,17 +55,27 @@ func GetTasks(ctx context.Context, req *GetTasksRequest) (*GetTasksResponse, err
 	return &GetTasksResponse{Tasks: tasks}, nil
 }
 
+// notDeferred matches tasks without a start date or whose start date has passed.
+func notDeferred(now time.Time) bson.M {
+	return bson.M{"$not": bson.M{"$gt": now}}
+}
+
 // CreateTaskRequest for creating a new task
 type CreateTaskRequest struct {
-	Authorization string  `header:"Authorization"`
-	Title         string  `json:"title"`
-	Description   string  `json:"description"`
-	DueDate       *string `json:"dueDate"`
-	Priority      int     `json:"priority"`
-	Category      string  `json:"category"`
-	ProjectID     *string `json:"projectId,omitempty"`
-	NextActionID  *string `json:"nextActionId,omitempty"`
-	Completed     *bool   `json:"completed,omitempty"`
+	Authorization    string  `header:"Authorization"`
+	TimeZone         string  `header:"X-Timezone"`
+	Title            string  `json:"title"`
+	Description      string  `json:"description"`
+	DueDate          *string `json:"dueDate"`
+	DeferUntil       *string `json:"deferUntil,omitempty"` // on update "" clears it
+	Priority         int     `json:"priority"`             // 1-5, other values clear it; on update 0 keeps the current value
+	Category         string  `json:"category"`
+	ProjectID        *string `json:"projectId,omitempty"`
+	NextActionID     *string `json:"nextActionId,omitempty"`
+	Completed        *bool   `json:"completed,omitempty"`
+	EstimatedMinutes *int    `json:"estimatedMinutes,omitempty"`
+	Important        *bool   `json:"important,omitempty"`
+	Urgent           *bool   `json:"urgent,omitempty"`
 }
 
 type CreateTaskResponse struct {
@@ -67,26 +88,35 @@ func CreateTask(ctx context.Context, req *CreateTaskRequest) (*CreateTaskRespons
 	if err != nil {
 		return nil, errors.New("unauthorized")
 	}
+	return createTaskForUser(ctx, userID, req)
+}
+
+// createTaskForUser creates the task for an already identified user; req.Authorization
+// is ignored. Used by callers without a bearer token, such as email capture.
+func createTaskForUser(ctx context.Context, userID primitive.ObjectID, req *CreateTaskRequest) (*CreateTaskResponse, error) {
 	client, err := GetMongoClient()
     if err != nil {
 		return nil, errors.New("database connection failed")
 	}
 	tasksCol := client.Database("gtd").Collection("tasks")
 	projectsCol := client.Database("gtd").Collection("projects")
+	clock := clockFromContext(withUserClock(ctx, userID, req.TimeZone))
 
 	var dueDate *time.Time
 	if req.DueDate != nil && *req.DueDate != "" {
-		d, err := time.Parse(time.RFC3339, *req.DueDate)
+		d, err := parseTaskDate(*req.DueDate, clock)
 		if err != nil {
-			d, err = time.Parse("2006-01-02", *req.DueDate)
-		}
-		if err == nil {
-			dueDate = &d
+			return nil, errors.New("invalid due date")
 		}
+		dueDate = &d
 	}
-	if dueDate == nil {
-		now := time.Now()
-		dueDate = &now
+	var deferUntil *time.Time
+	if req.DeferUntil != nil && *req.DeferUntil != "" {
+		d, err := parseTaskDate(*req.DeferUntil, clock)
+		if err != nil {
+			return nil, errors.New("invalid defer date")
+		}
+		deferUntil = &d
 	}
 
 	var projectID *primitive.ObjectID
@@ -120,11 +150,6 @@ func CreateTask(ctx context.Context, req *CreateTaskRequest) (*CreateTaskRespons
 		req.Category = "inbox"
 	}
 
-	priority := req.Priority
-	if priority < 1 || priority > 5 {
-		priority = 99
-	}
-
 	task := Task{
 		ID:           primitive.NewObjectID(),
 		UserID:       userID,
@@ -133,17 +158,25 @@ func CreateTask(ctx context.Context, req *CreateTaskRequest) (*CreateTaskRespons
 		Title:        req.Title,
 		Description:  req.Description,
 		DueDate:      dueDate,
-		Priority:     priority,
+		DeferUntil:   deferUntil,
+		Priority:     normalizePriority(req.Priority),
 		Completed:    false,
 		Trashed:      false,
 		Category:     req.Category,
 		CreatedAt:    time.Now(),
 		UpdatedAt:    time.Now(),
 	}
+	if req.EstimatedMinutes != nil && *req.EstimatedMinutes > 0 {
+		task.EstimatedMinutes = *req.EstimatedMinutes
+	}
+	task.Important, task.Urgent = req.Important, req.Urgent
 	_, err = tasksCol.InsertOne(ctx, task)
 	if err != nil {
 		return nil, errors.New("failed to create task")
 	}
+	recordActionCreate(ctx, tasksCol, task.ID)
+	invalidateFuzzyIndex("tasks", userID)
+	refreshEmbedding(userID, "task", task.ID, embeddingText(task.Title, task.Description))
 
 	// Increment project task_count if linked
 	if projectID != nil {
@@ -167,6 +200,33 @@ func CreateTask(ctx context.Context, req *CreateTaskRequest) (*CreateTaskRespons
 	return &CreateTaskResponse{Task: task}, nil
 }
 
+type ClearDefaultedDueDatesResponse struct {
+	Cleared int64 `json:"cleared"`
+}
+
+// ClearDefaultedDueDates removes the due dates that CreateTask used to set to the
+// creation time of undated tasks, so they no longer count as deadlines.
+// encore:api private method=POST path=/api/admin/tasks/clear-defaulted-due-dates
+func ClearDefaultedDueDates(ctx context.Context) (*ClearDefaultedDueDatesResponse, error) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	res, err := client.Database("gtd").Collection("tasks").UpdateMany(ctx,
+		bson.M{
+			"dueDate": bson.M{"$ne": nil},
+			"$expr": bson.M{"$lte": bson.A{
+				bson.M{"$abs": bson.M{"$subtract": bson.A{"$dueDate", "$createdAt"}}},
+				time.Minute.Milliseconds(),
+			}},
+		},
+		bson.M{"$unset": bson.M{"dueDate": ""}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &ClearDefaultedDueDatesResponse{Cleared: res.ModifiedCount}, nil
+}
 
 // GetTaskRequest for fetching a specific task
 // encore:api public method=GET path=/api/tasks/:id
@@ -216,24 +276,43 @@ func UpdateTask(ctx context.Context, id string, req *CreateTaskRequest) (*Create
 	if err != nil {
 		return nil, errors.New("task not found")
 	}
+	before := snapshotForAction(ctx, tasksCol, objID)
 	// Prepare update fields
 	update := bson.M{"updatedAt": time.Now()}
 	if req.Title != "" {
 		update["title"] = req.Title
+		defer invalidateFuzzyIndex("tasks", userID)
 	}
 	if req.Description != "" {
 		update["description"] = req.Description
 	}
 	if req.DueDate != nil && *req.DueDate != "" {
-		d, err := time.Parse(time.RFC3339, *req.DueDate)
+		d, err := parseTaskDate(*req.DueDate, clockFromContext(withUserClock(ctx, userID, req.TimeZone)))
 		if err != nil {
-			d, err = time.Parse("2006-01-02", *req.DueDate)
+			return nil, errors.New("invalid due date")
 		}
-		if err == nil {
-			update["dueDate"] = d
+		update["dueDate"] = d
+	}
+	if req.DeferUntil != nil {
+		if *req.DeferUntil == "" {
+			update["deferUntil"] = nil
+		} else {
+			d, err := parseTaskDate(*req.DeferUntil, clockFromContext(withUserClock(ctx, userID, req.TimeZone)))
+			if err != nil {
+				return nil, errors.New("invalid defer date")
+			}
+			update["deferUntil"] = d
 		}
 	}
-	update["priority"] = req.Priority
+	if req.Priority != 0 {
+		update["priority"] = normalizePriority(req.Priority)
+	}
+	if req.Important != nil {
+		update["important"] = *req.Important
+	}
+	if req.Urgent != nil {
+		update["urgent"] = *req.Urgent
+	}
 	var newProjectID *primitive.ObjectID
 	if req.ProjectID != nil && *req.ProjectID != "" {
 		id, err := primitive.ObjectIDFromHex(*req.ProjectID)
@@ -259,6 +338,17 @@ func UpdateTask(ctx context.Context, id string, req *CreateTaskRequest) (*Create
 	}
 	if req.Completed != nil {
 		update["completed"] = *req.Completed
+		if !*req.Completed {
+			update["completedAt"] = nil
+		} else if !existing.Completed {
+			update["completedAt"] = time.Now()
+		}
+	}
+	if req.EstimatedMinutes != nil {
+		if *req.EstimatedMinutes < 0 {
+			return nil, errors.New("invalid estimated minutes")
+		}
+		update["estimatedMinutes"] = *req.EstimatedMinutes
 	}
 	// Enforce business logic: Inbox only if no project/nextAction
 	if (update["projectId"] != nil || update["nextActionId"] != nil) && update["category"] == "Inbox" {
@@ -285,12 +375,17 @@ func UpdateTask(ctx context.Context, id string, req *CreateTaskRequest) (*Create
 	if err != nil {
 		return nil, errors.New("failed to update task")
 	}
+	recordActionUpdate(ctx, tasksCol, objID, before)
 	// Return updated task
 	var updated Task
 	err = tasksCol.FindOne(ctx, bson.M{"_id": objID, "userId": userID}).Decode(&updated)
 	if err != nil {
 		return nil, errors.New("failed to fetch updated task")
 	}
+	refreshEmbedding(userID, "task", updated.ID, embeddingText(updated.Title, updated.Description))
+	if _, ok := update["dueDate"]; ok && updated.DueDate != nil {
+		rescheduleTaskReminders(ctx, client.Database("gtd"), objID, *updated.DueDate)
+	}
 	return &CreateTaskResponse{Task: updated}, nil
 }
 
@@ -310,11 +405,13 @@ func CompleteTask(ctx context.Context, id string, req *GetTasksRequest) (*Create
 	if err != nil {
 		return nil, errors.New("invalid task id")
 	}
+	before := snapshotForAction(ctx, tasksCol, objID)
 	// Only allow if user owns the task
-	res, err := tasksCol.UpdateOne(ctx, bson.M{"_id": objID, "userId": userID, "trashed": false}, bson.M{"$set": bson.M{"completed": true, "updatedAt": time.Now()}})
+	res, err := tasksCol.UpdateOne(ctx, bson.M{"_id": objID, "userId": userID, "trashed": false}, bson.M{"$set": bson.M{"completed": true, "completedAt": time.Now(), "updatedAt": time.Now()}})
 	if err != nil || res.MatchedCount == 0 {
 		return nil, errors.New("task not found or not authorized")
 	}
+	recordActionUpdate(ctx, tasksCol, objID, before)
 	var updated Task
 	err = tasksCol.FindOne(ctx, bson.M{"_id": objID, "userId": userID}).Decode(&updated)
 	if err != nil {
@@ -368,3 +465,158 @@ func DeleteTask(ctx context.Context, id string, req *GetTasksRequest) (*DeleteTa
 	}
 	return &DeleteTaskResponse{Success: true}, nil
 }
+
+// parseTaskDate accepts RFC 3339, a plain date, or a natural-language expression such as
+// "tomorrow 3pm". Plain dates and expressions are interpreted in the user's time zone.
+func parseTaskDate(s string, clock userClock) (time.Time, error) {
+	d, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return d, nil
+	}
+	d, err = time.ParseInLocation("2006-01-02", s, clock.Location())
+	if err == nil {
+		return d, nil
+	}
+	if d, ok := parseNaturalDate(s, clock); ok {
+		return d, nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+// taskCategoryFor derives a task's category from its project/next action links.
+func taskCategoryFor(projectID, nextActionID *primitive.ObjectID) string {
+	switch {
+	case projectID != nil && nextActionID != nil:
+		return "projects & nextActions"
+	case projectID != nil:
+		return "projects"
+	case nextActionID != nil:
+		return "nextActions"
+	default:
+		return "inbox"
+	}
+}
+
+// BulkTaskOperation describes the change applied to every task in a bulk update.
+type BulkTaskOperation struct {
+	Type         string  `json:"type"` // complete, trash, move, setPriority, setDueDate
+	ProjectID    *string `json:"projectId,omitempty"`
+	NextActionID *string `json:"nextActionId,omitempty"`
+	Priority     int     `json:"priority,omitempty"`
+	DueDate      *string `json:"dueDate,omitempty"`
+}
+
+// BulkUpdateTasksRequest for applying one operation to many tasks
+type BulkUpdateTasksRequest struct {
+	Authorization string            `header:"Authorization"`
+	TimeZone      string            `header:"X-Timezone"`
+	TaskIDs       []string          `json:"taskIds"`
+	Operation     BulkTaskOperation `json:"operation"`
+}
+
+type BulkUpdateTasksResponse struct {
+	Updated int    `json:"updated"`
+	Tasks   []Task `json:"tasks"`
+}
+
+// encore:api public method=POST path=/api/tasks/bulk
+func BulkUpdateTasks(ctx context.Context, req *BulkUpdateTasksRequest) (*BulkUpdateTasksResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	db := client.Database("gtd")
+	tasksCol := db.Collection("tasks")
+
+	op := req.Operation
+	var moveProjectID, moveNextActionID *primitive.ObjectID
+	var dueDate time.Time
+	switch op.Type {
+	case "complete", "trash":
+	case "move":
+		// The target must belong to the user, or tasks could be linked to (and counted
+		// on) someone else's project.
+		if op.ProjectID != nil {
+			if moveProjectID, err = ownedObjectID(ctx, db.Collection("projects"), *op.ProjectID, userID); err != nil {
+				return nil, errors.New("project not found")
+			}
+		}
+		if op.NextActionID != nil {
+			if moveNextActionID, err = ownedObjectID(ctx, db.Collection("nextactions"), *op.NextActionID, userID); err != nil {
+				return nil, errors.New("next action not found")
+			}
+		}
+		if moveProjectID == nil && moveNextActionID == nil {
+			return nil, errors.New("move requires a project or next action")
+		}
+	case "setPriority":
+		if op.Priority < 1 || op.Priority > 5 {
+			return nil, errors.New("priority must be between 1 and 5")
+		}
+	case "setDueDate":
+		if op.DueDate == nil {
+			return nil, errors.New("setDueDate requires a due date")
+		}
+		dueDate, err = parseTaskDate(*op.DueDate, clockFromContext(withUserClock(ctx, userID, req.TimeZone)))
+		if err != nil {
+			return nil, errors.New("invalid due date")
+		}
+	default:
+		return nil, errors.New("unsupported bulk operation")
+	}
+
+	updated := []Task{}
+	for _, idStr := range req.TaskIDs {
+		objID, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			continue
+		}
+		var task Task
+		err = tasksCol.FindOne(ctx, bson.M{"_id": objID, "userId": userID, "trashed": false}).Decode(&task)
+		if err != nil {
+			continue
+		}
+		before := snapshotForAction(ctx, tasksCol, objID)
+		set := bson.M{"updatedAt": time.Now()}
+		newProjectID, newNextActionID := task.ProjectID, task.NextActionID
+		switch op.Type {
+		case "complete":
+			set["completed"] = true
+			set["completedAt"] = time.Now()
+		case "trash":
+			newProjectID, newNextActionID = nil, nil
+			set["trashed"] = true
+		case "move":
+			if moveProjectID != nil {
+				newProjectID = moveProjectID
+			}
+			if moveNextActionID != nil {
+				newNextActionID = moveNextActionID
+			}
+			set["projectId"] = newProjectID
+			set["nextActionId"] = newNextActionID
+			set["category"] = taskCategoryFor(newProjectID, newNextActionID)
+		case "setPriority":
+			set["priority"] = op.Priority
+		case "setDueDate":
+			set["dueDate"] = dueDate
+		}
+		res, err := tasksCol.UpdateOne(ctx, bson.M{"_id": objID, "userId": userID, "trashed": false}, bson.M{"$set": set})
+		if err != nil || res.MatchedCount == 0 {
+			continue
+		}
+		adjustTaskCounts(ctx, db, task.ProjectID, newProjectID, task.NextActionID, newNextActionID)
+		recordActionUpdate(ctx, tasksCol, objID, before)
+		if op.Type == "setDueDate" {
+			rescheduleTaskReminders(ctx, db, objID, dueDate)
+		}
+		if err := tasksCol.FindOne(ctx, bson.M{"_id": objID}).Decode(&task); err == nil {
+			updated = append(updated, task)
+		}
+	}
+	return &BulkUpdateTasksResponse{Updated: len(updated), Tasks: updated}, nil
+}
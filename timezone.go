@@ -0,0 +1,188 @@
+package encoreapp
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	_ "time/tzdata" // the runtime image has no zoneinfo
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// userClock is the requesting user's view of "now": the current time in their zone
+// plus their locale. Date parsing, "today"/"overdue" ranges and the date injected into
+// prompts all go through it.
+type userClock struct {
+	Now    time.Time
+	Locale string
+}
+
+type userClockKey struct{}
+
+// timeNow is the source of "now" for user clocks; tests pin it so recorded prompts match.
+var timeNow = time.Now
+
+// Regions that write numeric dates month first; every other region is day first.
+var monthFirstRegions = map[string]bool{"US": true, "PH": true, "FM": true, "MH": true, "PW": true}
+
+var localePattern = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})*$`)
+
+func (c userClock) Location() *time.Location {
+	return c.Now.Location()
+}
+
+// Today returns midnight of the user's current day.
+func (c userClock) Today() time.Time {
+	return startOfDay(c.Now)
+}
+
+// dayFirst reports whether numeric dates like 6/12 are day/month for this locale.
+func (c userClock) dayFirst() bool {
+	parts := strings.FieldsFunc(c.Locale, func(r rune) bool { return r == '-' || r == '_' })
+	if len(parts) == 0 {
+		return false
+	}
+	for _, p := range parts[1:] {
+		if len(p) == 2 {
+			return !monthFirstRegions[strings.ToUpper(p)]
+		}
+	}
+	return strings.ToLower(parts[0]) != "en"
+}
+
+func (c userClock) parser() dateParser {
+	return dateParser{now: c.Now, dayFirst: c.dayFirst()}
+}
+
+// clockFromContext returns the clock set by withUserClock, or UTC if there is none.
+func clockFromContext(ctx context.Context) userClock {
+	if c, ok := ctx.Value(userClockKey{}).(userClock); ok {
+		return c
+	}
+	return userClock{Now: timeNow().UTC()}
+}
+
+// withUserClock loads the user's time zone and locale into ctx. A valid X-Timezone
+// header overrides the stored zone and is saved to the profile. Nested calls reuse
+// the clock of the outer request.
+func withUserClock(ctx context.Context, userID primitive.ObjectID, tzHeader string) context.Context {
+	if _, ok := ctx.Value(userClockKey{}).(userClock); ok {
+		return ctx
+	}
+	var user User
+	tz := strings.TrimSpace(tzHeader)
+	_, headerValid := loadTimeZone(tz)
+	client, err := GetMongoClient()
+	if err == nil {
+		users := client.Database("gtd").Collection("users")
+		if err := users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+			log.Printf("Failed to load time zone for user %s: %v", userID.Hex(), err)
+		}
+		if headerValid && tz != user.TimeZone {
+			_, err = users.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": bson.M{"timeZone": tz}})
+			if err != nil {
+				log.Printf("Failed to save time zone for user %s: %v", userID.Hex(), err)
+			}
+		}
+	}
+	if headerValid {
+		user.TimeZone = tz
+	}
+
+	loc, ok := loadTimeZone(user.TimeZone)
+	if !ok {
+		loc = time.UTC
+	}
+	return context.WithValue(ctx, userClockKey{}, userClock{Now: timeNow().In(loc), Locale: user.Locale})
+}
+
+// loadTimeZone resolves an IANA zone name. The server's own "Local" zone is not accepted.
+func loadTimeZone(name string) (*time.Location, bool) {
+	if name == "" || name == "Local" {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, false
+	}
+	return loc, true
+}
+
+type UpdateProfileRequest struct {
+	Authorization string  `header:"Authorization"`
+	TimeZone      *string `json:"timeZone,omitempty"` // IANA name, e.g. "Europe/Berlin"
+	Locale        *string `json:"locale,omitempty"`   // BCP 47 tag, e.g. "de-DE"
+
+	AIGroundingDisabled *bool `json:"aiGroundingDisabled,omitempty"` // keep task data out of chat prompts
+	PushDueDisabled     *bool `json:"pushDueDisabled,omitempty"`
+	PushDigestDisabled  *bool `json:"pushDigestDisabled,omitempty"`
+
+	DigestFrequency *string `json:"digestFrequency,omitempty"` // "daily", "weekly" or "" for no email digest
+	DigestTime      *string `json:"digestTime,omitempty"`      // HH:MM in the user's time zone
+	CaptureUseAI    *bool   `json:"captureUseAI,omitempty"`
+}
+
+// encore:api public method=PUT path=/api/auth/profile
+func UpdateProfile(ctx context.Context, req *UpdateProfileRequest) (*GetUserResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	update := bson.M{"updatedAt": time.Now()}
+	if req.TimeZone != nil {
+		if _, ok := loadTimeZone(*req.TimeZone); !ok {
+			return nil, errors.New("invalid time zone")
+		}
+		update["timeZone"] = *req.TimeZone
+	}
+	if req.Locale != nil {
+		if *req.Locale != "" && !localePattern.MatchString(*req.Locale) {
+			return nil, errors.New("invalid locale")
+		}
+		update["locale"] = *req.Locale
+	}
+	if req.AIGroundingDisabled != nil {
+		update["aiGroundingDisabled"] = *req.AIGroundingDisabled
+	}
+	if req.PushDueDisabled != nil {
+		update["pushDueDisabled"] = *req.PushDueDisabled
+	}
+	if req.PushDigestDisabled != nil {
+		update["pushDigestDisabled"] = *req.PushDigestDisabled
+	}
+	if req.DigestFrequency != nil {
+		switch *req.DigestFrequency {
+		case "", "daily", "weekly":
+		default:
+			return nil, errors.New("digest frequency must be daily, weekly or empty")
+		}
+		update["digestFrequency"] = *req.DigestFrequency
+	}
+	if req.DigestTime != nil {
+		if _, err := time.Parse("15:04", *req.DigestTime); err != nil {
+			return nil, errors.New("digest time must be HH:MM")
+		}
+		update["digestTime"] = *req.DigestTime
+	}
+	if req.CaptureUseAI != nil {
+		update["captureUseAI"] = *req.CaptureUseAI
+	}
+
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	users := client.Database("gtd").Collection("users")
+	if _, err := users.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": update}); err != nil {
+		return nil, errors.New("failed to update profile")
+	}
+	var user User
+	if err := users.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return nil, errors.New("failed to load profile")
+	}
+	return &GetUserResponse{User: user}, nil
+}
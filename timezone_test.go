@@ -0,0 +1,77 @@
+package encoreapp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUserClockDayFirst(t *testing.T) {
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	cases := []struct {
+		locale   string
+		dayFirst bool
+	}{
+		{"", false},
+		{"en", false},
+		{"en-US", false},
+		{"en_PH", false},
+		{"es-US", false},
+		{"en-GB", true},
+		{"en-AU", true},
+		{"de", true},
+		{"de-DE", true},
+		{"fr-CA", true},
+		{"pt-BR", true},
+		{"zh-Hant-TW", true}, // the script subtag is skipped
+	}
+	for _, c := range cases {
+		clock := userClock{Now: now, Locale: c.locale}
+		if got := clock.dayFirst(); got != c.dayFirst {
+			t.Errorf("%q: dayFirst = %v, want %v", c.locale, got, c.dayFirst)
+		}
+		want := "2026-06-12"
+		if c.dayFirst {
+			want = "2026-12-06"
+		}
+		if got, err := parseTaskDate("6/12", clock); err != nil || got.Format("2006-01-02") != want {
+			t.Errorf("%q: 6/12 parsed as %v (%v), want %s", c.locale, got, err, want)
+		}
+	}
+}
+
+func TestWithUserClock(t *testing.T) {
+	now := time.Date(2026, 3, 2, 23, 30, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	// Without a stored profile only the header decides the zone
+	cases := []struct {
+		header string
+		zone   string
+		today  string
+	}{
+		{"", "UTC", "2026-03-02"},
+		{"Europe/Berlin", "Europe/Berlin", "2026-03-03"},
+		{" America/New_York ", "America/New_York", "2026-03-02"},
+		{"Local", "UTC", "2026-03-02"},
+		{"Mars/Olympus_Mons", "UTC", "2026-03-02"},
+	}
+	for _, c := range cases {
+		clock := clockFromContext(withUserClock(context.Background(), primitive.NewObjectID(), c.header))
+		if clock.Location().String() != c.zone || !clock.Now.Equal(now) || clock.Today().Format("2006-01-02") != c.today {
+			t.Errorf("header %q: now %v, today %v, want zone %s, today %s", c.header, clock.Now, clock.Today(), c.zone, c.today)
+		}
+	}
+
+	// Nested calls keep the outer request's clock
+	outer := withUserClock(context.Background(), primitive.NewObjectID(), "Asia/Tokyo")
+	if clock := clockFromContext(withUserClock(outer, primitive.NewObjectID(), "Europe/Berlin")); clock.Location().String() != "Asia/Tokyo" {
+		t.Errorf("nested clock zone = %s, want Asia/Tokyo", clock.Location())
+	}
+	if clock := clockFromContext(context.Background()); clock.Location() != time.UTC || !clock.Now.Equal(now) {
+		t.Errorf("default clock = %v, want %v in UTC", clock.Now, now)
+	}
+}
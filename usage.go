@@ -0,0 +1,262 @@
+package encoreapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"encore.dev/beta/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AI usage is metered per user and calendar day (in the user's time zone) in the
+// "ai_usage" collection and checked against the daily quota of the user's plan before
+// every model call.
+
+// AIQuota is the daily allowance of a plan. Zero means unlimited.
+type AIQuota struct {
+	Requests int64 `json:"requests"`
+	Tokens   int64 `json:"tokens"`
+}
+
+// Default plan quotas; AI_PLAN_QUOTAS (JSON, e.g. {"free":{"requests":50,"tokens":20000}})
+// overrides them per plan.
+var defaultPlanQuotas = map[string]AIQuota{
+	"free": {Requests: 100, Tokens: 100000},
+	"pro":  {Requests: 2000, Tokens: 2000000},
+}
+
+// USD per million prompt/completion tokens, used for cost accounting.
+var modelPrices = map[string]struct{ Prompt, Completion float64 }{
+	"llama-3.1-8b-instant":    {Prompt: 0.05, Completion: 0.08},
+	"llama-3.3-70b-versatile": {Prompt: 0.59, Completion: 0.79},
+}
+
+// QuotaExceededError describes a used-up daily quota. AI endpoints return it as the
+// details of a ResourceExhausted error, so clients get a 429 with the limits.
+type QuotaExceededError struct {
+	Plan     string    `json:"plan"`
+	Resource string    `json:"resource"` // "requests" or "tokens"
+	Limit    int64     `json:"limit"`
+	Used     int64     `json:"used"`
+	ResetAt  time.Time `json:"resetAt"`
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("daily AI %s quota of the %s plan exceeded (%d/%d), resets at %s",
+		e.Resource, e.Plan, e.Used, e.Limit, e.ResetAt.Format(time.RFC3339))
+}
+
+func (*QuotaExceededError) ErrDetails() {}
+
+// quotaError wraps q in the error returned to clients.
+func quotaError(q *QuotaExceededError) error {
+	return &errs.Error{Code: errs.ResourceExhausted, Message: q.Error(), Details: q}
+}
+
+// planQuotaOverrides parses AI_PLAN_QUOTAS; it is nil when unset or invalid.
+func planQuotaOverrides() map[string]AIQuota {
+	if secrets.AI_PLAN_QUOTAS == "" {
+		return nil
+	}
+	var overrides map[string]AIQuota
+	if err := json.Unmarshal([]byte(secrets.AI_PLAN_QUOTAS), &overrides); err != nil {
+		log.Printf("Invalid AI_PLAN_QUOTAS: %v", err)
+		return nil
+	}
+	return overrides
+}
+
+func planQuota(plan string) AIQuota {
+	if q, ok := planQuotaOverrides()[plan]; ok {
+		return q
+	}
+	return defaultPlanQuotas[plan]
+}
+
+// knownPlan reports whether plan is a default plan or one defined in AI_PLAN_QUOTAS.
+func knownPlan(plan string) bool {
+	if _, ok := defaultPlanQuotas[plan]; ok {
+		return true
+	}
+	_, ok := planQuotaOverrides()[plan]
+	return ok
+}
+
+func userPlan(ctx context.Context, userID primitive.ObjectID) string {
+	client, err := GetMongoClient()
+	if err != nil {
+		return "free"
+	}
+	var user User
+	opts := options.FindOne().SetProjection(bson.M{"plan": 1})
+	if err := client.Database("gtd").Collection("users").FindOne(ctx, bson.M{"_id": userID}, opts).Decode(&user); err != nil || user.Plan == "" {
+		return "free"
+	}
+	return user.Plan
+}
+
+// usageDay is the key of the user's current metering day.
+func usageDay(ctx context.Context) string {
+	return clockFromContext(ctx).Now.Format("2006-01-02")
+}
+
+// checkAIQuota returns a quota error when today's usage has reached the plan's limits. Metering failures don't block requests.
+func checkAIQuota(ctx context.Context, userID primitive.ObjectID) error {
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil
+	}
+	plan := userPlan(ctx, userID)
+	quota := planQuota(plan)
+	if quota.Requests == 0 && quota.Tokens == 0 {
+		return nil
+	}
+
+	var usage AIUsageDay
+	col := client.Database("gtd").Collection("ai_usage")
+	if err := col.FindOne(ctx, bson.M{"userId": userID, "day": usageDay(ctx)}).Decode(&usage); err != nil {
+		return nil
+	}
+	if q := exceededQuota(plan, quota, usage, clockFromContext(ctx).Today().AddDate(0, 0, 1)); q != nil {
+		return quotaError(q)
+	}
+	return nil
+}
+
+// exceededQuota reports the first limit of quota that usage has reached, or nil.
+func exceededQuota(plan string, quota AIQuota, usage AIUsageDay, resetAt time.Time) *QuotaExceededError {
+	if quota.Requests > 0 && usage.Requests >= quota.Requests {
+		return &QuotaExceededError{Plan: plan, Resource: "requests", Limit: quota.Requests, Used: usage.Requests, ResetAt: resetAt}
+	}
+	if quota.Tokens > 0 && usage.TotalTokens >= quota.Tokens {
+		return &QuotaExceededError{Plan: plan, Resource: "tokens", Limit: quota.Tokens, Used: usage.TotalTokens, ResetAt: resetAt}
+	}
+	return nil
+}
+
+// usageCost is the USD cost of one call to model; unknown models cost nothing.
+func usageCost(model string, usage GroqUsage) float64 {
+	price := modelPrices[model]
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6
+}
+
+// recordAIUsage adds one model call to the user's usage for today.
+func recordAIUsage(ctx context.Context, userID primitive.ObjectID, model string, usage GroqUsage) {
+	client, err := GetMongoClient()
+	if err != nil {
+		return
+	}
+	cost := usageCost(model, usage)
+	now := time.Now()
+	_, err = client.Database("gtd").Collection("ai_usage").UpdateOne(ctx,
+		bson.M{"userId": userID, "day": usageDay(ctx)},
+		bson.M{
+			"$inc": bson.M{
+				"requests":         1,
+				"promptTokens":     usage.PromptTokens,
+				"completionTokens": usage.CompletionTokens,
+				"totalTokens":      usage.TotalTokens,
+				"costUsd":          cost,
+			},
+			"$set":         bson.M{"updatedAt": now},
+			"$setOnInsert": bson.M{"createdAt": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("Failed to record AI usage for user %s: %v", userID.Hex(), err)
+	}
+}
+
+type AIUsageRequest struct {
+	Authorization string `header:"Authorization"`
+	TimeZone      string `header:"X-Timezone"`
+	Days          int    `query:"days"` // history length including today, default 7
+}
+
+type AIUsageResponse struct {
+	Plan    string       `json:"plan"`
+	Quota   AIQuota      `json:"quota"`
+	Today   AIUsageDay   `json:"today"`
+	History []AIUsageDay `json:"history"` // most recent first
+}
+
+// encore:api public method=GET path=/api/ai/usage
+func AIUsage(ctx context.Context, req *AIUsageRequest) (*AIUsageResponse, error) {
+	userID, err := getUserObjectIDFromAuth(ctx, req.Authorization)
+	if err != nil {
+		return nil, errors.New("unauthorized")
+	}
+	ctx = withUserClock(ctx, userID, req.TimeZone)
+	days := req.Days
+	if days <= 0 || days > 90 {
+		days = 7
+	}
+
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	col := client.Database("gtd").Collection("ai_usage")
+	since := clockFromContext(ctx).Today().AddDate(0, 0, 1-days).Format("2006-01-02")
+	opts := options.Find().SetSort(bson.M{"day": -1})
+	cur, err := col.Find(ctx, bson.M{"userId": userID, "day": bson.M{"$gte": since}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	history := []AIUsageDay{}
+	for cur.Next(ctx) {
+		var u AIUsageDay
+		if err := cur.Decode(&u); err == nil {
+			history = append(history, u)
+		}
+	}
+
+	plan := userPlan(ctx, userID)
+	resp := &AIUsageResponse{
+		Plan:    plan,
+		Quota:   planQuota(plan),
+		Today:   AIUsageDay{UserID: userID, Day: usageDay(ctx)},
+		History: history,
+	}
+	if len(history) > 0 && history[0].Day == resp.Today.Day {
+		resp.Today = history[0]
+	}
+	return resp, nil
+}
+
+type SetUserPlanRequest struct {
+	Plan string `json:"plan"`
+}
+
+// encore:api private method=PUT path=/api/admin/users/:id/plan
+func SetUserPlan(ctx context.Context, id string, req *SetUserPlanRequest) (*GetUserResponse, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, errors.New("invalid user id")
+	}
+	if !knownPlan(req.Plan) {
+		return nil, errors.New("unknown plan")
+	}
+	client, err := GetMongoClient()
+	if err != nil {
+		return nil, errors.New("database connection failed")
+	}
+	var user User
+	err = client.Database("gtd").Collection("users").FindOneAndUpdate(ctx,
+		bson.M{"_id": objID},
+		bson.M{"$set": bson.M{"plan": req.Plan, "updatedAt": time.Now()}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	return &GetUserResponse{User: user}, nil
+}
@@ -0,0 +1,127 @@
+package encoreapp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"encore.dev/beta/errs"
+)
+
+func TestQuotaErrorIsResourceExhausted(t *testing.T) {
+	q := &QuotaExceededError{Plan: "free", Resource: "requests", Limit: 100, Used: 100, ResetAt: time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)}
+	err := quotaError(q)
+
+	var e *errs.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("quotaError returned %T, want *errs.Error", err)
+	}
+	if e.Code != errs.ResourceExhausted || e.Details != q || e.Message != q.Error() {
+		t.Errorf("got code %v, details %v, message %q", e.Code, e.Details, e.Message)
+	}
+	if aiErrorCode(err) != errs.ResourceExhausted || aiErrorCode(fmt.Errorf("parse intent: %w", err)) != errs.ResourceExhausted {
+		t.Error("aiErrorCode should report ResourceExhausted for the error and wrapped copies of it")
+	}
+	if got := httpStatusForError(err); got != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", got)
+	}
+}
+
+func TestPlanQuota(t *testing.T) {
+	defer func() { secrets.AI_PLAN_QUOTAS = "" }()
+	cases := []struct {
+		overrides string
+		plan      string
+		want      AIQuota
+	}{
+		{"", "free", AIQuota{Requests: 100, Tokens: 100000}},
+		{"", "pro", AIQuota{Requests: 2000, Tokens: 2000000}},
+		{"", "enterprise", AIQuota{}},
+		{`{"free":{"requests":50,"tokens":20000}}`, "free", AIQuota{Requests: 50, Tokens: 20000}},
+		{`{"free":{"requests":50,"tokens":20000}}`, "pro", AIQuota{Requests: 2000, Tokens: 2000000}},
+		{`{"pro":{"requests":0,"tokens":0}}`, "pro", AIQuota{}},
+		{`{"free":`, "free", AIQuota{Requests: 100, Tokens: 100000}},
+	}
+	for _, c := range cases {
+		secrets.AI_PLAN_QUOTAS = c.overrides
+		if got := planQuota(c.plan); got != c.want {
+			t.Errorf("planQuota(%q) with %q = %+v, want %+v", c.plan, c.overrides, got, c.want)
+		}
+	}
+}
+
+func TestKnownPlan(t *testing.T) {
+	defer func() { secrets.AI_PLAN_QUOTAS = "" }()
+	cases := []struct {
+		overrides string
+		plan      string
+		want      bool
+	}{
+		{"", "free", true},
+		{"", "pro", true},
+		{"", "enterprise", false},
+		{`{"enterprise":{"requests":10000,"tokens":10000000}}`, "enterprise", true},
+		{`{"enterprise":{"requests":10000,"tokens":10000000}}`, "pro", true},
+		{`{"enterprise":`, "enterprise", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		secrets.AI_PLAN_QUOTAS = c.overrides
+		if got := knownPlan(c.plan); got != c.want {
+			t.Errorf("knownPlan(%q) with %q = %v, want %v", c.plan, c.overrides, got, c.want)
+		}
+	}
+}
+
+func TestExceededQuota(t *testing.T) {
+	resetAt := time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)
+	quota := AIQuota{Requests: 100, Tokens: 1000}
+	cases := []struct {
+		name     string
+		quota    AIQuota
+		usage    AIUsageDay
+		resource string // "" when nothing is exceeded
+		used     int64
+	}{
+		{"under both limits", quota, AIUsageDay{Requests: 99, TotalTokens: 999}, "", 0},
+		{"requests reached", quota, AIUsageDay{Requests: 100, TotalTokens: 10}, "requests", 100},
+		{"tokens reached", quota, AIUsageDay{Requests: 1, TotalTokens: 1000}, "tokens", 1000},
+		{"requests checked first", quota, AIUsageDay{Requests: 150, TotalTokens: 5000}, "requests", 150},
+		{"unlimited requests", AIQuota{Tokens: 1000}, AIUsageDay{Requests: 1e6, TotalTokens: 10}, "", 0},
+		{"unlimited tokens", AIQuota{Requests: 100}, AIUsageDay{Requests: 10, TotalTokens: 1e9}, "", 0},
+		{"unlimited plan", AIQuota{}, AIUsageDay{Requests: 1e6, TotalTokens: 1e9}, "", 0},
+	}
+	for _, c := range cases {
+		q := exceededQuota("free", c.quota, c.usage, resetAt)
+		if c.resource == "" {
+			if q != nil {
+				t.Errorf("%s: got %+v, want nil", c.name, q)
+			}
+			continue
+		}
+		if q == nil || q.Resource != c.resource || q.Used != c.used || q.Plan != "free" || !q.ResetAt.Equal(resetAt) {
+			t.Errorf("%s: got %+v, want %s used %d", c.name, q, c.resource, c.used)
+		}
+	}
+}
+
+func TestUsageCost(t *testing.T) {
+	cases := []struct {
+		model string
+		usage GroqUsage
+		want  float64
+	}{
+		{"llama-3.1-8b-instant", GroqUsage{PromptTokens: 1e6, CompletionTokens: 1e6}, 0.13},
+		{"llama-3.3-70b-versatile", GroqUsage{PromptTokens: 2000, CompletionTokens: 500}, 0.001575},
+		{"llama-3.3-70b-versatile", GroqUsage{}, 0},
+		{"unknown-model", GroqUsage{PromptTokens: 1e6, CompletionTokens: 1e6}, 0},
+	}
+	for _, c := range cases {
+		if got := usageCost(c.model, c.usage); math.Abs(got-c.want) > 1e-12 {
+			t.Errorf("usageCost(%q, %+v) = %g, want %g", c.model, c.usage, got, c.want)
+		}
+	}
+}